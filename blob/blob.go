@@ -97,3 +97,37 @@ type Scanner interface {
 	// Key returns the current key.
 	Key() string
 }
+
+type storageClassKey struct{}
+
+// WithStorageClass returns a context which requests that objects
+// written through Bucket.Put with this context are stored using the
+// provided, implementation-specific, storage class. Bucket
+// implementations that do not support storage classes ignore it.
+func WithStorageClass(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, storageClassKey{}, class)
+}
+
+// StorageClass returns the storage class requested by ctx, or
+// an empty string if no storage class was requested.
+func StorageClass(ctx context.Context) string {
+	class, _ := ctx.Value(storageClassKey{}).(string)
+	return class
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a context which requests that objects written
+// through Bucket.Put with this context are stored with the provided
+// user metadata. Bucket implementations that do not support metadata
+// ignore it.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// Metadata returns the user metadata requested by ctx, or nil if
+// none was requested.
+func Metadata(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package httpblob implements the blob interfaces for plain HTTP
+// object stores, such as WebDAV servers and HTTP artifact stores.
+// Objects are written with PUT, read with GET, inspected with HEAD,
+// and removed with DELETE. Since HTTP provides no way to list
+// objects, scanning (and thus interning directories) is not
+// supported.
+package httpblob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A TokenProvider provides bearer tokens with which requests
+// are authenticated.
+type TokenProvider interface {
+	// Token returns the current bearer token.
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenProvider that always provides the same token.
+type StaticToken string
+
+// Token implements TokenProvider.
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Store implements blob.Store for HTTP object stores. Buckets are
+// named by the host (and port) of the store.
+type Store struct {
+	scheme string
+	client *http.Client
+	tokens TokenProvider
+}
+
+// New returns a new store for the given scheme ("http" or "https").
+// Requests are made with the provided client, or http.DefaultClient
+// if it is nil. If tokens is non-nil, each request carries an
+// "Authorization: Bearer" header with a token from tokens.
+func New(scheme string, client *http.Client, tokens TokenProvider) *Store {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Store{scheme: scheme, client: client, tokens: tokens}
+}
+
+// Bucket returns the bucket for the provided host.
+func (s *Store) Bucket(ctx context.Context, host string) (blob.Bucket, error) {
+	if host == "" {
+		return nil, errors.E("httpblob.Bucket", errors.Invalid, errors.New("empty host"))
+	}
+	return &Bucket{store: s, location: fmt.Sprintf("%s://%s/", s.scheme, host)}, nil
+}
+
+// Bucket represents a single HTTP host.
+type Bucket struct {
+	store    *Store
+	location string
+}
+
+// Location returns the bucket's URL.
+func (b *Bucket) Location() string { return b.location }
+
+// do performs an HTTP request for the object at key, returning the
+// response if its status is 2xx. If etag is nonempty, it is used as
+// an (If-Match) precondition.
+func (b *Bucket) do(ctx context.Context, method, key, etag string, body io.Reader, size int64) (*http.Response, error) {
+	url := b.location + strings.TrimPrefix(key, "/")
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, errors.E(method, url, errors.Invalid, err)
+	}
+	req = req.WithContext(ctx)
+	if size > 0 {
+		req.ContentLength = size
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	if b.store.tokens != nil {
+		token, err := b.store.tokens.Token(ctx)
+		if err != nil {
+			return nil, errors.E(method, url, errors.NotAllowed, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := b.store.client.Do(req)
+	if err != nil {
+		return nil, errors.E(method, url, errors.Net, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, errors.E(method, url, statusKind(resp.StatusCode), errors.New(resp.Status))
+	}
+	return resp, nil
+}
+
+// statusKind returns the error kind corresponding to a (non-2xx)
+// HTTP status code.
+func statusKind(code int) errors.Kind {
+	switch {
+	case code == http.StatusNotFound:
+		return errors.NotExist
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return errors.NotAllowed
+	case code == http.StatusPreconditionFailed:
+		return errors.Precondition
+	case code == http.StatusServiceUnavailable:
+		return errors.Unavailable
+	case code >= 500:
+		return errors.Temporary
+	default:
+		return errors.Other
+	}
+}
+
+// file returns the reflow.File described by the response resp
+// for the object at key.
+func (b *Bucket) file(key string, resp *http.Response) reflow.File {
+	file := reflow.File{
+		Source: b.location + strings.TrimPrefix(key, "/"),
+		ETag:   resp.Header.Get("ETag"),
+	}
+	if resp.ContentLength > 0 {
+		file.Size = resp.ContentLength
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		file.LastModified = t
+	}
+	return file
+}
+
+// File retrieves file metadata for the provided key with a HEAD request.
+func (b *Bucket) File(ctx context.Context, key string) (reflow.File, error) {
+	resp, err := b.do(ctx, "HEAD", key, "", nil, 0)
+	if err != nil {
+		return reflow.File{}, err
+	}
+	resp.Body.Close()
+	return b.file(key, resp), nil
+}
+
+// Get returns a reader for the object at key. If etag is nonempty,
+// it is used as a precondition.
+func (b *Bucket) Get(ctx context.Context, key, etag string) (io.ReadCloser, reflow.File, error) {
+	resp, err := b.do(ctx, "GET", key, etag, nil, 0)
+	if err != nil {
+		return nil, reflow.File{}, err
+	}
+	return resp.Body, b.file(key, resp), nil
+}
+
+// Download downloads the object at key into w.
+func (b *Bucket) Download(ctx context.Context, key, etag string, size int64, w io.WriterAt) (int64, error) {
+	resp, err := b.do(ctx, "GET", key, etag, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(&offsetWriter{w: w}, resp.Body)
+}
+
+// Put uploads body to the provided key with a PUT request. The
+// upload succeeds only if the server responds with a 2xx status.
+func (b *Bucket) Put(ctx context.Context, key string, size int64, body io.Reader, contentHash string) error {
+	if size == 0 {
+		// Spool the body to a temporary file so that the request's
+		// length is known without holding the body in memory; some
+		// servers do not support chunked uploads.
+		f, err := ioutil.TempFile("", "httpblob")
+		if err != nil {
+			return errors.E("PUT", b.location+key, err)
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		if size, err = io.Copy(f, body); err != nil {
+			return errors.E("PUT", b.location+key, err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return errors.E("PUT", b.location+key, err)
+		}
+		body = f
+		if size == 0 {
+			body = http.NoBody
+		}
+	}
+	resp, err := b.do(ctx, "PUT", key, "", body, size)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// Delete removes the provided keys with DELETE requests.
+func (b *Bucket) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		resp, err := b.do(ctx, "DELETE", key, "", nil, 0)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+var errNotSupported = errors.New("operation not supported by HTTP object stores")
+
+// Scan is not supported; the returned scanner fails immediately.
+func (b *Bucket) Scan(prefix string) blob.Scanner {
+	return errScanner{errors.E("scan", b.location+prefix, errors.NotSupported, errNotSupported)}
+}
+
+// Snapshot is not supported.
+func (b *Bucket) Snapshot(ctx context.Context, prefix string) (reflow.Fileset, error) {
+	return reflow.Fileset{}, errors.E("snapshot", b.location+prefix, errors.NotSupported, errNotSupported)
+}
+
+// Copy is not supported.
+func (b *Bucket) Copy(ctx context.Context, src, dst, contentHash string) error {
+	return errors.E("copy", b.location+src, b.location+dst, errors.NotSupported, errNotSupported)
+}
+
+// CopyFrom is not supported.
+func (b *Bucket) CopyFrom(ctx context.Context, srcBucket blob.Bucket, src, dst string) error {
+	return errors.E("copyfrom", srcBucket.Location()+src, b.location+dst, errors.NotSupported, errNotSupported)
+}
+
+type errScanner struct{ err error }
+
+func (s errScanner) Scan(ctx context.Context) bool { return false }
+func (s errScanner) Err() error                    { return s.err }
+func (s errScanner) File() reflow.File             { return reflow.File{} }
+func (s errScanner) Key() string                   { return "" }
+
+// offsetWriter adapts an io.WriterAt to a sequential io.Writer.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package httpblob
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/errors"
+)
+
+type server struct {
+	mu      sync.Mutex
+	objects map[string]string
+	lengths map[string]int64
+	auth    []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case "PUT":
+		if strings.HasPrefix(r.URL.Path, "/fail/") {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		p, _ := ioutil.ReadAll(r.Body)
+		s.objects[r.URL.Path] = string(p)
+		if s.lengths != nil {
+			s.lengths[r.URL.Path] = r.ContentLength
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "GET", "HEAD":
+		obj, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Write([]byte(obj))
+	default:
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	srv := &server{objects: make(map[string]string)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	mux := blob.Mux{"http": New("http", nil, StaticToken("secret"))}
+	bucket, prefix, err := mux.Bucket(ctx, ts.URL+"/path/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prefix, "path/"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := bucket.Location(), "http://"+u.Host+"/"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for key, contents := range map[string]string{"path/a": "hello", "path/b/c": "world", "path/empty": ""} {
+		if err := bucket.Put(ctx, key, int64(len(contents)), bytes.NewReader([]byte(contents)), ""); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := srv.objects["/"+key], contents; got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+	for _, auth := range srv.auth {
+		if got, want := auth, "Bearer secret"; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	rc, file, err := bucket.Get(ctx, "path/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(p), "hello"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := file.Source, bucket.Location()+"path/a"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := bucket.Put(ctx, "fail/x", 1, strings.NewReader("x"), ""); !errors.Is(errors.Temporary, err) {
+		t.Errorf("expected temporary error, got %v", err)
+	}
+	if _, err := bucket.File(ctx, "path/missing"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	if _, err := bucket.Snapshot(ctx, "path/"); !errors.Is(errors.NotSupported, err) {
+		t.Errorf("expected not supported error, got %v", err)
+	}
+}
+
+func TestPutUnknownSize(t *testing.T) {
+	srv := &server{objects: make(map[string]string), lengths: make(map[string]int64)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	ctx := context.Background()
+	bucket, _, err := blob.Mux{"http": New("http", nil, nil)}.Bucket(ctx, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, contents := range map[string]string{"stream": "streamed contents", "empty": ""} {
+		if err := bucket.Put(ctx, key, 0, strings.NewReader(contents), ""); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := srv.objects["/"+key], contents; got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+		// The upload is not chunked: its length is known.
+		if got, want := srv.lengths["/"+key], int64(len(contents)); got != want {
+			t.Errorf("%s: got content length %d, want %d", key, got, want)
+		}
+	}
+}
@@ -412,6 +412,11 @@ func (b *Bucket) Get(ctx context.Context, key, etag string) (io.ReadCloser, refl
 // Put stores the contents of the provided io.Reader at the provided key
 // and attaches the given contentHash to the object's metadata.
 func (b *Bucket) Put(ctx context.Context, key string, size int64, body io.Reader, contentHash string) error {
+	class := blob.StorageClass(ctx)
+	if class != "" && !ValidStorageClass(class) {
+		return errors.E("s3blob.Put", b.bucket, key, errors.Invalid,
+			errors.Errorf("invalid storage class %q", class))
+	}
 	s3concurrency := maxS3Ops(size)
 	var err error
 	policy := timeoutPolicy(size)
@@ -428,8 +433,20 @@ func (b *Bucket) Put(ctx context.Context, key string, size int64, body io.Reader
 				Key:    aws.String(key),
 				Body:   body,
 			}
+			for k, v := range blob.Metadata(ctx) {
+				if input.Metadata == nil {
+					input.Metadata = make(map[string]*string)
+				}
+				input.Metadata[k] = aws.String(v)
+			}
 			if contentHash != "" {
-				input.Metadata = map[string]*string{awsContentSha256Key: aws.String(contentHash)}
+				if input.Metadata == nil {
+					input.Metadata = make(map[string]*string)
+				}
+				input.Metadata[awsContentSha256Key] = aws.String(contentHash)
+			}
+			if class != "" {
+				input.StorageClass = aws.String(class)
 			}
 			_, err = up.UploadWithContext(ctx, input)
 			err = ctxErr(ctx, err)
@@ -453,6 +470,24 @@ func (b *Bucket) Put(ctx context.Context, key string, size int64, body io.Reader
 	return err
 }
 
+// storageClasses is the set of known S3 storage classes.
+var storageClasses = map[string]bool{
+	s3.StorageClassStandard:           true,
+	s3.StorageClassReducedRedundancy:  true,
+	s3.StorageClassStandardIa:         true,
+	s3.StorageClassOnezoneIa:          true,
+	s3.StorageClassIntelligentTiering: true,
+	s3.StorageClassGlacier:            true,
+	s3.StorageClassDeepArchive:        true,
+}
+
+// ValidStorageClass tells whether class names a known S3 storage
+// class (e.g., "STANDARD_IA", "GLACIER"). Storage classes may be
+// requested for uploads with blob.WithStorageClass.
+func ValidStorageClass(class string) bool {
+	return storageClasses[class]
+}
+
 // Snapshot returns an un-loaded Reflow fileset of the contents at the
 // provided prefix.
 func (b *Bucket) Snapshot(ctx context.Context, prefix string) (reflow.Fileset, error) {
@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/blob"
 	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/testutil"
 	"github.com/grailbio/testutil/s3test"
@@ -251,6 +253,46 @@ func TestPutWithContentHash(t *testing.T) {
 	checkObject(t, bucket, "newkey2", c, d)
 }
 
+func TestPutWithStorageClass(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		classes = make(map[string]string)
+	)
+	client := s3test.NewClient(t, name)
+	client.Region = "us-west-2"
+	client.Err = func(api string, input interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch input := input.(type) {
+		case *s3.PutObjectInput:
+			classes[*input.Key] = aws.StringValue(input.StorageClass)
+		case *s3.CreateMultipartUploadInput:
+			classes[*input.Key] = aws.StringValue(input.StorageClass)
+		}
+		return nil
+	}
+	bucket := NewBucket(name, client)
+	c := content("new content")
+	ctx := blob.WithStorageClass(context.Background(), s3.StorageClassGlacier)
+	if err := bucket.Put(ctx, "archived", 0, bytes.NewReader(c.Data), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.Put(context.Background(), "standard", 0, bytes.NewReader(c.Data), ""); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	for key, want := range map[string]string{"archived": s3.StorageClassGlacier, "standard": ""} {
+		if got, ok := classes[key]; !ok || got != want {
+			t.Errorf("%s: got storage class %q (uploaded %v), want %q", key, got, ok, want)
+		}
+	}
+	mu.Unlock()
+	ctx = blob.WithStorageClass(context.Background(), "COLD")
+	if err := bucket.Put(ctx, "invalid", 0, bytes.NewReader(c.Data), ""); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected invalid error, got %v", err)
+	}
+}
+
 func TestDownload(t *testing.T) {
 	bucket := newTestBucket(t)
 	ctx := context.Background()
@@ -95,6 +95,7 @@ func main() {
 		infra2.Tracer:     new(trace.Tracer),
 		infra2.TaskDB:     new(taskdb.TaskDB),
 		infra2.Docker:     new(infra2.DockerConfig),
+		infra2.HTTPToken:  new(infra2.HTTPTokenConfig),
 	}
 	cmd.SchemaKeys = infra.Keys{
 		infra2.AWSCreds:  "awscreds",
@@ -111,6 +112,7 @@ func main() {
 		infra2.Username:  "user",
 		infra2.Tracer:    "xray",
 		infra2.Docker:    "docker,memlimit=soft",
+		infra2.HTTPToken: "httptoken",
 	}
 	cmd.BootstrapBinary = bootstrapimage
 	cmd.Flags().Parse(os.Args[1:])
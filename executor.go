@@ -7,6 +7,7 @@ package reflow
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
@@ -28,6 +29,19 @@ type Result struct {
 
 	// Err is error produced by an exec.
 	Err *errors.Error `json:",omitempty"`
+
+	// Decompressed maps the paths of interned files that were
+	// decompressed to the compression codec that was detected.
+	Decompressed map[string]string `json:",omitempty"`
+
+	// Partial tells whether Fileset holds the outputs salvaged from a
+	// failed exec (see ExecConfig.SalvageOutputs), rather than the
+	// exec's complete result.
+	Partial bool `json:",omitempty"`
+	// Missing are the indices of the outputs that were absent (or
+	// empty) in a partial result; an exec with a single output has
+	// index 0.
+	Missing []int `json:",omitempty"`
 }
 
 // String renders a human-readable string of this result.
@@ -57,6 +71,9 @@ func (r Result) Equal(s Result) bool {
 	if r.Err != nil && r.Err.Error() != s.Err.Error() {
 		return false
 	}
+	if r.Partial != s.Partial {
+		return false
+	}
 	return true
 }
 
@@ -93,6 +110,127 @@ type ExecConfig struct {
 	// Docker image.
 	Cmd string
 
+	// exec: Wrapper is an optional command prefix which is used to run
+	// the (shell-wrapped) Cmd, e.g., ["strace", "-f", "-o", "$tmp/trace"].
+	// The wrapper must exist in the Docker image. $tmp (or ${tmp}) is
+	// substituted in the wrapper's arguments, which are otherwise
+	// passed as they are.
+	Wrapper []string `json:",omitempty"`
+
+	// exec: TmpfsOptions, if non-nil, causes the exec's $tmp to be
+	// backed by a tmpfs mount with the given options instead of the
+	// executor's scratch directory. Note that the contents of a tmpfs
+	// $tmp are not profiled or snapshotted.
+	TmpfsOptions *TmpfsOptions `json:",omitempty"`
+
+	// exec: OutputTmpfs places the exec's outputs in memory, in the
+	// executor's tmpfs output directory, rather than on disk. This
+	// avoids a round trip through the disk for small outputs, which
+	// are digested from memory as they are installed. The memory is
+	// released once the exec completes. Memory-backed outputs are
+	// profiled under the "outmem" gauge instead of "out" and "disk".
+	// OutputTmpfs may not be combined with LazyDigests.
+	OutputTmpfs bool `json:",omitempty"`
+
+	// exec: StopSignal is the signal (e.g., "SIGINT") sent to the
+	// exec's container when it is stopped, whether by killing the exec
+	// or by shutting down its executor. If StopSignal or StopTimeout is
+	// set, the container is stopped gracefully: it is sent StopSignal
+	// (SIGTERM by default) and is killed only if it has not exited
+	// after StopTimeout (10 seconds by default). Otherwise the
+	// container is killed immediately.
+	StopSignal string `json:",omitempty"`
+
+	// exec: StopTimeout is the time given to the exec's container to
+	// exit after it has been sent StopSignal. It is rounded up to whole
+	// seconds.
+	StopTimeout time.Duration `json:",omitempty"`
+
+	// exec: MountDockerSocket binds the host's Docker socket into the
+	// exec's container at /var/run/docker.sock, so that the exec may
+	// itself use Docker. Executors must explicitly allow this.
+	MountDockerSocket bool `json:",omitempty"`
+
+	// exec: CapAdd lists the Linux capabilities (e.g., "SYS_PTRACE")
+	// to add to the exec's container, in addition to those granted by
+	// the executor. Executors must explicitly allow each capability
+	// that may be added.
+	CapAdd []string `json:",omitempty"`
+
+	// exec: CapDrop lists the Linux capabilities to drop from the
+	// exec's container, in addition to those dropped by the executor.
+	// "ALL" drops every capability not explicitly added.
+	CapDrop []string `json:",omitempty"`
+
+	// exec: MergeStderr redirects the exec command's standard error
+	// to its standard output, so that the two are interleaved in a
+	// single log stream as they are written. Logs then returns the
+	// merged stream whether stdout, stderr, or both are requested.
+	MergeStderr bool `json:",omitempty"`
+
+	// exec: TmpLog tees the exec command's standard output and error,
+	// as they are written, to the file $tmp/.log, where the command
+	// may read them, e.g., to include them in its outputs. The file
+	// outlives the container's logs: it is rewritten in full if the
+	// executor is restarted while the exec runs.
+	TmpLog bool `json:",omitempty"`
+
+	// exec: PullPolicy determines when the exec's image is pulled:
+	// PullIfNotPresent (the default) pulls it only if it is not
+	// already present; PullAlways pulls it even if it is present, for
+	// example to pick up a re-pushed tag; and PullNever never pulls
+	// it, failing the exec if the image is not present.
+	PullPolicy PullPolicy `json:",omitempty"`
+
+	// exec: Platform is the platform of the exec's image, as
+	// "os/arch" or "os/arch/variant" (e.g., "linux/arm64"). The image
+	// is pulled for this platform, and the exec fails if the image
+	// present is for another. If empty, the executor's default
+	// platform is used.
+	Platform string `json:",omitempty"`
+
+	// exec: NoProfile disables the profiling of the exec's resource
+	// usage, which avoids the overhead of the background samplers for
+	// short-lived execs. The exec's profile and gauges are then empty.
+	NoProfile bool `json:",omitempty"`
+
+	// exec: NoInit disables the init process that is otherwise run as
+	// the container's PID 1 (as by docker run --init) to reap the
+	// exec's orphaned child processes. Without an init, commands that
+	// do not reap their children accumulate zombie processes.
+	NoInit bool `json:",omitempty"`
+
+	// exec: ShmSize is the size, in bytes, of the exec container's
+	// /dev/shm. If zero, the executor's default is used; Docker's own
+	// default is 64MB.
+	ShmSize int64 `json:",omitempty"`
+
+	// exec: PidsLimit is the maximum number of processes that may run
+	// in the exec's container at once. Process creation beyond the
+	// limit fails within the container, which protects the host from
+	// runaway forks. If zero, the executor's default is used.
+	PidsLimit int64 `json:",omitempty"`
+
+	// exec: Umask is the file mode creation mask, in octal (e.g.,
+	// "0022"), with which the exec's command is run, so that the
+	// modes of its output files are predictable. If empty, the
+	// executor's default is used, or else the image's. The command is
+	// run as the executor's (non-root) user, so the umask determines
+	// the access of other users to the outputs. The umask does not
+	// apply to the exec's Wrapper.
+	Umask string `json:",omitempty"`
+
+	// exec: Hostname is the hostname of the exec's container. If
+	// empty, Docker's default is used. A fixed hostname lets tools
+	// that are licensed per host run in different containers.
+	Hostname string `json:",omitempty"`
+
+	// exec: Runtime is the name of the Docker (OCI) runtime with which
+	// the exec's container is run, e.g., "runsc" for gVisor. The
+	// runtime must be registered with the executor's Docker daemon.
+	// If empty, the executor's default runtime is used.
+	Runtime string `json:",omitempty"`
+
 	// exec: the set of arguments (one per %s in Cmd) passed to the command
 	// extern: the single argument which is to be exported
 	Args []Arg
@@ -100,6 +238,26 @@ type ExecConfig struct {
 	// exec: the resource requirements for the exec
 	Resources
 
+	// exec: ResourceHint, if non-nil, computes resource requirements
+	// from the total size, in bytes, of the exec's input arguments. It
+	// is evaluated when the exec is Put to an executor, which raises
+	// the exec's Resources to at least the hinted amounts. Since
+	// functions cannot be serialized, ResourceHint is honored only by
+	// executors in the same process; the resources of an exec are
+	// otherwise accounted for, by pools and schedulers, before the
+	// hint is applied.
+	ResourceHint func(inputSize int64) Resources `json:"-"`
+
+	// exec: Limits are optional resource limits for the exec,
+	// distinguishing the resources an exec requests (Resources) from
+	// those it may use. Admission, and all pool and scheduler
+	// accounting, uses the requested Resources only; execs are
+	// therefore oversubscribed when they use more than they request.
+	// Limits are enforced by Docker: "mem" caps the container's memory
+	// and "cpu" its CPU quota. A limit must be at least the requested
+	// amount; resources without a limit are enforced as before.
+	Limits Resources `json:",omitempty"`
+
 	// NeedAWSCreds indicates the exec needs AWS credentials defined in
 	// its environment: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
 	// AWS_SESSION_TOKEN will be available with the user's default
@@ -109,6 +267,250 @@ type ExecConfig struct {
 	// OutputIsDir tells whether an output argument (by index)
 	// is a directory.
 	OutputIsDir []bool `json:",omitempty"`
+
+	// exec: OutputMode determines whether the exec's sole output,
+	// $out, is a file (OutputFile, the default) or a directory
+	// (OutputDir). In OutputDir mode, $out is created as a directory
+	// before the exec is run, and every file under it is included in
+	// the exec's fileset, keyed by its path relative to $out.
+	// OutputMode does not apply to execs with multiple outputs, whose
+	// directories are given by OutputIsDir.
+	OutputMode OutputMode `json:",omitempty"`
+
+	// Labels are arbitrary key-value pairs attached to the exec. They
+	// do not affect how the exec is run, but may be used to select
+	// execs, e.g., for garbage collection by local executors.
+	Labels map[string]string `json:",omitempty"`
+
+	// After lists the IDs of execs that must complete before this
+	// exec is started. The prerequisites must have been put to the
+	// same executor before this exec is. Until they complete, the
+	// exec is held, unstarted; if any of them fails, so does the
+	// exec, unless AfterFailure is set.
+	After []digest.Digest `json:",omitempty"`
+
+	// AfterFailure starts the exec once its prerequisites (After)
+	// are complete, regardless of whether they succeeded.
+	AfterFailure bool `json:",omitempty"`
+
+	// intern: Decompress indicates that interned files compressed with
+	// a supported codec (gzip, bzip2), as detected by their magic
+	// bytes, are transparently decompressed. The resulting files are
+	// digested by their decompressed contents. Files that cannot be
+	// decoded are installed as they are; files compressed with an
+	// unsupported codec (zstd) fail the intern with an
+	// errors.NotSupported error.
+	Decompress bool `json:",omitempty"`
+
+	// intern: FilenamePolicy determines how interned files whose
+	// names are not valid UTF-8, or contain control characters, are
+	// handled: FilenameKeep (the default) keeps them as they are;
+	// FilenameReject fails the intern; and FilenameEscape escapes
+	// them, so that they are preserved by the JSON encoding of the
+	// resulting fileset.
+	FilenamePolicy FilenamePolicy `json:",omitempty"`
+
+	// extern: StorageClass is the storage class with which externed
+	// objects are stored, e.g., "STANDARD_IA" or "GLACIER" for S3.
+	// If empty, the destination's default storage class is used.
+	StorageClass string `json:",omitempty"`
+
+	// extern: ExternMD5 computes the MD5 checksum of each externed
+	// file. The checksum is attached to the externed object as
+	// metadata (under the key "md5"), so that consumers outside of
+	// Reflow may verify its integrity, and is recorded in the files
+	// of the result fileset.
+	ExternMD5 bool `json:",omitempty"`
+
+	// extern: ExternSkipExisting makes the extern idempotent: files
+	// whose destination object already exists with the same size and
+	// content digest (as recorded in the object's metadata by previous
+	// externs) are not uploaded again. Re-running an extern that
+	// failed partway through thus uploads only the files that are
+	// missing or have changed. Skipped objects retain their existing
+	// metadata and storage class.
+	ExternSkipExisting bool `json:",omitempty"`
+
+	// extern: ExternTar externs the fileset as a single tar archive,
+	// written to the object named by the URL, instead of as one object
+	// per file. The archive is deterministic: its entries are ordered
+	// by path and carry fixed metadata, so that the same fileset
+	// always produces the same object. The result fileset records the
+	// archive itself, under ".". A single-file fileset is archived
+	// under the object's base name, less any ".tar" extension.
+	ExternTar bool `json:",omitempty"`
+
+	// exec: RequireOutput causes the exec to fail if it completes
+	// without writing anything to $out (or, for execs with multiple
+	// outputs, to any one of them). By default, such execs silently
+	// produce empty filesets.
+	RequireOutput bool `json:",omitempty"`
+
+	// exec: OutputFilter lists glob patterns (see path.Match) of
+	// files that are dropped from the exec's output directories
+	// before they are installed, so that temporary artifacts left
+	// there are neither digested nor part of the result. Patterns that
+	// contain a slash are matched against a file's path relative to
+	// its output directory; others are matched against its base name.
+	// OutputFilter does not apply to outputs that are single files.
+	OutputFilter []string `json:",omitempty"`
+
+	// exec: SalvageOutputs causes the outputs that a failed exec has
+	// written before it failed to be installed into a partial fileset
+	// (see Result.Partial and Result.Missing) alongside its error, so
+	// that its partial work may be recovered.
+	SalvageOutputs bool `json:",omitempty"`
+
+	// exec: LazyDigests defers the digesting of the exec's output
+	// files, so that their sizes are available as soon as the exec
+	// completes. Until the exec is promoted, its result contains
+	// reference files (without IDs) that carry each file's size and a
+	// localfile Source naming its location; the files are digested,
+	// and the result resolved, when the exec is promoted; calls to
+	// Result then return the resolved result. Since
+	// evaluators use results before promoting execs, this is intended
+	// for clients that drive executors directly.
+	LazyDigests bool `json:",omitempty"`
+
+	// MaxOutputFiles is the maximum number of files an exec may
+	// produce across all of its outputs. If the limit is exceeded, the
+	// exec fails without digesting the remaining files. Zero means no limit.
+	MaxOutputFiles int `json:",omitempty"`
+
+	// MaxOutputBytes is the maximum total size, in bytes, of the files
+	// an exec may produce across all of its outputs. Zero means no limit.
+	MaxOutputBytes int64 `json:",omitempty"`
+
+	// intern: MaxFiles is the maximum number of files that may be
+	// interned. Interns of trees that exceed the limit fail before
+	// their files are digested (localfile) or downloaded (S3).
+	// Zero means no limit.
+	MaxFiles int `json:",omitempty"`
+
+	// intern: MaxTotalBytes is the maximum total size, in bytes, of
+	// the files that may be interned; it is enforced as MaxFiles.
+	// Zero means no limit.
+	MaxTotalBytes int64 `json:",omitempty"`
+
+	// exec: MemoryRetryFactor, if greater than 1, causes an exec that
+	// is killed by the OOM killer to be transparently re-run with its
+	// memory requirement scaled by this factor. Retries continue until
+	// the exec completes without an OOM or the memory requirement
+	// would exceed MemoryRetryMax.
+	MemoryRetryFactor float64 `json:",omitempty"`
+
+	// exec: MemoryRetryMax is the maximum amount of memory (in bytes)
+	// with which an exec is retried. If zero, the executor's total
+	// memory is used.
+	MemoryRetryMax float64 `json:",omitempty"`
+
+	// exec: MemoryRetryKeepTmp preserves the exec's $tmp across the
+	// retries of MemoryRetryFactor. By default, each attempt starts
+	// with an empty $tmp, which guarantees that it is not affected by
+	// the partial work of the attempt before it. Preserving $tmp lets
+	// tools that checkpoint their work there resume it instead, at
+	// the risk of resuming from state left inconsistent by the OOM
+	// kill; it also keeps the previous attempt's disk usage. A tmpfs
+	// $tmp (TmpfsOptions) cannot be preserved.
+	MemoryRetryKeepTmp bool `json:",omitempty"`
+}
+
+// PullPolicy determines when an exec's image is pulled. Its values
+// mirror Kubernetes' image pull policies.
+type PullPolicy string
+
+const (
+	// PullIfNotPresent pulls an image only if it is not present.
+	// The empty pull policy is PullIfNotPresent.
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	// PullAlways pulls an image even if it is present.
+	PullAlways PullPolicy = "Always"
+	// PullNever never pulls an image.
+	PullNever PullPolicy = "Never"
+)
+
+// Valid tells whether p is a known pull policy.
+func (p PullPolicy) Valid() bool {
+	switch p {
+	case "", PullIfNotPresent, PullAlways, PullNever:
+		return true
+	}
+	return false
+}
+
+// OutputMode determines whether an exec's $out is a file or a
+// directory.
+type OutputMode string
+
+const (
+	// OutputFile makes $out a file, which the exec creates.
+	// The empty output mode is OutputFile.
+	OutputFile OutputMode = "File"
+	// OutputDir makes $out a directory, which the executor creates.
+	OutputDir OutputMode = "Dir"
+)
+
+// Valid tells whether m is a known output mode.
+func (m OutputMode) Valid() bool {
+	switch m {
+	case "", OutputFile, OutputDir:
+		return true
+	}
+	return false
+}
+
+// FilenamePolicy determines how an intern handles the names of files
+// that are not valid UTF-8, or that contain control characters.
+// Such names are not preserved by the JSON encoding of filesets.
+type FilenamePolicy string
+
+const (
+	// FilenameKeep keeps such names as they are. The empty filename
+	// policy is FilenameKeep.
+	FilenameKeep FilenamePolicy = "Keep"
+	// FilenameReject fails an intern that encounters such names.
+	FilenameReject FilenamePolicy = "Reject"
+	// FilenameEscape escapes the offending bytes of such names as
+	// in URLs: each is replaced by "%XX", where XX is its value in
+	// (uppercase) hexadecimal.
+	FilenameEscape FilenamePolicy = "Escape"
+)
+
+// Valid tells whether p is a known filename policy.
+func (p FilenamePolicy) Valid() bool {
+	switch p {
+	case "", FilenameKeep, FilenameReject, FilenameEscape:
+		return true
+	}
+	return false
+}
+
+// TmpfsOptions specifies the mount options of a tmpfs-backed $tmp.
+type TmpfsOptions struct {
+	// Size is the maximum size of the filesystem, in bytes.
+	// Zero means the Docker default.
+	Size int64 `json:",omitempty"`
+	// Mode is the (octal, Unix) permission mode of the filesystem's
+	// root directory, e.g., 01777. Zero means the Docker default.
+	Mode uint32 `json:",omitempty"`
+	// NoExec disallows the execution of binaries in the filesystem.
+	NoExec bool `json:",omitempty"`
+}
+
+// String returns the mount options in Docker's (mount(8)) format,
+// e.g., "rw,noexec,size=1073741824,mode=1777".
+func (o TmpfsOptions) String() string {
+	opts := []string{"rw"}
+	if o.NoExec {
+		opts = append(opts, "noexec")
+	}
+	if o.Size > 0 {
+		opts = append(opts, fmt.Sprintf("size=%d", o.Size))
+	}
+	if o.Mode != 0 {
+		opts = append(opts, fmt.Sprintf("mode=%o", o.Mode))
+	}
+	return strings.Join(opts, ",")
 }
 
 func (e ExecConfig) String() string {
@@ -126,12 +528,130 @@ func (e ExecConfig) String() string {
 			}
 		}
 		s += fmt.Sprintf(" image %s cmd %q args [%s]", e.Image, e.Cmd, strings.Join(args, ", "))
+		if len(e.Wrapper) > 0 {
+			s += fmt.Sprintf(" wrapper %q", e.Wrapper)
+		}
+		if len(e.Limits) > 0 {
+			s += fmt.Sprintf(" limits %s", e.Limits)
+		}
+		if e.TmpfsOptions != nil {
+			s += fmt.Sprintf(" tmpfs %s", e.TmpfsOptions)
+		}
+		if e.OutputTmpfs {
+			s += " outputtmpfs"
+		}
+		if e.MergeStderr {
+			s += " mergestderr"
+		}
+		if e.TmpLog {
+			s += " tmplog"
+		}
+		if e.PullPolicy != "" {
+			s += fmt.Sprintf(" pull %s", e.PullPolicy)
+		}
+		if e.Platform != "" {
+			s += fmt.Sprintf(" platform %s", e.Platform)
+		}
+		if e.OutputMode != "" {
+			s += fmt.Sprintf(" outputmode %s", e.OutputMode)
+		}
+		if e.NoProfile {
+			s += " noprofile"
+		}
+		if e.NoInit {
+			s += " noinit"
+		}
+		if e.ShmSize > 0 {
+			s += fmt.Sprintf(" shm %s", data.Size(e.ShmSize))
+		}
+		if e.PidsLimit > 0 {
+			s += fmt.Sprintf(" pidslimit %d", e.PidsLimit)
+		}
+		if e.Umask != "" {
+			s += fmt.Sprintf(" umask %s", e.Umask)
+		}
+		if e.Hostname != "" {
+			s += fmt.Sprintf(" hostname %s", e.Hostname)
+		}
+		if len(e.CapAdd) > 0 {
+			s += fmt.Sprintf(" capadd %s", strings.Join(e.CapAdd, ","))
+		}
+		if len(e.CapDrop) > 0 {
+			s += fmt.Sprintf(" capdrop %s", strings.Join(e.CapDrop, ","))
+		}
+		if e.RequireOutput {
+			s += " requireoutput"
+		}
+		if len(e.OutputFilter) > 0 {
+			s += fmt.Sprintf(" outputfilter %s", strings.Join(e.OutputFilter, ","))
+		}
+		if e.SalvageOutputs {
+			s += " salvageoutputs"
+		}
+		if e.Runtime != "" {
+			s += fmt.Sprintf(" runtime %s", e.Runtime)
+		}
 	}
 	s += fmt.Sprintf(" resources %s", e.Resources)
 	return s
 }
 
+// Digest returns a canonical ID for an exec with config e and the
+// provided (additional) inputs. Execs with equal digests compute the
+// same result: the digest covers the config's fields, with its
+// arguments' filesets represented by their digests, as well as the
+// digests of the inputs. Fields that only determine how an exec is
+// scheduled, observed, or retried, and not what it computes, are
+// excluded: Ident, OriginalImage, Resources, ResourceHint, Limits,
+// Labels, After, AfterFailure, NoProfile, PullPolicy, and the
+// MemoryRetry fields. Digest is meaningful only for resolved
+// configs, i.e., those whose Image names an image by digest.
+func (e ExecConfig) Digest(inputs ...Fileset) digest.Digest {
+	c := e
+	c.Ident = ""
+	c.OriginalImage = ""
+	c.Resources = nil
+	c.ResourceHint = nil
+	c.Limits = nil
+	c.Labels = nil
+	c.After = nil
+	c.AfterFailure = false
+	c.NoProfile = false
+	c.PullPolicy = ""
+	c.MemoryRetryFactor = 0
+	c.MemoryRetryMax = 0
+	c.MemoryRetryKeepTmp = false
+	c.Args = nil
+	w := Digester.NewWriter()
+	// Configs always marshal: they contain no channels, functions
+	// (ResourceHint is excluded), or cyclic values.
+	b, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	w.Write(b)
+	for _, arg := range e.Args {
+		if arg.Out {
+			fmt.Fprintf(w, "out %d", arg.Index)
+		} else {
+			io.WriteString(w, "in ")
+			if arg.Fileset != nil {
+				digest.WriteDigest(w, arg.Fileset.Digest())
+			}
+		}
+	}
+	for _, fs := range inputs {
+		io.WriteString(w, "input ")
+		digest.WriteDigest(w, fs.Digest())
+	}
+	return w.Digest()
+}
+
 // Profile stores keyed statistical summaries (currently: mean, max, N).
+// First and Last are the wall-clock times of the first and last
+// samples; executors may derive Last from a monotonic clock, so that
+// Last-First is the duration of the profile even if the wall clock was
+// stepped while profiling.
 type Profile map[string]struct {
 	Max, Mean, Var float64
 	N              int64
@@ -154,6 +674,57 @@ func (p Profile) String() string {
 	return b.String()
 }
 
+// ProfileDelta describes the change in a single profiled resource
+// between two profiles.
+type ProfileDelta struct {
+	// Old and New tell whether the resource was observed in the
+	// first and second profile, respectively.
+	Old, New bool
+	// MeanChange and MaxChange are the percent changes of the
+	// resource's mean and maximum from the first profile to the
+	// second. They are NaN when the change is undefined, e.g., when
+	// the resource was not observed in one of the profiles, or its
+	// original value was zero.
+	MeanChange, MaxChange float64
+}
+
+// Compare returns the per-resource changes from profile p to
+// profile q. Resources present in only one of the profiles are
+// included, with undefined (NaN) changes.
+func (p Profile) Compare(q Profile) map[string]ProfileDelta {
+	deltas := make(map[string]ProfileDelta)
+	for k := range p {
+		deltas[k] = ProfileDelta{}
+	}
+	for k := range q {
+		deltas[k] = ProfileDelta{}
+	}
+	for k := range deltas {
+		var (
+			d      ProfileDelta
+			pk, ok = p[k]
+		)
+		d.Old = ok && pk.N > 0
+		qk, ok := q[k]
+		d.New = ok && qk.N > 0
+		d.MeanChange, d.MaxChange = math.NaN(), math.NaN()
+		if d.Old && d.New {
+			d.MeanChange = percentChange(pk.Mean, qk.Mean)
+			d.MaxChange = percentChange(pk.Max, qk.Max)
+		}
+		deltas[k] = d
+	}
+	return deltas
+}
+
+// percentChange returns the percent change from x to y, or NaN if x is zero.
+func percentChange(x, y float64) float64 {
+	if x == 0 {
+		return math.NaN()
+	}
+	return 100 * (y - x) / x
+}
+
 // Gauges stores a set of named gauges.
 type Gauges map[string]float64
 
@@ -173,6 +744,13 @@ type ExecInspect struct {
 	State   string        // "created", "waiting", "running", .., "zombie"
 	Status  string        // human readable status
 	Error   *errors.Error `json:",omitempty"` // non-nil runtime on error
+
+	// Profile summarizes the exec's resource usage over its lifetime.
+	// Docker execs profile "cpu" and "mem"; "tmp" and "out", the sizes
+	// of the exec's $tmp and output directories; and "disk", the disk
+	// usage accounted against the exec's resources (currently that of
+	// its outputs). Executors that profile GPUs also profile "gpu"
+	// and "gpumem", the GPU utilization and memory of the exec.
 	Profile Profile
 
 	// Gauges are used to export realtime exec stats. They are used only
@@ -184,6 +762,70 @@ type ExecInspect struct {
 	Docker types.ContainerJSON
 	// ExecError stores exec result errors.
 	ExecError *errors.Error `json:",omitempty"`
+	// Attempts is the number of times the exec was run; it is greater
+	// than 1 only when the exec was retried with more memory.
+	Attempts int `json:",omitempty"`
+	// Memory is the amount of memory (in bytes) required by the exec's
+	// final attempt.
+	Memory float64 `json:",omitempty"`
+	// Transfer summarizes the data transferred by a completed intern
+	// or extern.
+	Transfer *TransferStats `json:",omitempty"`
+	// Limits are the resource limits in effect for the exec's
+	// container, as reported by Docker. They are available once the
+	// container has started.
+	Limits *ContainerLimits `json:",omitempty"`
+	// Version identifies the build of Reflow that ran the exec, if
+	// known.
+	Version string `json:",omitempty"`
+	// Cached tells whether the exec's result was retrieved from cache
+	// rather than computed, in which case no resources were spent
+	// producing it.
+	Cached bool `json:",omitempty"`
+	// Warnings describe problems with the exec that did not (by
+	// themselves) fail it, e.g., disk usage that exceeded the exec's
+	// disk resource.
+	Warnings []string `json:",omitempty"`
+}
+
+// ContainerLimits are the resource limits applied to an exec's
+// container. Zero values denote the absence of a limit.
+type ContainerLimits struct {
+	// Memory is the container's memory limit, in bytes.
+	Memory int64
+	// MemorySwap is the container's limit on memory and swap
+	// combined, in bytes.
+	MemorySwap int64
+	// NanoCPUs is the container's CPU quota, in units of 1e-9 CPUs.
+	NanoCPUs int64
+	// PidsLimit is the maximum number of processes in the container.
+	PidsLimit int64
+}
+
+// TransferStats summarizes the data transferred by an intern or
+// extern.
+type TransferStats struct {
+	// Direction is the direction of the transfer: "download" for
+	// interns and "upload" for externs.
+	Direction string
+	// Bytes is the number of bytes transferred.
+	Bytes int64
+	// Duration is the wall-clock time taken by the transfer.
+	Duration time.Duration
+	// Throughput is the effective throughput of the transfer, in
+	// bytes per second.
+	Throughput float64
+}
+
+// String returns a human-readable summary of the transfer.
+func (s TransferStats) String() string {
+	return fmt.Sprintf("%s %s in %s (%s/s)", s.Direction, data.Size(s.Bytes), s.Duration, data.Size(int64(s.Throughput)))
+}
+
+// CompareProfile returns the per-resource profile changes from
+// inspect e to inspect f. See Profile.Compare.
+func (e ExecInspect) CompareProfile(f ExecInspect) map[string]ProfileDelta {
+	return e.Profile.Compare(f.Profile)
 }
 
 // Runtime computes the exec's runtime based on Docker's timestamps.
@@ -5,6 +5,7 @@
 package reflow_test
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -87,3 +88,87 @@ func TestRuntime(t *testing.T) {
 		}
 	}
 }
+
+func TestProfileCompare(t *testing.T) {
+	set := func(p reflow.Profile, key string, mean, max float64) {
+		v := p[key]
+		v.Mean, v.Max, v.N = mean, max, 1
+		p[key] = v
+	}
+	p, q := make(reflow.Profile), make(reflow.Profile)
+	set(p, "mem", 10, 20)
+	set(q, "mem", 20, 10)
+	set(p, "cpu", 0, 2)
+	set(q, "cpu", 1, 3)
+	set(p, "tmp", 1, 1)
+	set(q, "disk", 1, 1)
+	deltas := p.Compare(q)
+	if got, want := len(deltas), 4; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if d := deltas["mem"]; !d.Old || !d.New || d.MeanChange != 100 || d.MaxChange != -50 {
+		t.Errorf("mem: got %+v", d)
+	}
+	if d := deltas["cpu"]; !math.IsNaN(d.MeanChange) || d.MaxChange != 50 {
+		t.Errorf("cpu: got %+v", d)
+	}
+	if d := deltas["tmp"]; !d.Old || d.New || !math.IsNaN(d.MeanChange) || !math.IsNaN(d.MaxChange) {
+		t.Errorf("tmp: got %+v", d)
+	}
+	if d := deltas["disk"]; d.Old || !d.New || !math.IsNaN(d.MeanChange) || !math.IsNaN(d.MaxChange) {
+		t.Errorf("disk: got %+v", d)
+	}
+}
+
+func TestTmpfsOptions(t *testing.T) {
+	for _, c := range []struct {
+		opts reflow.TmpfsOptions
+		want string
+	}{
+		{reflow.TmpfsOptions{}, "rw"},
+		{reflow.TmpfsOptions{NoExec: true}, "rw,noexec"},
+		{reflow.TmpfsOptions{Size: 1 << 30, Mode: 01777}, "rw,size=1073741824,mode=1777"},
+		{reflow.TmpfsOptions{Size: 1 << 20, Mode: 0700, NoExec: true}, "rw,noexec,size=1048576,mode=700"},
+	} {
+		if got, want := c.opts.String(), c.want; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestExecConfigDigest(t *testing.T) {
+	var (
+		a = reflow.Fileset{Map: map[string]reflow.File{".": {ID: reflow.Digester.FromString("a"), Size: 1}}}
+		b = reflow.Fileset{Map: map[string]reflow.File{".": {ID: reflow.Digester.FromString("b"), Size: 1}}}
+	)
+	cfg := reflow.ExecConfig{
+		Type:  "exec",
+		Image: "ubuntu@sha256:0000",
+		Cmd:   "cat {{arg[0][0]}} > $out",
+		Args:  []reflow.Arg{{Fileset: &reflow.Fileset{List: []reflow.Fileset{a}}}, {Out: true}},
+	}
+	d := cfg.Digest()
+	if got := cfg.Digest(); got != d {
+		t.Errorf("digest is not deterministic: %v != %v", got, d)
+	}
+	other := cfg
+	other.Args = []reflow.Arg{{Fileset: &reflow.Fileset{List: []reflow.Fileset{b}}}, {Out: true}}
+	if other.Digest() == d {
+		t.Error("execs with different arguments have the same digest")
+	}
+	if cfg.Digest(a) == d || cfg.Digest(a) == cfg.Digest(b) {
+		t.Error("execs with different inputs have the same digest")
+	}
+	other = cfg
+	other.Cmd = "true"
+	if other.Digest() == d {
+		t.Error("execs with different commands have the same digest")
+	}
+	other = cfg
+	other.Ident = "cat"
+	other.Resources = reflow.Resources{"mem": 1 << 30}
+	other.Labels = map[string]string{"team": "prod"}
+	if got := other.Digest(); got != d {
+		t.Errorf("scheduling fields changed digest: %v != %v", got, d)
+	}
+}
@@ -6,6 +6,7 @@ package reflow
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"sort"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/errors"
 )
 
 // File represents a File inside of Reflow. A file is said to be
@@ -30,12 +32,31 @@ type File struct {
 	Size int64
 
 	// Source stores a URL for the file from which it may
-	// be retrieved.
+	// be retrieved. For interned files, Source records the
+	// file's provenance: the URL from which it was interned.
 	Source string `json:",omitempty"`
 
 	// ETag stores an optional entity tag for the Source file.
 	ETag string `json:",omitempty"`
 
+	// MD5 is an optional, hex-encoded MD5 checksum of the file's
+	// contents. It is a secondary checksum for consumers outside of
+	// Reflow, and is computed only on request (see
+	// ExecConfig.ExternMD5); it does not contribute to the file's
+	// digest.
+	MD5 string `json:",omitempty"`
+
+	// BlockDigest is set for files that are named by their block
+	// (tree) digest instead of the flat digest of their contents, and
+	// is then equal to ID. Block digests are computed over blocks of
+	// BlockSize bytes (see filerepo.BlockDigest), and can thus be
+	// computed and verified in parallel. It does not contribute to
+	// the file's digest.
+	BlockDigest digest.Digest `json:",omitempty"`
+
+	// BlockSize is the block size with which BlockDigest was computed.
+	BlockSize int64 `json:",omitempty"`
+
 	// LastModified stores the file's last modified time.
 	LastModified time.Time `json:",omitempty"`
 
@@ -251,6 +272,57 @@ func (v Fileset) N() int {
 	return n
 }
 
+// Validate checks that the fileset is well-formed: each path is
+// nonempty and contains no ".." elements, each file is either
+// resolved (it has a nonzero ID) or is a reference with a source,
+// and no file has a negative size. Validate returns an errors.Invalid
+// error describing the first violation, visiting lists in order and
+// maps in path order.
+func (v Fileset) Validate() error {
+	return v.validate("")
+}
+
+func (v Fileset) validate(where string) error {
+	for i := range v.List {
+		if err := v.List[i].validate(fmt.Sprintf("%s[%d]", where, i)); err != nil {
+			return err
+		}
+	}
+	paths := make([]string, 0, len(v.Map))
+	for path := range v.Map {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var msg string
+		file := v.Map[path]
+		switch {
+		case path == "":
+			msg = "empty path"
+		case hasDotDot(path):
+			msg = `path contains ".."`
+		case file.IsRef() && file.Source == "":
+			msg = "file has neither a digest nor a source"
+		case file.Size < 0:
+			msg = fmt.Sprintf("negative size %d", file.Size)
+		default:
+			continue
+		}
+		return errors.E(errors.Invalid, errors.Errorf("fileset%s: %q: %s", where, path, msg))
+	}
+	return nil
+}
+
+// hasDotDot tells whether the slash-separated path has a ".." element.
+func hasDotDot(path string) bool {
+	for _, elem := range strings.Split(path, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
 // Size returns the total size of this value.
 func (v Fileset) Size() int64 {
 	var s int64
@@ -413,6 +485,56 @@ func (v Fileset) WriteDigest(w io.Writer) {
 	}
 }
 
+// MarshalCanonical returns a canonical JSON serialization of the
+// fileset: two filesets with the same structure, paths, and files
+// always serialize to identical bytes, regardless of how they were
+// constructed. Paths are serialized in sorted order and file
+// timestamps are normalized to UTC.
+func (v Fileset) MarshalCanonical() ([]byte, error) {
+	// Package encoding/json sorts map keys; we need only to
+	// normalize values whose serialization is not canonical.
+	return json.Marshal(v.canonical())
+}
+
+// WriteJSON writes the fileset's canonical JSON serialization (see
+// MarshalCanonical), followed by a newline, to w. Filesets written by
+// WriteJSON are read by ReadFileset.
+func (v Fileset) WriteJSON(w io.Writer) error {
+	b, err := v.MarshalCanonical()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ReadFileset reads a fileset serialized by Fileset.WriteJSON from r.
+func ReadFileset(r io.Reader) (Fileset, error) {
+	var v Fileset
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return Fileset{}, errors.E(errors.Invalid, "read fileset", err)
+	}
+	return v, nil
+}
+
+func (v Fileset) canonical() Fileset {
+	var c Fileset
+	if v.List != nil {
+		c.List = make([]Fileset, len(v.List))
+		for i := range v.List {
+			c.List[i] = v.List[i].canonical()
+		}
+	}
+	if v.Map != nil {
+		c.Map = make(map[string]File, len(v.Map))
+		for path, file := range v.Map {
+			file.LastModified = file.LastModified.UTC()
+			c.Map[path] = file
+		}
+	}
+	return c
+}
+
 // Pullup merges this value (tree) into a single toplevel fileset.
 func (v Fileset) Pullup() Fileset {
 	if v.List == nil {
@@ -432,6 +554,44 @@ func (v Fileset) pullup(m map[string]File) {
 	}
 }
 
+// Rename returns a copy of this value in which each path is replaced
+// by rename(path). The structure of the value is preserved: paths
+// are renamed within each of the value's maps. Rename returns an
+// errors.Invalid error if two paths in the same map are renamed to
+// the same path.
+func (v Fileset) Rename(rename func(path string) string) (Fileset, error) {
+	var w Fileset
+	if v.List != nil {
+		w.List = make([]Fileset, len(v.List))
+		for i := range v.List {
+			var err error
+			if w.List[i], err = v.List[i].Rename(rename); err != nil {
+				return Fileset{}, err
+			}
+		}
+	}
+	if v.Map != nil {
+		w.Map = make(map[string]File, len(v.Map))
+		// Rename in path order so that errors are deterministic.
+		paths := make([]string, 0, len(v.Map))
+		for path := range v.Map {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		renamed := make(map[string]string, len(paths))
+		for _, path := range paths {
+			newpath := rename(path)
+			if prev, ok := renamed[newpath]; ok {
+				return Fileset{}, errors.E(errors.Invalid,
+					errors.Errorf("rename: %q and %q are both renamed to %q", prev, path, newpath))
+			}
+			renamed[newpath] = path
+			w.Map[newpath] = v.Map[path]
+		}
+	}
+	return w, nil
+}
+
 // Diff deep-compares the values two filesets assuming they have the same structure
 // and returns a pretty-diff of the differences (if any) and a boolean if they are different.
 func (v Fileset) Diff(w Fileset) (string, bool) {
@@ -8,14 +8,17 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/rand"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"encoding/json"
 
 	"github.com/grailbio/base/digest"
 	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/test/testutil"
 )
 
@@ -452,3 +455,156 @@ func BenchmarkUnmarshal(b *testing.B) {
 		}
 	}
 }
+
+// shuffle returns a deep copy of fs whose maps are populated in a
+// random order and whose timestamps are in a random location.
+func shuffle(r *rand.Rand, fs reflow.Fileset) reflow.Fileset {
+	var c reflow.Fileset
+	if fs.List != nil {
+		c.List = make([]reflow.Fileset, len(fs.List))
+		for i := range fs.List {
+			c.List[i] = shuffle(r, fs.List[i])
+		}
+	}
+	if fs.Map != nil {
+		paths := make([]string, 0, len(fs.Map))
+		for path := range fs.Map {
+			paths = append(paths, path)
+		}
+		r.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+		c.Map = make(map[string]reflow.File)
+		for _, path := range paths {
+			file := fs.Map[path]
+			loc := time.FixedZone("", (r.Intn(24)-12)*3600)
+			file.LastModified = file.LastModified.In(loc)
+			c.Map[path] = file
+		}
+	}
+	return c
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	const N = 100
+	var (
+		r    = rand.New(rand.NewSource(0))
+		fuzz = testutil.NewFuzz(r)
+	)
+	for _, aok := range []bool{true, false} {
+		for i := 0; i < N; i++ {
+			fs := fuzz.Fileset(true, aok)
+			want, err := fs.MarshalCanonical()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := 0; j < 10; j++ {
+				got, err := shuffle(r, fs).MarshalCanonical()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("got %s, want %s", got, want)
+				}
+			}
+			var newFs reflow.Fileset
+			if err := json.Unmarshal(want, &newFs); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := newFs, fs; !got.Equal(want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestWriteReadJSON(t *testing.T) {
+	const N = 100
+	var (
+		r    = rand.New(rand.NewSource(0))
+		fuzz = testutil.NewFuzz(r)
+	)
+	for _, aok := range []bool{true, false} {
+		for i := 0; i < N; i++ {
+			fs := fuzz.Fileset(true, aok)
+			var b bytes.Buffer
+			if err := fs.WriteJSON(&b); err != nil {
+				t.Fatal(err)
+			}
+			want := append([]byte{}, b.Bytes()...)
+			got, err := reflow.ReadFileset(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(fs) {
+				t.Errorf("got %v, want %v", got, fs)
+			}
+			if got, want := got.Digest(), fs.Digest(); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			b.Reset()
+			if err := got.WriteJSON(&b); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("got %s, want %s", b.Bytes(), want)
+			}
+		}
+	}
+	if _, err := reflow.ReadFileset(strings.NewReader("{")); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ref := reflow.File{Source: "s3://bucket/key", ETag: "etag", Size: 10}
+	for _, c := range []struct {
+		fs   reflow.Fileset
+		want string // substring of the error, or empty if valid
+	}{
+		{vlist, ""},
+		{reflow.Fileset{Map: map[string]reflow.File{".": file1, "ref": ref}}, ""},
+		{reflow.Fileset{Map: map[string]reflow.File{"": file1}}, "empty path"},
+		{reflow.Fileset{Map: map[string]reflow.File{"a/../b": file1}}, `".."`},
+		{reflow.Fileset{Map: map[string]reflow.File{"..": file1}}, `".."`},
+		{reflow.Fileset{Map: map[string]reflow.File{"a": {Size: 1}}}, "neither a digest nor a source"},
+		{reflow.Fileset{Map: map[string]reflow.File{"a": {ID: file1.ID, Size: -1}}}, "negative size"},
+		{reflow.Fileset{List: []reflow.Fileset{fs1, {Map: map[string]reflow.File{"": file1}}}}, "fileset[1]"},
+		// The first violation, in path order, is reported.
+		{reflow.Fileset{Map: map[string]reflow.File{"b": {Size: 1}, "a": {ID: file1.ID, Size: -1}}}, `"a"`},
+	} {
+		err := c.fs.Validate()
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%v: unexpected error %v", c.fs, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%v: got %v, want error containing %q", c.fs, err, c.want)
+		case c.want != "" && !errors.Is(errors.Invalid, err):
+			t.Errorf("%v: expected invalid error, got %v", c.fs, err)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	a, b := reflow.File{ID: reflow.Digester.FromString("a")}, reflow.File{ID: reflow.Digester.FromString("b")}
+	fs := reflow.Fileset{List: []reflow.Fileset{
+		{Map: map[string]reflow.File{"x": a, "y/z": b}},
+		{Map: map[string]reflow.File{"x": b}},
+	}}
+	got, err := fs.Rename(func(path string) string { return "ref/" + path })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := reflow.Fileset{List: []reflow.Fileset{
+		{Map: map[string]reflow.File{"ref/x": a, "ref/y/z": b}},
+		{Map: map[string]reflow.File{"ref/x": b}},
+	}}
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := fs.List[0].Map["x"]; !ok {
+		t.Error("Rename modified its receiver")
+	}
+	_, err = fs.Rename(func(string) string { return "same" })
+	if !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
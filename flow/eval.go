@@ -34,6 +34,7 @@ import (
 	"github.com/grailbio/reflow/liveset/bloomlive"
 	"github.com/grailbio/reflow/log"
 	"github.com/grailbio/reflow/pool"
+	"github.com/grailbio/reflow/repository/filerepo"
 	"github.com/grailbio/reflow/sched"
 	"github.com/grailbio/reflow/taskdb"
 	"github.com/grailbio/reflow/trace"
@@ -147,6 +148,17 @@ type EvalConfig struct {
 	// are recomputed.
 	RecomputeEmpty bool
 
+	// VerifyCache determines whether the contents of the files of
+	// cache hits are verified against their digests before they are
+	// used. This requires reading every file of every hit, so it
+	// should be enabled only for caches that are not trusted. Cache
+	// entries that fail verification are evicted and their flows are
+	// recomputed. Files are verified by their block digests (see
+	// reflow.File.BlockDigest), if they have one, in parallel by
+	// repositories that support it; other files are verified by their
+	// flat digests.
+	VerifyCache bool
+
 	// BottomUp determines whether we perform bottom-up only
 	// evaluation, skipping the top-down phase.
 	BottomUp bool
@@ -210,6 +222,9 @@ func (e EvalConfig) String() string {
 	} else {
 		flags = append(flags, "norecomputeempty")
 	}
+	if e.VerifyCache {
+		flags = append(flags, "verifycache")
+	}
 	if e.BottomUp {
 		flags = append(flags, "bottomup")
 	} else {
@@ -1583,6 +1598,31 @@ func (e *Eval) batchLookup(ctx context.Context, flows ...*Flow) {
 				e.lookupFailed(f)
 				return nil
 			}
+			// Make sure the files' contents match their digests, so that
+			// corrupt cache entries are not propagated to downstream flows.
+			if e.VerifyCache {
+				corrupt, err := corrupted(ctx, e.Repository, fs.Files()...)
+				if err != nil {
+					if err != ctx.Err() {
+						e.Log.Errorf("verify %v: %v", fs, err)
+					}
+					e.lookupFailed(f)
+					return nil
+				}
+				if len(corrupt) != 0 {
+					e.Log.Errorf("cache.Lookup flow: %s (%s): %d corrupt files; evicting %s", f.Digest().Short(), f.Ident, len(corrupt), fsid.Short())
+					for _, key := range keys {
+						if res, ok := batch[assoc.Key{Kind: assoc.Fileset, Digest: key}]; !ok || res.Digest != fsid {
+							continue
+						}
+						if err := assoc.Delete(ctx, e.Assoc, assoc.Fileset, key); err != nil {
+							e.Log.Errorf("assoc delete %v: %v", key, err)
+						}
+					}
+					e.lookupFailed(f)
+					return nil
+				}
+			}
 			// If the cached fileset has viable non-empty assertions, assert them.
 			if a, size := reflow.NonEmptyAssertions(fs.Assertions()...); size > 0 {
 				// Check if the assertions are internally consistent for the cached fileset.
@@ -1983,6 +2023,7 @@ func (e *Eval) Mutate(f *Flow, muts ...interface{}) {
 				e.decr(f)
 			case Cached:
 				f.Cached = true
+				f.Inspect.Cached = true
 			case Refresh:
 				refresh = true
 			case MustIntern:
@@ -2569,6 +2610,74 @@ func missing(ctx context.Context, r reflow.Repository, files ...reflow.File) ([]
 	return files, nil
 }
 
+// verifyConcurrency is the number of files whose contents are
+// verified concurrently by corrupted.
+const verifyConcurrency = 8
+
+// corrupted returns the files whose contents in the repository r
+// do not match their digests. Reference files are not checked. If r
+// implements
+//
+//	Verify(context.Context, reflow.File) error
+//
+// (e.g., filerepo.Repository, which verifies files with block digests
+// in parallel), it is used to check each file, and files for which it
+// returns an errors.Integrity error are corrupt; otherwise files are
+// read from r and their block digests, if they have one, or else their
+// flat digests compared.
+func corrupted(ctx context.Context, r reflow.Repository, files ...reflow.File) ([]reflow.File, error) {
+	type verifier interface {
+		Verify(context.Context, reflow.File) error
+	}
+	corrupt := make([]bool, len(files))
+	err := traverse.Limit(verifyConcurrency).Each(len(files), func(i int) error {
+		file := files[i]
+		if file.IsRef() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if v, ok := r.(verifier); ok {
+			err := v.Verify(ctx, file)
+			if errors.Is(errors.Integrity, err) {
+				corrupt[i] = true
+				return nil
+			}
+			return err
+		}
+		rc, err := r.Get(ctx, file.ID)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if !file.BlockDigest.IsZero() && file.BlockSize > 0 {
+			d, err := filerepo.ReadBlockDigest(rc, file.BlockSize)
+			if err != nil {
+				return err
+			}
+			corrupt[i] = d != file.BlockDigest
+			return nil
+		}
+		w := reflow.Digester.NewWriter()
+		if _, err := io.Copy(w, rc); err != nil {
+			return err
+		}
+		corrupt[i] = w.Digest() != file.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var bad []reflow.File
+	for i := range corrupt {
+		if corrupt[i] {
+			bad = append(bad, files[i])
+		}
+	}
+	return bad, nil
+}
+
 type counters [Max]map[string]int
 
 func (c *counters) Incr(state State, name string, n int) {
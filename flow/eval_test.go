@@ -9,6 +9,8 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	golog "log"
 	"math"
 	"net/url"
@@ -16,6 +18,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -285,6 +288,9 @@ func TestCacheLookup(t *testing.T) {
 	if !e.Equiv() { //no flows to be executed
 		t.Error("did not expect any flows to be executed")
 	}
+	if !extern.Inspect.Cached {
+		t.Error("expected cached inspect")
+	}
 
 	e.Init()
 	e.Repo = testutil.NewInmemoryRepository()
@@ -315,6 +321,121 @@ func TestCacheLookup(t *testing.T) {
 	}
 }
 
+// corruptRepository is an in-memory repository which returns
+// corrupt contents for a single object.
+type corruptRepository struct {
+	*testutil.InmemoryRepository
+	corrupt digest.Digest
+}
+
+func (r *corruptRepository) Get(ctx context.Context, id digest.Digest) (io.ReadCloser, error) {
+	if id == r.corrupt {
+		return ioutil.NopCloser(strings.NewReader("corrupt")), nil
+	}
+	return r.InmemoryRepository.Get(ctx, id)
+}
+
+func TestCacheLookupVerify(t *testing.T) {
+	for _, verify := range []bool{false, true} {
+		intern := op.Intern("internurl")
+		exec := op.Exec("image", "command", testutil.Resources, intern)
+		testutil.AssignExecId(nil, intern, exec)
+
+		e := testutil.Executor{Have: testutil.Resources}
+		e.Init()
+		e.Repo = testutil.NewInmemoryRepository()
+		repo := &corruptRepository{InmemoryRepository: testutil.NewInmemoryRepository()}
+		eval := flow.NewEval(exec, flow.EvalConfig{
+			Executor:    &e,
+			CacheMode:   infra.CacheRead,
+			Assoc:       testutil.NewInmemoryAssoc(),
+			Repository:  repo,
+			Transferer:  testutil.Transferer,
+			VerifyCache: verify,
+			Log:         logger(),
+			Trace:       logger(),
+		})
+		testutil.WriteCache(eval, exec.Digest(), "a", "b")
+		repo.corrupt = reflow.Digester.FromString("b")
+		rc := testutil.EvalAsync(context.Background(), eval)
+		if verify {
+			e.Ok(intern, testutil.Files("x"))
+			e.Ok(exec, testutil.Files("a", "b"))
+		}
+		r := <-rc
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if !verify {
+			if !e.Equiv() {
+				t.Error("did not expect any flows to be executed")
+			}
+			continue
+		}
+		if !e.Equiv(intern, exec) {
+			t.Error("wrong set of expected flows")
+		}
+		if testutil.Exists(eval, exec.CacheKeys()...) {
+			t.Error("expected corrupt cache entry to be evicted")
+		}
+	}
+}
+
+// verifyingRepository is an in-memory repository that verifies
+// files itself, and reports a single object as corrupt.
+type verifyingRepository struct {
+	*testutil.InmemoryRepository
+	corrupt  digest.Digest
+	verified int32
+}
+
+func (r *verifyingRepository) Verify(ctx context.Context, file reflow.File) error {
+	atomic.AddInt32(&r.verified, 1)
+	if file.ID == r.corrupt {
+		return errors.E(errors.Integrity, errors.New("corrupt"))
+	}
+	return nil
+}
+
+func TestCacheLookupVerifier(t *testing.T) {
+	intern := op.Intern("internurl")
+	exec := op.Exec("image", "command", testutil.Resources, intern)
+	testutil.AssignExecId(nil, intern, exec)
+
+	e := testutil.Executor{Have: testutil.Resources}
+	e.Init()
+	e.Repo = testutil.NewInmemoryRepository()
+	repo := &verifyingRepository{InmemoryRepository: testutil.NewInmemoryRepository()}
+	eval := flow.NewEval(exec, flow.EvalConfig{
+		Executor:    &e,
+		CacheMode:   infra.CacheRead,
+		Assoc:       testutil.NewInmemoryAssoc(),
+		Repository:  repo,
+		Transferer:  testutil.Transferer,
+		VerifyCache: true,
+		Log:         logger(),
+		Trace:       logger(),
+	})
+	testutil.WriteCache(eval, exec.Digest(), "a", "b")
+	repo.corrupt = reflow.Digester.FromString("b")
+	rc := testutil.EvalAsync(context.Background(), eval)
+	e.Ok(intern, testutil.Files("x"))
+	e.Ok(exec, testutil.Files("a", "b"))
+	r := <-rc
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if !e.Equiv(intern, exec) {
+		t.Error("wrong set of expected flows")
+	}
+	if atomic.LoadInt32(&repo.verified) == 0 {
+		t.Error("expected the repository to verify files")
+	}
+	if testutil.Exists(eval, exec.CacheKeys()...) {
+		t.Error("expected corrupt cache entry to be evicted")
+	}
+}
+
 func TestCacheLookupWithAssertions(t *testing.T) {
 	intern := op.Intern("internurl")
 	groupby := op.Groupby("(.*)", intern)
@@ -1,6 +1,7 @@
 package infra
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/grailbio/infra"
+	"github.com/grailbio/reflow/blob/httpblob"
 	"github.com/grailbio/reflow/log"
 	"github.com/grailbio/reflow/pool"
 )
@@ -28,6 +30,7 @@ func init() {
 	infra.Register("kv", new(KV))
 	infra.Register("reflowletconfig", new(ReflowletConfig))
 	infra.Register("docker", new(DockerConfig))
+	infra.Register("httptoken", new(HTTPTokenConfig))
 }
 
 // Reflow infra schema key names.
@@ -51,6 +54,7 @@ const (
 	Tracer     = "tracer"
 	TaskDB     = "taskdb"
 	Docker     = "docker"
+	HTTPToken  = "httptoken"
 )
 
 // User is the infrastructure provider for username.
@@ -456,3 +460,52 @@ func (m *DockerConfig) Flags(flags *flag.FlagSet) {
 func (m *DockerConfig) Value() string {
 	return string(*m)
 }
+
+// HTTPTokenConfig is the infrastructure provider for the bearer
+// token with which requests to HTTP object stores are authenticated.
+// The token is given either directly or as the path of a file
+// containing it; the file is read for every request, so that tokens
+// may be rotated.
+type HTTPTokenConfig struct {
+	token, file string
+}
+
+// Help implements infra.Provider.
+func (HTTPTokenConfig) Help() string {
+	return "provide a bearer token for HTTP object stores"
+}
+
+// Flags implements infra.Provider.
+func (t *HTTPTokenConfig) Flags(flags *flag.FlagSet) {
+	flags.StringVar(&t.token, "token", "", "bearer token")
+	flags.StringVar(&t.file, "file", "", "path of a file containing the bearer token")
+}
+
+// Init implements infra.Provider.
+func (t *HTTPTokenConfig) Init() error {
+	if t.token != "" && t.file != "" {
+		return fmt.Errorf("httptoken: only one of token and file may be provided")
+	}
+	return nil
+}
+
+// Token implements httpblob.TokenProvider.
+func (t *HTTPTokenConfig) Token(ctx context.Context) (string, error) {
+	if t.file == "" {
+		return t.token, nil
+	}
+	b, err := ioutil.ReadFile(os.ExpandEnv(t.file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// TokenProvider returns the configured token provider, or nil if no
+// token was configured.
+func (t *HTTPTokenConfig) TokenProvider() httpblob.TokenProvider {
+	if t == nil || t.token == "" && t.file == "" {
+		return nil
+	}
+	return t
+}
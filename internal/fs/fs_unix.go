@@ -17,6 +17,13 @@ type Usage struct {
 	// Avail is the total number of free bytes that are available to
 	// unpriveliged users on the disk.
 	Avail uint64
+
+	// Inodes is the total number of inodes on the disk. It is zero
+	// for file systems that do not report inode counts.
+	Inodes uint64
+
+	// FreeInodes is the number of free inodes on the disk.
+	FreeInodes uint64
 }
 
 // Stat queries and returns disk usage information for the disk
@@ -32,5 +39,8 @@ func Stat(path string) (Usage, error) {
 		Total: uint64(stat.Blocks) * size,
 		Free:  uint64(stat.Bfree) * size,
 		Avail: uint64(stat.Bavail) * size,
+
+		Inodes:     uint64(stat.Files),
+		FreeInodes: uint64(stat.Ffree),
 	}, nil
 }
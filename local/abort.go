@@ -0,0 +1,181 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"os"
+
+	"docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+var (
+	errAborted          = errors.New("exec aborted before it started")
+	errTransferCanceled = errors.New("transfer canceled")
+)
+
+// Aborter is implemented by execs that can be aborted before they
+// start running.
+type Aborter interface {
+	// Abort aborts an exec that has not yet started running. Unlike
+	// Kill, which stops a running exec, Abort fails with
+	// errors.Precondition if the exec has already started.
+	Abort(ctx context.Context) error
+}
+
+// Abort aborts the exec if its container has not yet been started
+// (e.g., it is still pulling its image). The exec fails with an
+// errors.Canceled error, its state is removed, and it no longer
+// counts against the executor's reserved resources. Execs that are
+// held by their prerequisites (see reflow.ExecConfig.After) are
+// aborted without waiting for them. Abort returns once the exec has
+// stopped, or with ctx's error if ctx is done first. Abort fails with
+// errors.Precondition if the exec is already running or complete; use
+// Kill instead.
+func (e *dockerExec) Abort(ctx context.Context) error {
+	e.mu.Lock()
+	if e.State >= execRunning {
+		e.mu.Unlock()
+		return errors.E("abort", e.id, errors.Precondition, errors.New("exec has already started"))
+	}
+	e.aborted = true
+	if e.cancel != nil {
+		e.cancel()
+	}
+	// Wait for the state machine to observe the abort, waking up if
+	// ctx is done first.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.mu.Lock()
+			e.cond.Broadcast()
+			e.mu.Unlock()
+		case <-done:
+		}
+	}()
+	for e.err == nil && e.State < execComplete && ctx.Err() == nil {
+		e.cond.Wait()
+	}
+	err, stopped := e.err, e.err != nil || e.State >= execComplete
+	e.mu.Unlock()
+	switch {
+	case !stopped:
+		return errors.E("abort", e.id, ctx.Err())
+	case err == nil:
+		return errors.E("abort", e.id, errors.Precondition, errors.New("exec has already completed"))
+	case errors.Is(errors.Canceled, err):
+		return nil
+	default:
+		// The exec failed on its own.
+		return err
+	}
+}
+
+// isAborted tells whether the exec has been aborted.
+func (e *dockerExec) isAborted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.aborted
+}
+
+// setCancel sets the function that cancels the exec before its state
+// machine is run, while it is held by its prerequisites. If the exec
+// has already been aborted, cancel is called immediately.
+func (e *dockerExec) setCancel(cancel context.CancelFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancel = cancel
+	if e.aborted {
+		cancel()
+	}
+}
+
+// abortHeld fails an exec that was aborted while it was held by its
+// prerequisites, removing its state.
+func (e *dockerExec) abortHeld() {
+	if err := os.RemoveAll(e.path()); err != nil {
+		e.Log.Errorf("failed to remove exec directory: %v", err)
+	}
+	e.setState(execUnstarted, errors.E("exec", e.id, errors.Canceled, errAborted))
+}
+
+// cleanupAborted removes any container created for an aborted exec,
+// together with the exec's state, and returns the abort error.
+func (e *dockerExec) cleanupAborted() error {
+	// The exec's context is canceled, so we use a fresh one here.
+	ctx := context.Background()
+	err := e.client.ContainerRemove(ctx, e.containerName(), types.ContainerRemoveOptions{Force: true})
+	if err != nil && !docker.IsErrNotFound(err) {
+		e.Log.Errorf("failed to remove container %s: %s", e.containerName(), err)
+	}
+	if err := e.removeTmpfsOutputs(); err != nil {
+		e.Log.Errorf("failed to remove tmpfs outputs: %v", err)
+	}
+	if err := e.unmountQuota(); err != nil {
+		e.Log.Errorf("failed to unmount disk quota: %v", err)
+	}
+	e.releaseInputs()
+	if err := os.RemoveAll(e.path()); err != nil {
+		e.Log.Errorf("failed to remove exec directory: %v", err)
+	}
+	return errors.E("exec", e.id, errors.Canceled, errAborted)
+}
+
+// TransferCanceler is implemented by execs whose transfers can be
+// canceled independently of the exec.
+type TransferCanceler interface {
+	// CancelTransfer cancels the exec's intern or extern, if it is
+	// still in progress. The exec completes with an errors.Canceled
+	// result error, but (unlike Remove) it is retained by the
+	// executor.
+	CancelTransfer(ctx context.Context) error
+}
+
+// CancelTransfer cancels the exec's transfer, removing any partially
+// downloaded (and not yet promoted) files, and returns once the exec
+// has completed. Whereas a transfer that is interrupted by Kill or an
+// executor restart is retried, a canceled transfer is not: the exec
+// completes with an errors.Canceled result error. CancelTransfer
+// fails with errors.Precondition if the exec has already completed.
+func (e *blobExec) CancelTransfer(ctx context.Context) error {
+	e.mu.Lock()
+	if e.State == execComplete {
+		e.mu.Unlock()
+		return errors.E("canceltransfer", e.ExecID, errors.Precondition, errors.New("transfer has already completed"))
+	}
+	e.transferCanceled = true
+	e.mu.Unlock()
+	e.canceler.Cancel()
+	return e.Wait(ctx)
+}
+
+// isTransferCanceled tells whether the exec's transfer has been
+// canceled.
+func (e *blobExec) isTransferCanceled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.transferCanceled
+}
+
+// cleanupCanceled removes the partial results of a canceled
+// transfer and returns the exec's result.
+func (e *blobExec) cleanupCanceled() reflow.Result {
+	for _, path := range []string{e.path("download"), e.staging.Root} {
+		if path == "" {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			e.log.Errorf("failed to remove %s: %v", path, err)
+		}
+	}
+	return reflow.Result{
+		Err: errors.Recover(errors.E(e.transferType, e.Config.URL, errors.Canceled, errTransferCanceled)),
+	}
+}
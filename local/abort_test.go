@@ -0,0 +1,144 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestAbortStarted(t *testing.T) {
+	for _, state := range []execState{execRunning, execComplete} {
+		e := &dockerExec{}
+		e.cond = sync.NewCond(&e.mu)
+		e.State = state
+		if err := e.Abort(context.Background()); !errors.Is(errors.Precondition, err) {
+			t.Errorf("%v: expected precondition error, got %v", state, err)
+		}
+		if e.isAborted() {
+			t.Errorf("%v: exec should not be aborted", state)
+		}
+	}
+}
+
+func TestAbortHeld(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abortheld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	// The prerequisite never completes.
+	p := &dockerExec{}
+	p.cond = sync.NewCond(&p.mu)
+	p.State = execRunning
+	cfg := reflow.ExecConfig{Type: "exec", Image: "image", Cmd: "true"}
+	e := newDockerExec(reflow.Digester.FromString("held"), x, cfg, nil, nil)
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		x.goAfter(ctx, e, cfg, []exec{p})
+		close(done)
+	}()
+	if err := e.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := e.Wait(ctx); !errors.Is(errors.Canceled, err) {
+		t.Errorf("expected Canceled error, got %v", err)
+	}
+}
+
+func TestAbortContext(t *testing.T) {
+	e := &dockerExec{}
+	e.cond = sync.NewCond(&e.mu)
+	e.State = execInit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.Abort(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+	if ctx.Err() == nil {
+		t.Error("Abort returned before its context was done")
+	}
+	if !e.isAborted() {
+		t.Error("exec should be aborted")
+	}
+}
+
+// blockingBucket is a bucket containing a single file whose
+// downloads block until they are canceled.
+type blockingBucket struct {
+	blob.Bucket
+	started chan struct{}
+}
+
+func (b *blockingBucket) File(ctx context.Context, key string) (reflow.File, error) {
+	return reflow.File{Source: "test://bucket/" + key, ETag: "etag", Size: 1 << 20}, nil
+}
+
+func (b *blockingBucket) Download(ctx context.Context, key, etag string, size int64, w io.WriterAt) (int64, error) {
+	if _, err := w.WriteAt([]byte("partial"), 0); err != nil {
+		return 0, err
+	}
+	close(b.started)
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (b *blockingBucket) Location() string { return "test://bucket/" }
+
+func TestCancelTransfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "canceltransfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bucket := &blockingBucket{started: make(chan struct{})}
+	e := &blobExec{
+		Blob:         blob.Mux{"test": testStore{"bucket": bucket}},
+		Repository:   &filerepo.Repository{Root: filepath.Join(dir, "repo")},
+		Root:         filepath.Join(dir, "exec"),
+		ExecID:       reflow.Digester.FromString("canceltransfer"),
+		transferType: intern,
+	}
+	e.staging.Root = filepath.Join(dir, "exec", objectsDir)
+	e.Config = reflow.ExecConfig{Type: intern, URL: "test://bucket/key"}
+	e.Init(nil)
+	ctx := context.Background()
+	go e.Go(ctx)
+	<-bucket.started
+	if err := e.CancelTransfer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || !errors.Is(errors.Canceled, res.Err) {
+		t.Errorf("expected canceled result error, got %v", res.Err)
+	}
+	if _, err := os.Stat(e.staging.Root); !os.IsNotExist(err) {
+		t.Errorf("expected partial downloads to be removed, got %v", err)
+	}
+	// The exec record is retained.
+	if _, err := os.Stat(e.path(manifestPath)); err != nil {
+		t.Error(err)
+	}
+	if err := e.CancelTransfer(ctx); !errors.Is(errors.Precondition, err) {
+		t.Errorf("expected precondition error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A stateSetter is an exec whose state may be set directly. It is used
+// to fail execs whose prerequisites were not met.
+type stateSetter interface {
+	setState(execState, error)
+}
+
+// A heldAborter is an exec that may be aborted while it is held by
+// its prerequisites; see dockerExec.Abort.
+type heldAborter interface {
+	setCancel(context.CancelFunc)
+	isAborted() bool
+	abortHeld()
+}
+
+// prerequisites returns the execs named by the After list of the
+// provided config, which is that of exec id. Prerequisites must
+// already have been put, so that they cannot form cycles. The
+// executor's lock must be held.
+func (e *Executor) prerequisites(id digest.Digest, cfg reflow.ExecConfig) ([]exec, error) {
+	after := make([]exec, len(cfg.After))
+	for i, pid := range cfg.After {
+		if pid == id {
+			return nil, errors.E("put", id, errors.Invalid, errors.New("exec cannot run after itself"))
+		}
+		if after[i] = e.execs[pid]; after[i] == nil {
+			return nil, errors.E("put", id, errors.NotExist, errors.Errorf("prerequisite exec %v does not exist", pid))
+		}
+	}
+	return after, nil
+}
+
+// goAfter runs the exec x once its prerequisites are complete. If a
+// prerequisite fails, and the exec is not configured to run after
+// failures, x is failed with a precondition error instead. If x is
+// aborted while it is held, it fails with an errors.Canceled error
+// without waiting for the remaining prerequisites.
+func (e *Executor) goAfter(ctx context.Context, x exec, cfg reflow.ExecConfig, after []exec) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h, abortable := x.(heldAborter)
+	if abortable {
+		h.setCancel(cancel)
+	}
+	for i, p := range after {
+		done := make(chan error, 1)
+		go func(p exec) { done <- p.WaitUntil(execComplete) }(p)
+		var err error
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if abortable && h.isAborted() {
+			h.abortHeld()
+			return
+		}
+		if err == nil && !cfg.AfterFailure {
+			var res reflow.Result
+			if res, err = p.Result(ctx); err == nil && res.Err != nil {
+				err = res.Err
+			}
+		}
+		if err != nil && (ctx.Err() != nil || !cfg.AfterFailure) {
+			e.Log.Debugf("exec %v: prerequisite %v failed: %v", x.ID(), cfg.After[i], err)
+			x.(stateSetter).setState(execUnstarted,
+				errors.E("exec", x.ID(), errors.Precondition, errors.Errorf("prerequisite %v failed: %v", cfg.After[i], err)))
+			return
+		}
+	}
+	if abortable && h.isAborted() {
+		h.abortHeld()
+		return
+	}
+	x.Go(ctx)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestExecAfter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo", "false"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		ctx    = context.Background()
+		first  = reflow.Digester.FromString("first")
+		second = reflow.Digester.FromString("second")
+		failed = reflow.Digester.FromString("failed")
+	)
+	execs, errs := x.PutBatch(ctx, []PutRequest{
+		{first, reflow.ExecConfig{Type: intern, URL: "exec://echo first"}},
+		{second, reflow.ExecConfig{Type: intern, URL: "exec://echo second", After: []digest.Digest{first}}},
+		{failed, reflow.ExecConfig{Type: intern, URL: "exec://false"}},
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := execs[1].Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execs[0].Result(ctx); err != nil {
+		t.Errorf("prerequisite is not complete: %v", err)
+	}
+
+	unknown := reflow.Digester.FromString("unknown")
+	_, err = x.Put(ctx, reflow.Digester.FromString("orphan"),
+		reflow.ExecConfig{Type: intern, URL: "exec://echo orphan", After: []digest.Digest{unknown}})
+	if !errors.Is(errors.NotExist, err) {
+		t.Errorf("expected NotExist error, got %v", err)
+	}
+	self := reflow.Digester.FromString("self")
+	_, err = x.Put(ctx, self, reflow.ExecConfig{Type: intern, URL: "exec://echo self", After: []digest.Digest{self}})
+	if !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+
+	dependent, err := x.Put(ctx, reflow.Digester.FromString("dependent"),
+		reflow.ExecConfig{Type: intern, URL: "exec://echo dependent", After: []digest.Digest{failed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dependent.Wait(ctx); !errors.Is(errors.Precondition, err) {
+		t.Errorf("expected Precondition error, got %v", err)
+	}
+	regardless, err := x.Put(ctx, reflow.Digester.FromString("regardless"),
+		reflow.ExecConfig{Type: intern, URL: "exec://echo regardless", After: []digest.Digest{failed}, AfterFailure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := regardless.Wait(ctx); err != nil {
+		t.Error(err)
+	}
+}
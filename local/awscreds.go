@@ -0,0 +1,32 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/grailbio/reflow/errors"
+)
+
+// ProfileCredentials returns an AWS credentials provider for the
+// named profile, as defined in the shared credentials or config file
+// at path. An empty profile selects the default profile; an empty
+// path selects the SDK's default locations. The session is created
+// with shared config enabled, so that profiles which specify a
+// role_arn (together with a source_profile) assume the role.
+func ProfileCredentials(profile, path string) (*credentials.Credentials, error) {
+	opts := session.Options{
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if path != "" {
+		opts.SharedConfigFiles = []string{path}
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, errors.E("aws credentials", profile, path, errors.Invalid, err)
+	}
+	return sess.Config.Credentials, nil
+}
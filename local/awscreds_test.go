@@ -0,0 +1,28 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import "testing"
+
+func TestProfileCredentials(t *testing.T) {
+	for _, c := range []struct {
+		profile, key string
+	}{
+		{"default", "AKIDDEFAULT"},
+		{"test", "AKIDTEST"},
+	} {
+		creds, err := ProfileCredentials(c.profile, "testdata/credentials")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := creds.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := v.AccessKeyID, c.key; got != want {
+			t.Errorf("profile %q: got %v, want %v", c.profile, got, want)
+		}
+	}
+}
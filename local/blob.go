@@ -7,6 +7,8 @@ package local
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"expvar"
 	"fmt"
@@ -23,6 +25,7 @@ import (
 
 	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/digest"
+	"github.com/grailbio/base/retry"
 	"github.com/grailbio/base/sync/once"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/blob"
@@ -165,6 +168,8 @@ type blobExec struct {
 	transferType string
 	// transferredSize stores the total amount of data either downloaded and installed or uploaded.
 	transferredSize uint64
+	// transferCanceled is set when the transfer is canceled by CancelTransfer.
+	transferCanceled bool
 
 	canceler canceler
 
@@ -210,8 +215,10 @@ func (e *blobExec) Init(x *Executor) {
 		e.ExecURI = x.URI() + "/" + e.ID().Hex()
 		if e.transferType == intern {
 			e.staging.Root = x.execPath(e.ID(), objectsDir)
+			e.staging.BlockSize = x.DigestBlockSize
 			e.staging.Log = x.Log
 		}
+		e.Manifest.Version = x.Version
 	}
 	e.Manifest.Created = time.Now()
 	e.Manifest.Type = execBlob
@@ -249,13 +256,28 @@ func (e *blobExec) Go(ctx context.Context) {
 		case execCreated:
 			state = execRunning
 		case execRunning:
+			if e.x != nil {
+				e.x.emit(e.ExecID, ExecStarted, nil)
+			}
+			atomic.StoreUint64(&e.transferredSize, 0)
+			start := time.Now()
 			if e.transferType == intern {
 				err = e.doIntern(ctx)
 			} else {
 				err = e.doExtern(ctx)
 			}
 			if err == nil {
+				e.recordTransfer(time.Since(start))
+				state = execComplete
+				break
+			}
+			if e.isTransferCanceled() {
 				state = execComplete
+				result := e.cleanupCanceled()
+				e.mu.Lock()
+				e.Manifest.Result = result
+				e.mu.Unlock()
+				err = nil
 				break
 			}
 			if err == context.DeadlineExceeded || err == context.Canceled {
@@ -278,6 +300,23 @@ func (e *blobExec) Go(ctx context.Context) {
 	}
 }
 
+// recordTransfer records a summary of the exec's completed transfer,
+// which took duration dur, in its manifest.
+func (e *blobExec) recordTransfer(dur time.Duration) {
+	stats := &reflow.TransferStats{
+		Direction: e.transferTypeStr(),
+		Bytes:     int64(atomic.LoadUint64(&e.transferredSize)),
+		Duration:  dur,
+	}
+	if dur > 0 {
+		stats.Throughput = float64(stats.Bytes) / dur.Seconds()
+	}
+	e.mu.Lock()
+	e.Manifest.Transfer = stats
+	e.mu.Unlock()
+	e.log.Printf("transfer complete: %s", stats)
+}
+
 // path constructs a path in the exec's directory.
 func (e *blobExec) path(elems ...string) string {
 	elems = append([]string{e.Root}, elems...)
@@ -336,25 +375,34 @@ func (e *blobExec) doIntern(ctx context.Context) error {
 	e.Manifest.Result.Fileset.Map = map[string]reflow.File{}
 	e.mu.Unlock()
 	nprefix := len(prefix)
+	limits := newInternLimits(e.Config)
 
 	if !strings.HasSuffix(prefix, "/") {
 		file, err := bucket.File(ctx, prefix)
 		if err != nil {
 			return err
 		}
-		if found, ferr := fileFromRepo(ctx, e.Repository, file); ferr == nil {
+		if err := limits.add(file.Size); err != nil {
+			return errors.E("intern", e.Config.URL, err)
+		}
+		// Files in the repository are stored by their (compressed) content
+		// hash, so we must always download when decompressing.
+		if found, ferr := fileFromRepo(ctx, e.Repository, file); ferr == nil && !e.Config.Decompress {
 			file = found
 		} else {
 			dl := download{
-				Bucket: bucket,
-				Key:    prefix,
-				File:   file,
-				Log:    e.log,
+				Bucket:     bucket,
+				Key:        prefix,
+				File:       file,
+				Log:        e.log,
+				Decompress: e.Config.Decompress,
+				Progress:   e.progress("."),
 			}
 			file, ferr = dl.Do(ctx, &e.staging)
 			if ferr != nil {
 				return ferr
 			}
+			e.recordCodec(".", dl.Codec)
 		}
 		atomic.AddUint64(&e.transferredSize, uint64(file.Size))
 		e.mu.Lock()
@@ -365,6 +413,8 @@ func (e *blobExec) doIntern(ctx context.Context) error {
 	rw := newRateExporter(internRate)
 	defer rw.Done()
 	scan := bucket.Scan(prefix)
+	names := newFilenamer(e.Config.FilenamePolicy)
+	var n int
 	for scan.Scan(ctx) {
 		key, file := scan.Key(), scan.File()
 		if len(key) < nprefix {
@@ -375,24 +425,46 @@ func (e *blobExec) doIntern(ctx context.Context) error {
 		if strings.HasSuffix(key, "/") {
 			continue
 		}
+		name, err := names.Name(key[nprefix:])
+		if err != nil {
+			cancel()
+			g.Wait()
+			return errors.E("intern", e.Config.URL, err)
+		}
+		if err := limits.add(file.Size); err != nil {
+			// Abort in-flight downloads.
+			cancel()
+			g.Wait()
+			return errors.E("intern", e.Config.URL, err)
+		}
+		if n++; n%inodeCheckInterval == 0 && e.x != nil {
+			if err := e.x.checkInodes(); err != nil {
+				cancel()
+				g.Wait()
+				return errors.E("intern", e.Config.URL, err)
+			}
+		}
 		g.Go(func() error {
-			if found, err := fileFromRepo(ctx, e.Repository, file); err == nil {
+			if found, err := fileFromRepo(ctx, e.Repository, file); err == nil && !e.Config.Decompress {
 				file = found
 			} else {
 				dl := download{
-					Bucket: bucket,
-					Key:    key,
-					File:   file,
-					Log:    e.log,
+					Bucket:     bucket,
+					Key:        key,
+					File:       file,
+					Log:        e.log,
+					Decompress: e.Config.Decompress,
+					Progress:   e.progress(name),
 				}
 				file, err = dl.Do(ctx, &e.staging)
 				if err != nil {
 					return err
 				}
+				e.recordCodec(name, dl.Codec)
 			}
 			atomic.AddUint64(&e.transferredSize, uint64(file.Size))
 			e.mu.Lock()
-			e.Manifest.Result.Fileset.Map[key[nprefix:]] = file
+			e.Manifest.Result.Fileset.Map[name] = file
 			e.mu.Unlock()
 			rw.Add(file.Size)
 			return nil
@@ -407,6 +479,33 @@ func (e *blobExec) doIntern(ctx context.Context) error {
 	return scan.Err()
 }
 
+// progress returns the function that reports the download progress
+// of the file at path in the intern's fileset, or nil if the
+// executor does not report progress.
+func (e *blobExec) progress(path string) func(done, total int64) {
+	if e.x == nil || e.x.OnInternProgress == nil {
+		return nil
+	}
+	report := e.x.OnInternProgress
+	return func(done, total int64) {
+		report(e.ExecID, path, done, total)
+	}
+}
+
+// recordCodec records in the exec's result that the file at path
+// was decompressed with the given codec.
+func (e *blobExec) recordCodec(path, codec string) {
+	if codec == "" {
+		return
+	}
+	e.mu.Lock()
+	if e.Manifest.Result.Decompressed == nil {
+		e.Manifest.Result.Decompressed = make(map[string]string)
+	}
+	e.Manifest.Result.Decompressed[path] = codec
+	e.mu.Unlock()
+}
+
 func (e *blobExec) doExtern(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	e.canceler.Set(cancel)
@@ -426,6 +525,12 @@ func (e *blobExec) doExtern(ctx context.Context) error {
 			errors.Errorf("unexpected args (must be 1, but was %d): %v", len(e.Config.Args), e.Config.Args))
 	}
 	fileset := e.Config.Args[0].Fileset.Pullup()
+	if class := e.Config.StorageClass; class != "" {
+		ctx = blob.WithStorageClass(ctx, class)
+	}
+	if e.Config.ExternTar {
+		return e.doExternTar(ctx, bucket, prefix, fileset)
+	}
 
 	// Define the error group under which we will perform all of our fetches.
 	g, ctx := errgroup.WithContext(ctx)
@@ -448,15 +553,26 @@ func (e *blobExec) doExtern(ctx context.Context) error {
 				Size:       f.Size,
 				Log:        e.log,
 			}
-			err = ul.Do(ctx)
-			if err != nil {
-				return err
+			if e.Config.ExternMD5 {
+				sum, err := fileMD5(ctx, e.Repository, f.ID)
+				if err != nil {
+					return err
+				}
+				f.MD5 = sum
+				ul.Metadata = map[string]string{md5MetadataKey: sum}
+			}
+			if e.Config.ExternSkipExisting && ul.Exists(ctx) {
+				e.log.Debugf("skipping upload of %s: %s%s is up to date", fn, bucket.Location(), key)
+			} else {
+				if err := e.retry(ctx, func() error { return ul.Do(ctx) }); err != nil {
+					return err
+				}
+				atomic.AddUint64(&e.transferredSize, uint64(f.Size))
+				rw.Add(f.Size)
 			}
-			atomic.AddUint64(&e.transferredSize, uint64(f.Size))
 			e.mu.Lock()
 			e.Manifest.Result.Fileset.Map[fn] = f
 			e.mu.Unlock()
-			rw.Add(f.Size)
 			return nil
 		})
 	}
@@ -466,7 +582,38 @@ func (e *blobExec) doExtern(ctx context.Context) error {
 	return g.Wait()
 }
 
+// externRetryPolicy is the policy with which the retryable errors of
+// extern uploads are retried.
+var externRetryPolicy = retryPolicy
+
+// retry calls fn until it succeeds, retrying it (per
+// externRetryPolicy) as long as it fails with retryable errors.
+func (e *blobExec) retry(ctx context.Context, fn func() error) error {
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || !e.retryable(err) {
+			return err
+		}
+		if werr := retry.Wait(ctx, externRetryPolicy, retries); werr != nil {
+			return err
+		}
+		e.log.Printf("retrying after error: %v", err)
+	}
+}
+
+// retryable tells whether err is retryable, according to the
+// executor's RetryableError, if any.
+func (e *blobExec) retryable(err error) bool {
+	if e.x != nil && e.x.RetryableError != nil {
+		return e.x.RetryableError(err)
+	}
+	return errors.Restartable(err) || errors.Is(errors.ResourcesExhausted, err)
+}
+
 func (e *blobExec) Kill(ctx context.Context) error {
+	if state, err := e.getState(); e.x != nil && err == nil && state != execComplete {
+		e.x.markKilled(e.ExecID)
+	}
 	e.canceler.Cancel()
 	return e.Wait(ctx)
 }
@@ -487,7 +634,9 @@ func (e *blobExec) ID() digest.Digest {
 // URI returns a URI For this exec based on its executor's URI.
 func (e *blobExec) URI() string { return e.ExecURI }
 
-// Value returns the interned value when the exec is complete.
+// Result returns the interned value when the exec is complete. It
+// is safe to call concurrently and repeatedly; the result is held in
+// memory.
 func (e *blobExec) Result(ctx context.Context) (reflow.Result, error) {
 	state, err := e.getState()
 	if err != nil {
@@ -519,10 +668,14 @@ func (e *blobExec) Promote(ctx context.Context) error {
 
 // Inspect returns exec metadata.
 func (e *blobExec) Inspect(ctx context.Context) (reflow.ExecInspect, error) {
+	e.mu.Lock()
 	inspect := reflow.ExecInspect{
-		Config:  e.Config,
-		Created: e.Manifest.Created,
+		Config:   e.Config,
+		Created:  e.Manifest.Created,
+		Transfer: e.Manifest.Transfer,
+		Version:  e.Manifest.Version,
 	}
+	e.mu.Unlock()
 	state, err := e.getState()
 	if err != nil {
 		inspect.Error = errors.Recover(err)
@@ -585,11 +738,41 @@ func fileFromRepo(ctx context.Context, repo *filerepo.Repository, f reflow.File)
 	return
 }
 
+// md5MetadataKey is the metadata key under which the MD5 checksums
+// of externed files are stored.
+const md5MetadataKey = "md5"
+
+// fileMD5 returns the hex-encoded MD5 checksum of the contents of the
+// object id in repo.
+func fileMD5(ctx context.Context, repo *filerepo.Repository, id digest.Digest) (string, error) {
+	rc, err := repo.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 type download struct {
 	Bucket blob.Bucket
 	Key    string
 	File   reflow.File
 	Log    *log.Logger
+	// Decompress indicates that the downloaded file should be
+	// decompressed (if compressed) before it is installed.
+	Decompress bool
+
+	// Progress, if non-nil, is called with the number of bytes
+	// downloaded so far, and the file's size, as they are written.
+	Progress func(done, total int64)
+
+	// Codec is set by Do to the codec of the downloaded file
+	// if it was decompressed.
+	Codec string
 }
 
 func (d *download) Do(ctx context.Context, repo *filerepo.Repository) (reflow.File, error) {
@@ -606,12 +789,25 @@ func (d *download) Do(ctx context.Context, repo *filerepo.Repository) (reflow.Fi
 			}
 		}
 	}()
+	install := filename
+	if d.Decompress {
+		if install, err = d.decompress(filename, repo); err != nil {
+			return reflow.File{}, err
+		}
+		if install != filename {
+			defer func() {
+				if err := os.Remove(install); err != nil {
+					d.Log.Errorf("remove %s: %v", install, err)
+				}
+			}()
+		}
+	}
 	var w bytewatch
 	w.Reset()
 	digestingFiles.Add(1)
-	file, err := repo.Install(filename)
+	file, err := repo.Install(install)
 	digestingFiles.Add(-1)
-	if err == nil && file.Size != d.File.Size {
+	if err == nil && d.Codec == "" && file.Size != d.File.Size {
 		err = errors.E(errors.Integrity,
 			errors.Errorf("expected size %d does not match actual size %d", d.File.Size, file.Size))
 	}
@@ -626,6 +822,34 @@ func (d *download) Do(ctx context.Context, repo *filerepo.Repository) (reflow.Fi
 	return file, err
 }
 
+// decompress decompresses the downloaded file filename if it is
+// compressed with a supported codec, returning the name of the file
+// to install. The downloaded file size is verified before
+// decompression, since the installed file's size will differ.
+func (d *download) decompress(filename string, repo *filerepo.Repository) (string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != d.File.Size {
+		return "", errors.E(errors.Integrity,
+			errors.Errorf("expected size %d does not match actual size %d", d.File.Size, info.Size()))
+	}
+	decompressed, codec, err := decompress(filename, repo)
+	if err != nil {
+		return "", errors.E("decompress", d.Bucket.Location()+d.Key, err)
+	}
+	if decompressed == "" {
+		if codec != "" {
+			d.Log.Printf("%s%s: not %s-compressed; installing as is", d.Bucket.Location(), d.Key, codec)
+		}
+		return filename, nil
+	}
+	d.Codec = codec
+	d.Log.Printf("decompressed %s%s (%s)", d.Bucket.Location(), d.Key, codec)
+	return decompressed, nil
+}
+
 func (d *download) download(ctx context.Context, repo *filerepo.Repository) (string, error) {
 	f := newLazyWriterAt(func() (namedWriterAtCloser, error) {
 		downloadingFiles.Add(1)
@@ -640,9 +864,13 @@ func (d *download) download(ctx context.Context, repo *filerepo.Repository) (str
 			d.Log.Errorf("close %s: %v", f.Name(), err)
 		}
 	}()
+	var dst io.WriterAt = f
+	if d.Progress != nil {
+		dst = &progressWriterAt{WriterAt: f, ctx: ctx, size: d.File.Size, report: d.Progress}
+	}
 	var w bytewatch
 	w.Reset()
-	_, err := d.Bucket.Download(ctx, d.Key, d.File.ETag, d.File.Size, f)
+	_, err := d.Bucket.Download(ctx, d.Key, d.File.ETag, d.File.Size, dst)
 	downloadingFiles.Add(-1)
 	if err != nil {
 		d.Log.Printf("download %s%s: %v", d.Bucket.Location(), d.Key, err)
@@ -653,6 +881,26 @@ func (d *download) download(ctx context.Context, repo *filerepo.Repository) (str
 	return f.Name(), err
 }
 
+// progressWriterAt is an io.WriterAt that reports the number of
+// bytes written through it. Downloads may write concurrently; reports
+// cease once the download's context is done.
+type progressWriterAt struct {
+	done int64 // accessed atomically; first for alignment
+	io.WriterAt
+	ctx    context.Context
+	size   int64
+	report func(done, total int64)
+}
+
+func (w *progressWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.WriterAt.WriteAt(p, off)
+	done := atomic.AddInt64(&w.done, int64(n))
+	if n > 0 && w.ctx.Err() == nil {
+		w.report(done, w.size)
+	}
+	return n, err
+}
+
 // namedWriterAtCloser combines different interfaces for use by lazyWriterAt.
 type namedWriterAtCloser interface {
 	io.WriterAt
@@ -711,9 +959,26 @@ type upload struct {
 	ID         digest.Digest
 	Size       int64
 	Log        *log.Logger
+	// Metadata is the (optional) user metadata stored with the object.
+	Metadata map[string]string
+}
+
+// Exists tells whether the upload's destination object already exists
+// with the upload's size and content digest, so that the upload may
+// be skipped. Objects without a recorded digest are never considered
+// to be up to date.
+func (u *upload) Exists(ctx context.Context) bool {
+	file, err := u.Bucket.File(ctx, u.Key)
+	if err != nil {
+		return false
+	}
+	return file.Size == u.Size && !file.ContentHash.IsZero() && file.ContentHash == u.ID
 }
 
 func (u *upload) Do(ctx context.Context) error {
+	if len(u.Metadata) > 0 {
+		ctx = blob.WithMetadata(ctx, u.Metadata)
+	}
 	f := newLazyReadCloser(func() (io.ReadCloser, error) {
 		uploadingFiles.Add(1)
 		file, err := u.Repository.Get(ctx, u.ID)
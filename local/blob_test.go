@@ -5,19 +5,28 @@
 package local
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/md5"
 	goerrors "errors"
 	"expvar"
 	"fmt"
+	"io"
 	"math/rand"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/base/retry"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/blob"
 	"github.com/grailbio/reflow/blob/s3blob"
@@ -187,6 +196,44 @@ func TestS3ExecInternPrefix(t *testing.T) {
 	}
 }
 
+func TestS3ExecInternProgress(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3x, client, _, cleanup := newS3Test(t, bucket, prefix, intern)
+	defer cleanup()
+
+	files := []file{
+		getFile("a", true),
+		getFile("b/c", true),
+	}
+	for _, file := range files {
+		client.SetFile(prefix+file.path, []byte(file.path), file.sha256)
+	}
+	var (
+		mu       sync.Mutex
+		progress = make(map[string][2]int64)
+	)
+	s3x.x.OnInternProgress = func(id digest.Digest, path string, done, total int64) {
+		if id != s3x.ExecID {
+			t.Errorf("got %v, want %v", id, s3x.ExecID)
+		}
+		mu.Lock()
+		if done > progress[path][0] {
+			progress[path] = [2]int64{done, total}
+		}
+		mu.Unlock()
+	}
+	executeAndGetResult(context.Background(), t, s3x)
+	for _, file := range files {
+		size := int64(len(file.path))
+		if got, want := progress[file.path], [2]int64{size, size}; got != want {
+			t.Errorf("%s: got %v, want %v", file.path, got, want)
+		}
+	}
+}
+
 func TestS3ExecInternPrefixError(t *testing.T) {
 	const (
 		bucket = "testbucket"
@@ -357,3 +404,364 @@ func TestRateWatch(t *testing.T) {
 		}
 	}
 }
+
+func TestS3ExecInternDecompress(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3x, client, _, cleanup := newS3Test(t, bucket, prefix, intern)
+	defer cleanup()
+	s3x.Config.Decompress = true
+
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write([]byte("compressed contents")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	client.SetFile(prefix+"a.gz", b.Bytes(), "")
+	client.SetFile(prefix+"b", []byte("plain contents"), "")
+	// Plain files that begin with a codec's magic bytes are installed
+	// as they are.
+	client.SetFile(prefix+"c", []byte("BZh plain contents"), "")
+	client.SetFile(prefix+"d", []byte("\x1f\x8b plain contents"), "")
+
+	ctx := context.Background()
+	res := executeAndGetResult(ctx, t, s3x)
+	for path, contents := range map[string]string{
+		"a.gz": "compressed contents",
+		"b":    "plain contents",
+		"c":    "BZh plain contents",
+		"d":    "\x1f\x8b plain contents",
+	} {
+		if got, want := res.Fileset.Map[path].ID, reflow.Digester.FromString(contents); got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+	if got, want := res.Decompressed, map[string]string{"a.gz": codecGzip}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestS3ExecInternDecompressNotSupported(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3x, client, _, cleanup := newS3Test(t, bucket, prefix, intern)
+	defer cleanup()
+	s3x.Config.Decompress = true
+	client.SetFile(prefix+"a.zst", []byte("\x28\xb5\x2f\xfdzstd frame"), "")
+
+	ctx := context.Background()
+	res, err := executeAndGetResultAndError(ctx, t, s3x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || !errors.Is(errors.NotSupported, res.Err) {
+		t.Errorf("expected not supported error, got %v", res.Err)
+	}
+}
+
+func TestS3ExecExternMD5(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3, _, repo, cleanup := newS3Test(t, bucket, prefix, extern)
+	defer cleanup()
+
+	files := []string{"a", "b/c"}
+	fileset := reflowtestutil.WriteFiles(repo, files...)
+	s3.Config.Args = []reflow.Arg{{Fileset: &fileset}}
+	s3.Config.ExternMD5 = true
+
+	ctx := context.Background()
+	res := executeAndGetResult(ctx, t, s3)
+	for _, file := range files {
+		// WriteFiles writes each file's name as its contents.
+		if got, want := res.Fileset.Map[file].MD5, fmt.Sprintf("%x", md5.Sum([]byte(file))); got != want {
+			t.Errorf("%s: got %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestS3ExecExternStorageClass(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3x, client, repo, cleanup := newS3Test(t, bucket, prefix, extern)
+	defer cleanup()
+	var (
+		mu      sync.Mutex
+		classes = make(map[string]string)
+	)
+	client.Err = func(api string, input interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch input := input.(type) {
+		case *s3.PutObjectInput:
+			classes[*input.Key] = aws.StringValue(input.StorageClass)
+		case *s3.CreateMultipartUploadInput:
+			classes[*input.Key] = aws.StringValue(input.StorageClass)
+		}
+		return nil
+	}
+	files := []string{"a", "b/c"}
+	fileset := reflowtestutil.WriteFiles(repo, files...)
+	s3x.Config.Args = []reflow.Arg{{Fileset: &fileset}}
+	s3x.Config.StorageClass = s3.StorageClassStandardIa
+
+	ctx := context.Background()
+	executeAndGetResult(ctx, t, s3x)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, file := range files {
+		class, ok := classes[prefix+file]
+		if !ok {
+			t.Errorf("%s: not uploaded", file)
+			continue
+		}
+		if got, want := class, s3.StorageClassStandardIa; got != want {
+			t.Errorf("%s: got storage class %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestS3ExecTransferStats(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3, _, repo, cleanup := newS3Test(t, bucket, prefix, extern)
+	defer cleanup()
+
+	fileset := reflowtestutil.WriteFiles(repo, "a", "b/c", "d:hello")
+	s3.Config.Args = []reflow.Arg{{Fileset: &fileset}}
+
+	ctx := context.Background()
+	executeAndGetResult(ctx, t, s3)
+	inspect, err := s3.Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := inspect.Transfer
+	if stats == nil {
+		t.Fatal("missing transfer stats")
+	}
+	if got, want := stats.Direction, "upload"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.Bytes, fileset.Size(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if stats.Duration <= 0 || stats.Throughput <= 0 {
+		t.Errorf("expected positive duration and throughput, got %v", stats)
+	}
+}
+
+func TestS3ExecExternSkipExisting(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		prefix = "prefix/"
+	)
+	s3, _, repo, cleanup := newS3Test(t, bucket, prefix, extern)
+	defer cleanup()
+
+	fileset := reflowtestutil.WriteFiles(repo, "a", "b/c")
+	s3.Config.Args = []reflow.Arg{{Fileset: &fileset}}
+	s3.Config.ExternSkipExisting = true
+	ctx := context.Background()
+	executeAndGetResult(ctx, t, s3)
+
+	// Re-extern to the same destination with an additional file:
+	// only the new file should be uploaded.
+	rerun := &blobExec{
+		Blob:         s3.Blob,
+		Repository:   repo,
+		Root:         s3.Root + "2",
+		ExecID:       reflow.Digester.FromString("s3test2"),
+		transferType: extern,
+		x:            s3.x,
+	}
+	fileset2 := reflowtestutil.WriteFiles(repo, "a", "b/c", "d:hello")
+	rerun.Config = s3.Config
+	rerun.Config.Args = []reflow.Arg{{Fileset: &fileset2}}
+	rerun.Init(nil)
+	res := executeAndGetResult(ctx, t, rerun)
+	if got, want := len(res.Fileset.Map), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	inspect, err := rerun.Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inspect.Transfer.Bytes, fileset2.Map["d"].Size; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestS3ExecExternTar(t *testing.T) {
+	const (
+		bucket = "testbucket"
+		key    = "prefix/out.tar"
+	)
+	s3, _, repo, cleanup := newS3Test(t, bucket, key, extern)
+	defer cleanup()
+
+	fileset := reflowtestutil.WriteFiles(repo, "b/c:world", "a:hello")
+	s3.Config.Args = []reflow.Arg{{Fileset: &fileset}}
+	s3.Config.ExternTar = true
+	ctx := context.Background()
+	res := executeAndGetResult(ctx, t, s3)
+
+	var want bytes.Buffer
+	if err := writeTar(ctx, &want, fileset, repo, "out"); err != nil {
+		t.Fatal(err)
+	}
+	file, ok := res.Fileset.Map["."]
+	if !ok || len(res.Fileset.Map) != 1 {
+		t.Fatalf("unexpected result %v", res.Fileset)
+	}
+	if got, want := file.ID, reflow.Digester.FromBytes(want.Bytes()); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	b, err := s3.Blob.Bucket(ctx, "s3://"+bucket+"/"+key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := b.Get(ctx, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(tarModTime) {
+			t.Errorf("%s: got mod time %v, want %v", hdr.Name, hdr.ModTime, tarModTime)
+		}
+		names = append(names, hdr.Name)
+	}
+	if got, want := names, []string{"a", "b/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The archive is deterministic.
+	var again bytes.Buffer
+	if err := writeTar(ctx, &again, fileset, repo, "out"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), want.Bytes()) {
+		t.Error("archive is not deterministic")
+	}
+}
+
+func TestRewriteConfigExternTar(t *testing.T) {
+	var x Executor
+	for _, c := range []struct {
+		typ, url string
+		kind     errors.Kind
+	}{
+		{extern, "s3://bucket/out.tar", errors.Other},
+		{extern, "s3://bucket/prefix/", errors.Invalid},
+		{extern, "s3://bucket", errors.Invalid},
+		{extern, "localfile:///tmp/out.tar", errors.NotSupported},
+		{intern, "s3://bucket/out.tar", errors.Invalid},
+	} {
+		cfg := reflow.ExecConfig{Type: c.typ, URL: c.url, ExternTar: true}
+		err := x.rewriteConfig(&cfg)
+		if c.kind == errors.Other {
+			if err != nil {
+				t.Errorf("%s %s: %v", c.typ, c.url, err)
+			}
+			continue
+		}
+		if !errors.Is(c.kind, err) {
+			t.Errorf("%s %s: got %v, want %v", c.typ, c.url, err, c.kind)
+		}
+	}
+}
+
+func TestBlobExecVersion(t *testing.T) {
+	x := &Executor{Dir: "/nonexistent", Version: "v1.2.3"}
+	e := &blobExec{ExecID: reflow.Digester.FromString("version"), transferType: extern}
+	e.Init(x)
+	inspect, err := e.Inspect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inspect.Version, "v1.2.3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBlobExecRetry(t *testing.T) {
+	save := externRetryPolicy
+	defer func() { externRetryPolicy = save }()
+	externRetryPolicy = retry.MaxTries(retry.Backoff(time.Millisecond, time.Millisecond, 1), 3)
+	ctx := context.Background()
+	failing := func(n *int, errs ...error) func() error {
+		return func() error {
+			*n++
+			if *n <= len(errs) {
+				return errs[*n-1]
+			}
+			return nil
+		}
+	}
+	var (
+		e        blobExec
+		n        int
+		slowDown = errors.E(errors.ResourcesExhausted, errors.New("SlowDown"))
+		denied   = errors.E(errors.NotAllowed, errors.New("AccessDenied"))
+	)
+	if err := e.retry(ctx, failing(&n, slowDown, errors.E(errors.Temporary, "temporary"))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 3; got != want {
+		t.Errorf("got %v calls, want %v", got, want)
+	}
+	n = 0
+	if err := e.retry(ctx, failing(&n, denied)); err != denied {
+		t.Errorf("got %v, want %v", err, denied)
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("got %v calls, want %v", got, want)
+	}
+	n = 0
+	errs := make([]error, 10)
+	for i := range errs {
+		errs[i] = slowDown
+	}
+	if err := e.retry(ctx, failing(&n, errs...)); err != slowDown {
+		t.Errorf("got %v, want %v", err, slowDown)
+	}
+	if n < 2 || n >= len(errs) {
+		t.Errorf("got %v calls, want retries bounded by the policy", n)
+	}
+
+	e.x = &Executor{RetryableError: func(err error) bool { return errors.Is(errors.NotAllowed, err) }}
+	n = 0
+	if err := e.retry(ctx, failing(&n, denied)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("got %v calls, want %v", got, want)
+	}
+	n = 0
+	if err := e.retry(ctx, failing(&n, slowDown)); err != slowDown {
+		t.Errorf("got %v, want %v", err, slowDown)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestInternBlockDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockdigest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := filepath.Join(dir, "data")
+	if err := os.MkdirAll(data, 0777); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 1000)
+	rand.New(rand.NewSource(0)).Read(p)
+	if err := ioutil.WriteFile(filepath.Join(data, "big"), p, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, "small"), []byte("small"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	want, err := filerepo.BlockDigest(bytes.NewReader(p), int64(len(p)), 64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := &Executor{Dir: filepath.Join(dir, "executor"), DigestBlockSize: 64, CacheInternDigests: true}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// The second intern uses the digest cache.
+	for _, name := range []string{"first", "second"} {
+		exec, err := x.Put(ctx, reflow.Digester.FromString(name), reflow.ExecConfig{Type: intern, URL: "localfile://" + data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exec.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		res, err := exec.Result(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		big := res.Fileset.Map["big"]
+		if got := big.ID; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if got := big.BlockDigest; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if got, want := big.BlockSize, int64(64); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		small := res.Fileset.Map["small"]
+		if got, want := small.ID, reflow.Digester.FromString("small"); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if !small.BlockDigest.IsZero() {
+			t.Errorf("%s: unexpected block digest %v", name, small.BlockDigest)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"strings"
+
+	"github.com/grailbio/reflow"
+)
+
+// normalizeCap returns the canonical name of a Linux capability:
+// upper case and without the "CAP_" prefix.
+func normalizeCap(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(name), "CAP_")
+}
+
+// containsCap tells whether the capability name is in caps.
+func containsCap(caps []string, name string) bool {
+	name = normalizeCap(name)
+	for _, c := range caps {
+		if normalizeCap(c) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilities returns the capabilities to add to and drop from the
+// container of the exec with the provided config. Capabilities added
+// by the exec are never dropped, so that an exec may add back a
+// capability dropped by the executor.
+func (e *Executor) capabilities(cfg reflow.ExecConfig) (add, drop []string) {
+	for _, caps := range [][]string{e.CapAdd, cfg.CapAdd} {
+		for _, name := range caps {
+			if !containsCap(add, name) {
+				add = append(add, normalizeCap(name))
+			}
+		}
+	}
+	for _, caps := range [][]string{e.CapDrop, cfg.CapDrop} {
+		for _, name := range caps {
+			if !containsCap(add, name) && !containsCap(drop, name) {
+				drop = append(drop, normalizeCap(name))
+			}
+		}
+	}
+	return add, drop
+}
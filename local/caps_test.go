@@ -0,0 +1,28 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestCapabilities(t *testing.T) {
+	x := &Executor{CapAdd: []string{"net_raw"}, CapDrop: []string{"ALL", "SYS_PTRACE"}}
+	cfg := reflow.ExecConfig{CapAdd: []string{"CAP_SYS_PTRACE", "NET_RAW"}, CapDrop: []string{"MKNOD"}}
+	add, drop := x.capabilities(cfg)
+	if got, want := add, []string{"NET_RAW", "SYS_PTRACE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := drop, []string{"ALL", "MKNOD"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	add, drop = new(Executor).capabilities(reflow.ExecConfig{})
+	if add != nil || drop != nil {
+		t.Errorf("got %v, %v, want nil, nil", add, drop)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"time"
+)
+
+// A Clock provides the time to an executor's profiler. It may be
+// replaced (see Executor.Clock) to control profiling deterministically
+// in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a ticker that ticks with period d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Ticker delivers ticks at intervals, as time.Ticker.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// wallClock is the Clock implemented by package time.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) NewTicker(d time.Duration) Ticker { return wallTicker{time.NewTicker(d)} }
+
+type wallTicker struct{ *time.Ticker }
+
+func (t wallTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// clock returns the executor's clock.
+func (e *Executor) clock() Clock {
+	if e.Clock != nil {
+		return e.Clock
+	}
+	return wallClock{}
+}
+
+// sampleEvery calls sample on every tick of a ticker with period d,
+// and once more when ctx is done. Thus sample is always called at
+// least once.
+func sampleEvery(ctx context.Context, clock Clock, d time.Duration, sample func()) {
+	ticker := clock.NewTicker(d)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+		}
+		sample()
+	}
+}
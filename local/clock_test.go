@@ -0,0 +1,122 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time and ticks are advanced manually.
+// All of its tickers share a single channel.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	c   chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, c: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return &fakeTicker{c.c}
+}
+
+// Tick advances the clock by d and delivers a tick.
+func (c *fakeClock) Tick(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.c <- now
+}
+
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               {}
+
+func TestSampleEvery(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		stats   = make(stats)
+		sampled = make(chan struct{})
+		done    = make(chan struct{})
+		v       float64
+	)
+	go func() {
+		sampleEvery(ctx, clock, time.Minute, func() {
+			v++
+			stats.Observe("disk", v, clock.Now())
+			sampled <- struct{}{}
+		})
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		clock.Tick(time.Minute)
+		<-sampled
+	}
+	// Cancellation produces a final sample.
+	cancel()
+	<-sampled
+	<-done
+
+	if got, want := stats.N("disk"), int64(4); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.Mean("disk"), 2.5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.Var("disk"), 1.25; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.First("disk"), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.Last("disk"), start.Add(3*time.Minute); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStatsClockSkew(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := make(stats)
+	stats.Observe("mem", 1, start)
+	stats.Observe("mem", 2, start.Add(time.Minute))
+	if got, want := stats.Skew(), time.Duration(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The wall clock is stepped back by an hour.
+	stats.Observe("mem", 3, start.Add(time.Minute-time.Hour))
+	if got, want := stats.Last("mem"), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.Skew(), time.Hour; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Monotonic readings measure durations across wall-clock steps.
+	now := time.Now()
+	d, skew := elapsed(now, now.Add(time.Second))
+	if got, want := d, time.Second; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := skew, time.Duration(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// commandScheme is the URL scheme of command interns, which intern
+// the standard output of a command run on the host.
+const commandScheme = "exec"
+
+// parseURL parses an intern or extern URL. Command URLs
+// ("exec://command args") are not valid URLs in general, and are
+// returned with the command in the URL's Opaque field.
+func parseURL(rawurl string) (*url.URL, error) {
+	if prefix := commandScheme + "://"; strings.HasPrefix(rawurl, prefix) {
+		return &url.URL{Scheme: commandScheme, Opaque: strings.TrimPrefix(rawurl, prefix)}, nil
+	}
+	return url.Parse(rawurl)
+}
+
+// checkCommand returns an error if the command URL u may not be used
+// for an exec of the provided type: commands may only be interned,
+// and only if their command is listed in the executor's
+// InternCommands.
+func (e *Executor) checkCommand(typ string, u *url.URL) error {
+	if typ != intern {
+		return errors.E(errors.NotSupported, errors.Errorf("%s is supported only for interns", u.Scheme))
+	}
+	args := strings.Fields(u.Opaque)
+	if len(args) == 0 {
+		return errors.E(errors.Invalid, errors.New("empty intern command"))
+	}
+	for _, name := range e.InternCommands {
+		if name == args[0] {
+			return nil
+		}
+	}
+	return errors.E(errors.NotAllowed, errors.Errorf("command %q may not be interned by this executor", args[0]))
+}
+
+// commandInterner is the InternExterner for command URLs. It runs the
+// command, without a shell, and interns its standard output as the
+// single file ".".
+type commandInterner struct{}
+
+func (commandInterner) Intern(ctx context.Context, u *url.URL, repo *filerepo.Repository) (reflow.Fileset, error) {
+	args := strings.Fields(u.Opaque)
+	if len(args) == 0 {
+		return reflow.Fileset{}, errors.E(errors.Invalid, errors.New("empty intern command"))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.Errorf("%v: %s", err, msg)
+		}
+		return reflow.Fileset{}, errors.E("run", args[0], err)
+	}
+	d, err := repo.Put(ctx, &stdout)
+	if err != nil {
+		return reflow.Fileset{}, err
+	}
+	file, err := repo.Stat(ctx, d)
+	if err != nil {
+		return reflow.Fileset{}, err
+	}
+	return reflow.Fileset{Map: map[string]reflow.File{".": file}}, nil
+}
+
+func (commandInterner) Extern(ctx context.Context, u *url.URL, fs reflow.Fileset, repo *filerepo.Repository) error {
+	return errors.E(errors.NotSupported, errors.Errorf("%s is supported only for interns", u.Scheme))
+}
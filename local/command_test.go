@@ -0,0 +1,66 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestRewriteConfigCommand(t *testing.T) {
+	x := Executor{InternCommands: []string{"echo"}}
+	for _, c := range []struct {
+		typ, url string
+		kind     errors.Kind
+	}{
+		{intern, "exec://echo hello world", errors.Other},
+		{intern, "exec://cat /etc/passwd", errors.NotAllowed},
+		{intern, "exec://", errors.Invalid},
+		{extern, "exec://echo hello", errors.NotSupported},
+	} {
+		cfg := reflow.ExecConfig{Type: c.typ, URL: c.url}
+		err := x.rewriteConfig(&cfg)
+		if c.kind == errors.Other {
+			if err != nil {
+				t.Errorf("%s %s: %v", c.typ, c.url, err)
+			}
+			continue
+		}
+		if !errors.Is(c.kind, err) {
+			t.Errorf("%s %s: got %v, want %v", c.typ, c.url, err, c.kind)
+		}
+	}
+}
+
+func TestCommandIntern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commandintern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{
+		Dir:            dir,
+		FileRepository: &filerepo.Repository{Root: dir + "/objects"},
+		refCounts:      make(map[digest.Digest]refCount),
+	}
+	cfg := reflow.ExecConfig{Type: intern, URL: "exec://echo hello world"}
+	e := newSchemeExec(reflow.Digester.FromString("intern"), x, cfg, commandInterner{})
+	ctx := context.Background()
+	e.Go(ctx)
+	res, err := e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Fileset.Map["."].ID, reflow.Digester.FromString("hello world\n"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
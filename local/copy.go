@@ -0,0 +1,64 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// OutputCopier is implemented by execs whose output files may be
+// streamed directly, without externing them.
+type OutputCopier interface {
+	// CopyTo copies the contents of the output file with the provided
+	// path (as named in the exec's result fileset) to w, returning the
+	// number of bytes copied. The exec must be complete.
+	CopyTo(ctx context.Context, path string, w io.Writer) (int64, error)
+}
+
+// CopyTo implements OutputCopier. Files are read from the exec's
+// staging repository or, once the exec has been promoted, from the
+// executor's repository. The paths of execs with multiple outputs
+// are those of their pulled-up result filesets.
+func (e *dockerExec) CopyTo(ctx context.Context, path string, w io.Writer) (int64, error) {
+	res, err := e.Result(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return copyFile(ctx, e.id, res.Fileset, path, w, &e.staging, e.Executor.FileRepository)
+}
+
+// copyFile copies the file at path in fileset fs, produced by exec id,
+// to w. The file's contents are read from the first of the provided
+// repositories that contains it.
+func copyFile(ctx context.Context, id digest.Digest, fs reflow.Fileset, path string, w io.Writer, repos ...*filerepo.Repository) (int64, error) {
+	file, ok := fs.Pullup().Map[path]
+	if !ok {
+		return 0, errors.E("copy", id, path, errors.NotExist, errors.New("no such output file"))
+	}
+	for _, repo := range repos {
+		if repo == nil {
+			continue
+		}
+		rc, err := repo.Get(ctx, file.ID)
+		if errors.Is(errors.NotExist, err) {
+			continue
+		} else if err != nil {
+			return 0, errors.E("copy", id, path, err)
+		}
+		n, err := io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return n, errors.E("copy", id, path, err)
+		}
+		return n, nil
+	}
+	return 0, errors.E("copy", id, path, errors.NotExist, errors.Errorf("object %v not found", file.ID))
+}
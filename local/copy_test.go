@@ -0,0 +1,50 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestCopyTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copyto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	e := &dockerExec{Executor: &Executor{FileRepository: &filerepo.Repository{Root: filepath.Join(dir, "repo")}}}
+	e.staging.Root = filepath.Join(dir, "staging")
+	if _, err := e.CopyTo(ctx, "out", ioutil.Discard); err == nil {
+		t.Error("expected error for incomplete exec")
+	}
+	id, err := e.staging.Put(ctx, strings.NewReader("hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.State = execComplete
+	e.Manifest.Result.Fileset = reflow.Fileset{Map: map[string]reflow.File{"out": {ID: id, Size: 12}}}
+	var b bytes.Buffer
+	n, err := e.CopyTo(ctx, "out", &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "hello, world"; got != want || n != int64(len(want)) {
+		t.Errorf("got %q (%d bytes), want %q", got, n, want)
+	}
+	if _, err := e.CopyTo(ctx, "missing", &b); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want %v", err, errors.NotExist)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// Compression codecs detected by detectCodec.
+const (
+	codecGzip  = "gzip"
+	codecBzip2 = "bzip2"
+	codecZstd  = "zstd"
+)
+
+var magics = []struct {
+	codec string
+	magic []byte
+}{
+	{codecGzip, []byte{0x1f, 0x8b}},
+	{codecBzip2, []byte("BZh")},
+	{codecZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// detectCodec returns the compression codec of the stream r, as
+// determined by its magic bytes, or an empty string if the stream
+// does not appear to be compressed. The bytes used to detect the
+// codec are not consumed.
+func detectCodec(r *bufio.Reader) string {
+	for _, m := range magics {
+		p, err := r.Peek(len(m.magic))
+		if err == nil && bytes.Equal(p, m.magic) {
+			return m.codec
+		}
+	}
+	return ""
+}
+
+// decompress detects whether the file at path is compressed and, if
+// it is in a supported format, decompresses it into a new temporary
+// file in repo. decompress returns the name of the decompressed file
+// together with the detected codec. If the file is not compressed, an
+// empty filename and codec are returned. If the file cannot be
+// decoded with its detected codec, as is the case for uncompressed
+// files that happen to begin with a codec's magic bytes, an empty
+// filename is returned together with the codec. The supported codecs
+// are gzip and bzip2; decompress returns an errors.NotSupported error
+// for files compressed with other detected codecs.
+func decompress(path string, repo *filerepo.Repository) (filename, codec string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	codec = detectCodec(br)
+	var r io.Reader
+	switch codec {
+	case "":
+		return "", "", nil
+	case codecGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", codec, nil
+		}
+		defer gz.Close()
+		r = gz
+	case codecBzip2:
+		r = bzip2.NewReader(br)
+	default:
+		return "", codec, errors.E(errors.NotSupported, errors.Errorf("%s decompression is not supported", codec))
+	}
+	out, err := repo.TempFile("decompress")
+	if err != nil {
+		return "", "", err
+	}
+	w := &errWriter{w: out}
+	if _, err := io.Copy(w, r); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		if w.err == nil {
+			// Reading from the file itself does not fail in practice,
+			// and would fail again when it is installed.
+			return "", codec, nil
+		}
+		return "", "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	return out.Name(), codec, nil
+}
+
+// errWriter is an io.Writer that records the first error returned
+// by the underlying writer, so that it can be distinguished from
+// errors reading the data that is written.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
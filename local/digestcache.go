@@ -0,0 +1,192 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/log"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// digestCacheFile is the path (relative to the executor's directory)
+// of the digest cache's checkpoint log.
+const digestCacheFile = "digests.json"
+
+// A digestEntry records the digest of a file at a given path, size
+// and modification time, as computed with a given block size (see
+// filerepo.Repository.BlockSize). The digest of a file larger than
+// the block size is its block digest.
+type digestEntry struct {
+	Path      string
+	Size      int64
+	ModTime   time.Time
+	BlockSize int64 `json:",omitempty"`
+	ID        digest.Digest
+}
+
+// A digestCache remembers the digests of local files that have been
+// interned, so that interning them again does not require
+// rehashing. The cache is checkpointed to an append-only log: each
+// digest is recorded as soon as it is computed, so that progress
+// made by an intern that subsequently fails is retained.
+//
+// Files are assumed to be unchanged if their size and modification
+// time are unchanged. A nil *digestCache caches nothing.
+type digestCache struct {
+	path string
+	log  *log.Logger
+	// compare enables the reuse of digests of modified files through
+	// Reuse.
+	compare bool
+
+	once    sync.Once
+	mu      sync.Mutex
+	entries map[string]digestEntry
+	w       *os.File
+}
+
+func newDigestCache(path string, log *log.Logger) *digestCache {
+	return &digestCache{path: path, log: log}
+}
+
+// load reads the cache's checkpoint log, if any, and opens it for
+// appending. Later entries supersede earlier ones.
+func (c *digestCache) load() {
+	c.entries = make(map[string]digestEntry)
+	if f, err := os.Open(c.path); err == nil {
+		dec := json.NewDecoder(f)
+		for {
+			var entry digestEntry
+			if err := dec.Decode(&entry); err != nil {
+				if err != io.EOF {
+					// A partially written final entry is expected if
+					// the executor died while appending.
+					c.log.Debugf("digest cache %s: %v", c.path, err)
+				}
+				break
+			}
+			c.entries[entry.Path] = entry
+		}
+		f.Close()
+	}
+	var err error
+	c.w, err = os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		c.log.Errorf("digest cache %s: %v", c.path, err)
+	}
+}
+
+// Lookup returns the cached digest of the file at path with the
+// provided file info, as computed with the provided block size.
+func (c *digestCache) Lookup(path string, info os.FileInfo, blockSize int64) (digest.Digest, bool) {
+	if c == nil {
+		return digest.Digest{}, false
+	}
+	c.once.Do(c.load)
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	c.mu.Unlock()
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) || entry.BlockSize != blockSize {
+		return digest.Digest{}, false
+	}
+	return entry.ID, true
+}
+
+// Reuse returns the cached digest of a file at path whose
+// modification time, but not size, has changed since it was
+// digested, if the cache was created with comparison enabled and the
+// file is unchanged: repo must contain the object named by the
+// file's cached digest, and the object's contents must be identical
+// to the file's. The comparison reads both in full, but avoids
+// rehashing the file.
+func (c *digestCache) Reuse(path string, info os.FileInfo, repo *filerepo.Repository) (digest.Digest, bool) {
+	if c == nil || !c.compare {
+		return digest.Digest{}, false
+	}
+	c.once.Do(c.load)
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	c.mu.Unlock()
+	if !ok || entry.Size != info.Size() || entry.BlockSize != repo.BlockSize {
+		return digest.Digest{}, false
+	}
+	_, objPath := repo.Path(entry.ID)
+	objInfo, err := os.Stat(objPath)
+	// If the object is a link to the file itself, then it shares the
+	// file's modifications and cannot be used to verify it.
+	if err != nil || objInfo.Size() != entry.Size || os.SameFile(info, objInfo) {
+		return digest.Digest{}, false
+	}
+	match, err := contentsMatch(path, objPath)
+	if err != nil {
+		c.log.Debugf("digest cache: compare %s: %v", path, err)
+		return digest.Digest{}, false
+	}
+	return entry.ID, match
+}
+
+// compareBufferSize is the size of the buffers with which
+// contentsMatch reads each file.
+const compareBufferSize = 1 << 20
+
+// contentsMatch tells whether the files at paths p and q have
+// identical contents.
+func contentsMatch(p, q string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	g, err := os.Open(q)
+	if err != nil {
+		return false, err
+	}
+	defer g.Close()
+	var (
+		fbuf = make([]byte, compareBufferSize)
+		gbuf = make([]byte, compareBufferSize)
+	)
+	for {
+		n, ferr := io.ReadFull(f, fbuf)
+		m, gerr := io.ReadFull(g, gbuf)
+		if n != m || !bytes.Equal(fbuf[:n], gbuf[:m]) {
+			return false, nil
+		}
+		switch {
+		case ferr == io.EOF || ferr == io.ErrUnexpectedEOF:
+			return gerr == io.EOF || gerr == io.ErrUnexpectedEOF, nil
+		case ferr != nil:
+			return false, ferr
+		case gerr != nil:
+			return false, gerr
+		}
+	}
+}
+
+// Record checkpoints the digest id of the file at path with the
+// provided file info, as computed with the provided block size.
+func (c *digestCache) Record(path string, info os.FileInfo, blockSize int64, id digest.Digest) {
+	if c == nil {
+		return
+	}
+	c.once.Do(c.load)
+	entry := digestEntry{path, info.Size(), info.ModTime(), blockSize, id}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = entry
+	if c.w == nil {
+		return
+	}
+	if err := json.NewEncoder(c.w).Encode(entry); err != nil {
+		c.log.Errorf("digest cache %s: %v", c.path, err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestDigestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digestcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := filepath.Join(dir, "data")
+	if err := os.MkdirAll(data, 0777); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(data, "a")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		ctx       = context.Background()
+		x         Executor
+		repo      = &filerepo.Repository{Root: filepath.Join(dir, "objects")}
+		cachePath = filepath.Join(dir, digestCacheFile)
+		cache     = newDigestCache(cachePath, nil)
+		want      = reflow.Digester.FromString("hello")
+	)
+	fs, err := x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The checkpoint is persisted.
+	if id, ok := newDigestCache(cachePath, nil).Lookup(path, info, 0); !ok || id != want {
+		t.Errorf("got %v, %v, want %v, true", id, ok, want)
+	}
+	if _, ok := cache.Lookup(path, info, 1<<20); ok {
+		t.Error("expected cache miss for different block size")
+	}
+
+	// Cached digests are used without rehashing.
+	bogus := reflow.Digester.FromString("bogus")
+	cache.Record(path, info, 0, bogus)
+	fs, err = x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got != bogus {
+		t.Errorf("got %v, want %v", got, bogus)
+	}
+
+	// Modified files are rehashed.
+	mtime := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fs, err = x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDigestCacheReuse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digestcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := filepath.Join(dir, "data")
+	if err := os.MkdirAll(data, 0777); err != nil {
+		t.Fatal(err)
+	}
+	const size = 300 << 10
+	contents := make([]byte, size)
+	rand.New(rand.NewSource(0)).Read(contents)
+	path := filepath.Join(data, "a")
+	// rewrite replaces the file at path with a new file (and inode)
+	// whose contents differ from the original at offset off, unless
+	// off is negative.
+	rewrite := func(off int) {
+		t.Helper()
+		p := append([]byte{}, contents...)
+		if off >= 0 {
+			p[off]++
+		}
+		tmp := filepath.Join(dir, "tmp")
+		if err := ioutil.WriteFile(tmp, p, 0666); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(off+size) * time.Second)
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path, contents, 0666); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		ctx   = context.Background()
+		x     Executor
+		repo  = &filerepo.Repository{Root: filepath.Join(dir, "objects")}
+		cache = newDigestCache(filepath.Join(dir, digestCacheFile), nil)
+		want  = reflow.Digester.FromBytes(contents)
+	)
+	cache.compare = true
+	fs, err := x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// An unmodified copy of the file reuses its digest.
+	rewrite(-1)
+	reused := func() bool {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok := cache.Reuse(path, info, repo)
+		return ok
+	}
+	if !reused() {
+		t.Error("expected digest to be reused")
+	}
+	fs, err = x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Any modification causes the file to be rehashed, even away from
+	// the start, middle and end of the file.
+	rewrite(90 << 10)
+	if reused() {
+		t.Error("expected digest not to be reused")
+	}
+	fs, err = x.install(ctx, data, false, repo, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Map["a"].ID; got == want {
+		t.Errorf("expected modified file to be rehashed")
+	}
+}
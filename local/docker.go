@@ -14,6 +14,8 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,11 +26,13 @@ import (
 	"docker.io/go-docker/api/types/container"
 	"docker.io/go-docker/api/types/network"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/digest"
 	"github.com/grailbio/base/retry"
 	"github.com/grailbio/base/sync/once"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/walker"
 	"github.com/grailbio/reflow/log"
 	"github.com/grailbio/reflow/repository/filerepo"
 )
@@ -37,6 +41,7 @@ import (
 //	<exec>/arg/n/m...
 //	<exec>/out
 //	<exec>/manifest.json	--	contains final output, only after things are done.
+//	<exec>/quota/{tmp,return}	--	scratch space of execs with disk quotas.
 const (
 	inspectPath  = "inspect.json"
 	manifestPath = "manifest.json"
@@ -45,6 +50,17 @@ const (
 
 var dockerUser = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
 
+// defaultStopTimeout is the time given to containers that are
+// stopped gracefully to exit before they are killed.
+const defaultStopTimeout = 10 * time.Second
+
+// stopLabel labels containers that are to be stopped gracefully.
+const stopLabel = "reflow-graceful-stop"
+
+// dockerSocket is the path of the Docker daemon's socket, both on the
+// host and, when ExecConfig.MountDockerSocket is set, in the container.
+const dockerSocket = "/var/run/docker.sock"
+
 // dockerExec is a (local) exec attached to a local executor, from which it
 // is given its own subdirectory to operate. exec is responsible for
 // the lifecycle of an exec through an executor. It maintains a state
@@ -71,6 +87,19 @@ type dockerExec struct {
 	Manifest
 	err         error
 	promoteOnce once.Task
+
+	// cancel cancels the exec's state machine; aborted is set when
+	// the exec is aborted. See Abort.
+	cancel  context.CancelFunc
+	aborted bool
+
+	// inputs are the digests of the shared inputs acquired by the
+	// exec; see Executor.SharedInputs.
+	inputs []digest.Digest
+
+	// diskExceeded describes the first sample in which the exec
+	// exceeded its disk resource; see Executor.VerifyDisk.
+	diskExceeded string
 }
 
 var retryPolicy = retry.MaxTries(retry.Backoff(time.Second, 10*time.Second, 1.5), 5)
@@ -88,10 +117,12 @@ func newDockerExec(id digest.Digest, x *Executor, cfg reflow.ExecConfig, stdout,
 		stderr: stderr,
 	}
 	e.staging.Root = e.path(objectsDir)
+	e.staging.BlockSize = x.DigestBlockSize
 	e.staging.Log = e.Log
 	e.Config = cfg
 	e.Manifest.Type = execDocker
 	e.Manifest.Created = time.Now()
+	e.Manifest.Version = x.Version
 	e.cond = sync.NewCond(&e.mu)
 	return e
 }
@@ -128,6 +159,65 @@ func (e *dockerExec) containerName() string {
 	return fmt.Sprintf("reflow-%s-%s-%s", e.Executor.ID, e.id.Hex(), pathHex)
 }
 
+// ContainerExec is implemented by execs that run in a Docker
+// container.
+type ContainerExec interface {
+	// ContainerID returns the ID of the exec's Docker container, and
+	// whether the container has been created. It may be called in any
+	// state.
+	ContainerID() (string, bool)
+}
+
+// ContainerID implements ContainerExec. The ID is that of the exec's
+// most recently created container: an exec that is retried after
+// running out of memory is given a new container.
+func (e *dockerExec) ContainerID() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.Manifest.ContainerID
+	if id == "" && e.Manifest.Docker.ContainerJSONBase != nil {
+		// Execs created by earlier versions of the executor record
+		// only the inspect output.
+		id = e.Manifest.Docker.ID
+	}
+	return id, id != ""
+}
+
+// pullImage ensures that the exec's image, by reference image, is
+// present, retrying failed pulls. If the executor has a PullTimeout,
+// pullImage fails with an errors.Timeout error once the pull phase
+// exceeds it.
+func (e *dockerExec) pullImage(ctx context.Context, image string) error {
+	pullCtx := ctx
+	if timeout := e.Executor.PullTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		pullCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for retries := 0; ; retries++ {
+		err := e.Executor.ensureImage(pullCtx, image, e.Executor.platform(e.Config.Platform), e.Config.PullPolicy)
+		if err == nil {
+			return nil
+		}
+		e.Log.Errorf("error ensuring image %s: %v", image, err)
+		if e.Config.PullPolicy == reflow.PullNever {
+			// The image will not appear by itself, so there is no point in retrying.
+			return errors.E("ensureImage", image, err)
+		}
+		if errors.Is(errors.NotAllowed, err) {
+			// Nor will the image shrink.
+			return err
+		}
+		if err := retry.Wait(pullCtx, retryPolicy, retries); err != nil {
+			if ctx.Err() == nil && pullCtx.Err() == context.DeadlineExceeded {
+				return errors.E("ImagePull", image, errors.Timeout,
+					errors.Errorf("image pull did not complete within %s", e.Executor.PullTimeout))
+			}
+			return errors.E(errors.Unavailable, fmt.Sprintf("failed to pull image %s: %s", image, err))
+		}
+	}
+}
+
 // create sets up the exec's filesystem layout environment and
 // instantiates its container. It is not run. The arguments are
 // materialized to a the 'arg' directory in the exec's run directory,
@@ -141,25 +231,41 @@ func (e *dockerExec) containerName() string {
 // associated with interns and externs).
 func (e *dockerExec) create(ctx context.Context) (execState, error) {
 	if _, err := e.client.ContainerInspect(ctx, e.containerName()); err == nil {
-		return execCreated, nil
+		return execCreated, e.acquireInputs()
 	} else if !docker.IsErrNotFound(err) {
 		return execInit, errors.E("ContainerInspect", e.containerName(), kind(err), err)
 	}
-	// TODO: it might be worthwhile doing image pulling as a separate state.
-	for retries := 0; ; retries++ {
-		err := e.Executor.ensureImage(ctx, e.Config.Image)
-		if err == nil {
-			break
-		}
-		e.Log.Errorf("error ensuring image %s: %v", e.Config.Image, err)
-		if err := retry.Wait(ctx, retryPolicy, retries); err != nil {
-			return execInit, errors.E(errors.Unavailable, fmt.Sprintf("failed to pull image %s: %s", e.Config.Image, err))
+	image := e.Config.Image
+	if e.Executor.RequireSignedImages {
+		var err error
+		if image, err = signedImage(ctx, image); err != nil {
+			return execInit, errors.E("exec", e.id, err)
 		}
 	}
+	e.Executor.emit(e.id, ExecPulling, nil)
+	// TODO: it might be worthwhile doing image pulling as a separate state.
+	if err := e.pullImage(ctx, image); err != nil {
+		return execInit, err
+	}
+	// The Docker API does not let us specify the platform of the
+	// image with which a container is created, so instead we verify
+	// that the image is for the exec's platform; images for other
+	// platforms fail with exec format errors.
+	platform := e.Executor.platform(e.Config.Platform)
+	if have, err := imagePlatform(ctx, e.client, image); err != nil {
+		return execInit, errors.E("ImageInspect", image, kind(err), err)
+	} else if !platformMatches(have, platform) {
+		return execInit, errors.E("exec", e.id, errors.NotSupported,
+			errors.Errorf("image %s is for platform %s, not %s", image, have, platform))
+	}
 	// Map the products to input arguments and volume bindings for
 	// the container. Currently we map the whole repository (named by
 	// the digest) and then include the cut in the arguments passed to
 	// the job.
+	if err := e.acquireInputs(); err != nil {
+		return execInit, err
+	}
+	var inputBinds []string
 	args := make([]interface{}, len(e.Config.Args))
 	for i, iv := range e.Config.Args {
 		if iv.Out {
@@ -170,6 +276,15 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 			argv := make([]string, len(flat))
 			for j, jv := range flat {
 				argPath := fmt.Sprintf("arg/%d/%d", i, j)
+				argv[j] = "/" + argPath
+				if e.Executor.SharedInputs && shareable(jv) {
+					// The bind's mount point.
+					if err := os.MkdirAll(e.path(argPath), 0777); err != nil {
+						return execInit, err
+					}
+					inputBinds = append(inputBinds, e.Executor.inputHostPath(jv.Digest())+":/"+argPath+":ro")
+					continue
+				}
 				binds := map[string]digest.Digest{}
 				for path, file := range jv.Map {
 					binds[path] = file.ID
@@ -177,26 +292,55 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 				if err := e.repo.Materialize(e.path(argPath), binds); err != nil {
 					return execInit, err
 				}
-				argv[j] = "/" + argPath
 			}
 			args[i] = strings.Join(argv, " ")
 		}
 	}
+	if e.hasQuota() {
+		if err := e.mountQuota(ctx); err != nil {
+			return execInit, err
+		}
+	}
 	// Set up temporary directory.
-	os.MkdirAll(e.path("tmp"), 0777)
-	os.MkdirAll(e.path("return"), 0777)
+	os.MkdirAll(e.scratchPath("tmp"), 0777)
+	os.MkdirAll(e.returnPath(), 0777)
+	binds := []string{
+		e.hostPath("arg") + ":/arg",
+		e.returnHostPath() + ":/return",
+	}
+	binds = append(binds, inputBinds...)
+	var tmpfs map[string]string
+	if opts := e.Config.TmpfsOptions; opts != nil {
+		tmpfs = map[string]string{"/tmp": opts.String()}
+	} else {
+		binds = append(binds, e.scratchHostPath("tmp")+":/tmp")
+	}
+	if e.Config.MountDockerSocket && e.Executor.AllowDockerSocketMount {
+		binds = append(binds, dockerSocket+":"+dockerSocket)
+	}
 	hostConfig := &container.HostConfig{
-		Binds: []string{
-			e.hostPath("arg") + ":/arg",
-			e.hostPath("tmp") + ":/tmp",
-			e.hostPath("return") + ":/return",
-		},
+		Binds:       binds,
+		Tmpfs:       tmpfs,
 		NetworkMode: container.NetworkMode("host"),
 		// Try to ensure that jobs we control get killed before the reflowlet,
 		// so that we don't lose adjacent tasks unnecessarily and so that
 		// errors are more sensible to the user.
 		OomScoreAdj: 1000,
 	}
+	if size := e.Config.ShmSize; size > 0 {
+		hostConfig.ShmSize = size
+	} else if size := e.Executor.ShmSize; size > 0 {
+		hostConfig.ShmSize = size
+	}
+	if e.Executor.Offline {
+		hostConfig.NetworkMode = container.NetworkMode("none")
+	}
+	hostConfig.Runtime = e.Executor.runtime(e.Config)
+	if e.Executor.useInit(e.Config) {
+		init := true
+		hostConfig.Init = &init
+	}
+	hostConfig.CapAdd, hostConfig.CapDrop = e.Executor.capabilities(e.Config)
 
 	// Restrict docker memory usage if specified by the user.
 	// If the docker container memory limit (the cgroup limit) is exceeded
@@ -207,10 +351,23 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 	// able to swap up to twice the amount of memory set in the memory limit.
 	// In order to ensure that Memory is set to a hard limit, MemorySwap is also
 	// set equal to memory.
-	if mem := e.Config.Resources["mem"]; mem > 0 && e.Executor.HardMemLimit {
+	if mem := e.resources()["mem"]; mem > 0 && e.Executor.HardMemLimit {
+		hostConfig.Resources.Memory = int64(mem)
+		hostConfig.Resources.MemorySwap = int64(mem)
+	}
+	// Explicit limits take precedence over the requested resources.
+	if mem := e.memoryLimit(); mem > 0 {
 		hostConfig.Resources.Memory = int64(mem)
 		hostConfig.Resources.MemorySwap = int64(mem)
 	}
+	if cpu := e.Config.Limits["cpu"]; cpu > 0 {
+		hostConfig.Resources.NanoCPUs = int64(cpu * 1e9)
+	}
+	if n := e.Config.PidsLimit; n > 0 {
+		hostConfig.Resources.PidsLimit = n
+	} else if n := e.Executor.PidsLimit; n > 0 {
+		hostConfig.Resources.PidsLimit = n
+	}
 
 	env := []string{
 		"tmp=/tmp",
@@ -220,10 +377,13 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 	if outputs := e.Config.OutputIsDir; outputs != nil {
 		for i, isdir := range outputs {
 			if isdir {
-				os.MkdirAll(e.path("return", strconv.Itoa(i)), 0777)
+				os.MkdirAll(e.returnPath(strconv.Itoa(i)), 0777)
 			}
 		}
 	} else {
+		if e.Config.OutputMode == reflow.OutputDir {
+			os.MkdirAll(e.returnPath("default"), 0777)
+		}
 		env = append(env, "out=/return/default")
 	}
 	// TODO(marius): this is a hack for Earl to use the AWS tool.
@@ -240,18 +400,35 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 		env = append(env, "AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey)
 		env = append(env, "AWS_SESSION_TOKEN="+creds.SessionToken)
 	}
+	// We use a login shell here as many Docker images are configured
+	// with /root/.profile, etc.
+	cmd := fmt.Sprintf(e.Config.Cmd, args...)
+	if e.Config.MergeStderr {
+		cmd = "exec 2>&1\n" + cmd
+	}
+	if umask := e.umask(); umask != "" {
+		cmd = "umask " + umask + "\n" + cmd
+	}
+	entrypoint := e.wrap([]string{"/bin/bash", "-e", "-l", "-o", "pipefail", "-c", cmd})
 	config := &container.Config{
-		Image: e.Config.Image,
-		// We use a login shell here as many Docker images are configured
-		// with /root/.profile, etc.
-		Entrypoint: []string{"/bin/bash", "-e", "-l", "-o", "pipefail", "-c", fmt.Sprintf(e.Config.Cmd, args...)},
+		Image:      image,
+		Entrypoint: entrypoint,
 		Cmd:        []string{},
 		Env:        env,
 		Labels:     map[string]string{"reflow-id": e.id.Hex()},
 		User:       dockerUser,
+		StopSignal: e.Config.StopSignal,
+		Hostname:   e.Config.Hostname,
+	}
+	if e.stopsGracefully() {
+		timeout := int(e.stopTimeout().Seconds())
+		config.StopTimeout = &timeout
+		config.Labels[stopLabel] = "true"
 	}
 	networkingConfig := &network.NetworkingConfig{}
-	if _, err := e.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, e.containerName()); err != nil {
+	e.Manifest.Attempts++
+	resp, err := e.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, e.containerName())
+	if err != nil {
 		return execInit, errors.E(
 			"ContainerCreate",
 			kind(err),
@@ -260,9 +437,36 @@ func (e *dockerExec) create(ctx context.Context) (execState, error) {
 			err,
 		)
 	}
+	e.mu.Lock()
+	e.Manifest.ContainerID = resp.ID
+	e.mu.Unlock()
 	return execCreated, nil
 }
 
+// wrap prefixes entrypoint with the exec's wrapper, if any.
+func (e *dockerExec) wrap(entrypoint []string) []string {
+	wrapper := e.Config.Wrapper
+	if len(wrapper) == 0 {
+		return entrypoint
+	}
+	// The wrapper is not run by a shell, so we substitute $tmp here.
+	argv := make([]string, len(wrapper), len(wrapper)+len(entrypoint))
+	for i, arg := range wrapper {
+		argv[i] = expandTmp(arg)
+	}
+	return append(argv, entrypoint...)
+}
+
+// tmpVar matches references to the variable tmp, as $tmp or ${tmp}.
+var tmpVar = regexp.MustCompile(`\$(\{tmp\}|tmp\b)`)
+
+// expandTmp expands references to $tmp in arg to the container's
+// temporary directory, leaving the rest of arg, including other
+// variables, intact.
+func expandTmp(arg string) string {
+	return tmpVar.ReplaceAllLiteralString(arg, "/tmp")
+}
+
 func scanLines(input io.ReadCloser, output *log.Logger) error {
 	r, w := io.Pipe()
 	go func() {
@@ -281,6 +485,10 @@ func (e *dockerExec) start(ctx context.Context) (execState, error) {
 	if err := e.client.ContainerStart(ctx, e.containerName(), types.ContainerStartOptions{}); err != nil {
 		return execCreated, errors.E("ContainerStart", e.containerName(), kind(err), err)
 	}
+	if onStart := e.Executor.OnStart; onStart != nil {
+		onStart(e.id, time.Since(e.Manifest.Created))
+	}
+	e.Executor.emit(e.id, ExecStarted, nil)
 	var err error
 	e.Docker, err = e.client.ContainerInspect(ctx, e.containerName())
 	e.Manifest.PID = e.Docker.State.Pid
@@ -321,19 +529,62 @@ func (e *dockerExec) start(ctx context.Context) (execState, error) {
 	return execRunning, nil
 }
 
+// tmpLogName is the name of the file in an exec's $tmp to which its
+// logs are teed; see reflow.ExecConfig.TmpLog.
+const tmpLogName = ".log"
+
+// streamTmpLog writes the container's logs, as they are produced, to
+// the exec's $tmp log, until the container exits or ctx is done. The
+// log is written from the container's start, so that it is complete
+// also when streaming resumes after an executor restart.
+func (e *dockerExec) streamTmpLog(ctx context.Context) error {
+	rc, err := e.client.ContainerLogs(ctx, e.containerName(),
+		types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return errors.E("ContainerLogs", e.containerName(), kind(err), err)
+	}
+	defer rc.Close()
+	f, err := os.Create(filepath.Join(e.scratchPath("tmp"), tmpLogName))
+	if err != nil {
+		return err
+	}
+	_, err = stdcopy.StdCopy(f, f, rc)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // wait waits for the container complete and performs teardown:
 // - save log files to the exec directory;
 // - inspect the docker container and save its output to exec.Manifest.Docker;
 // - install the results into the repository;
 // - remove (de-link) the argument directory.
 func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
+	// Execs restored by a restarted executor must reacquire their
+	// shared inputs, so that they are released when the exec completes.
+	if err := e.acquireInputs(); err != nil {
+		return execInit, err
+	}
 	// We start profiling here. Note that if the executor is restarted,
 	// and thus reattaches to the container, it will lose samples.
-	profc := make(chan stats)
+	profc := make(chan stats, 1)
 	profctx, cancelprof := context.WithCancel(ctx)
-	go func() {
-		profc <- e.profile(profctx)
-	}()
+	if e.Config.NoProfile {
+		profc <- nil
+	} else {
+		go func() {
+			profc <- e.profile(profctx)
+		}()
+	}
+	logc := make(chan error, 1)
+	if e.Config.TmpLog {
+		go func() {
+			logc <- e.streamTmpLog(ctx)
+		}()
+	} else {
+		logc <- nil
+	}
 
 	// The documentation for ContainerWait seems to imply that both channels will
 	// be sent. In practice it's one or the other, and it's also not buffered. Cool API.
@@ -346,6 +597,10 @@ func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
 	case resp := <-respc:
 		code = resp.StatusCode
 	}
+	// The log stream ends once the container has exited.
+	if err := <-logc; err != nil {
+		e.Log.Errorf("failed to tee logs to $tmp/%s: %v", tmpLogName, err)
+	}
 	// Best-effort writing of log files.
 	rc, err := e.client.ContainerLogs(
 		ctx, e.containerName(),
@@ -379,6 +634,13 @@ func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
 	// Retrieve the profile before we clean up the results.
 	cancelprof()
 	e.Manifest.Stats = <-profc
+	if skew := e.Manifest.Stats.Skew(); skew > 0 {
+		warning := fmt.Sprintf("wall clock skewed by %s while profiling; profile times are derived from the monotonic clock", skew)
+		e.mu.Lock()
+		e.Manifest.Warnings = append(e.Manifest.Warnings, warning)
+		e.mu.Unlock()
+		e.Log.Printf("warning: %s", warning)
+	}
 
 	if err != nil {
 		return execInit, errors.E("ContainerInspect", e.containerName(), kind(err), err)
@@ -411,6 +673,10 @@ func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
 	// TODO(marius): either upgrade to Docker/Moby 1.13, or else add
 	// some sort of epoch detection (Docker isn't helpful here either,
 	// but system start time might be a good proxy.)
+	var quotaErr error
+	if code != 0 {
+		quotaErr = e.quotaExceeded()
+	}
 	switch {
 	// ContainerWait returns while the container is in running state
 	// (explicitly, or without a finish time). This happens during
@@ -420,25 +686,63 @@ func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
 			"exec", e.id, errors.Temporary,
 			errors.New("container returned in running state; docker daemon likely shutting down"))
 	// The remaining appear to be true completions.
+	case code == 0 && e.Executor.StrictDisk && e.diskExceeded != "":
+		e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, errors.ResourcesExhausted, errors.New(e.diskExceeded)))
 	case code == 0:
-		if err := e.install(ctx); err != nil {
+		if err := e.install(ctx); errors.Is(errors.ResourcesExhausted, err) {
+			e.Manifest.Result.Fileset = reflow.Fileset{}
+			e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, err))
+		} else if err != nil {
 			return execInit, err
+		} else if err := checkOutput(e.Config, e.Manifest.Result.Fileset); err != nil {
+			e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, err))
 		}
 	// Note: /dev/kmsg only exists on linux. If the container is running on a non-linux machine isOOMSystem will
 	// always return false.
 	case e.Docker.State.OOMKilled || e.isOOMSystem():
+		if e.retryOOM(ctx) {
+			return execInit, nil
+		}
 		e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, errors.OOM, errors.New("killed by the OOM killer")))
+	case quotaErr != nil:
+		e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, errors.ResourcesExhausted,
+			errors.Errorf("exited with code %d: %v", code, quotaErr)))
 	default:
 		e.Manifest.Result.Err = errors.Recover(errors.E("exec", e.id, errors.Errorf("exited with code %d", code)))
 	}
+	if code != 0 && e.Manifest.Result.Err != nil && e.Config.SalvageOutputs {
+		e.salvageOutputs(ctx)
+	}
+
+	// Retain a snapshot of $tmp for failed execs, so that intermediate
+	// files may be inspected after the fact.
+	if e.Manifest.Result.Err != nil {
+		if err := e.saveTmpSnapshot(ctx); err != nil {
+			e.Log.Errorf("failed to snapshot tmpdir: %v", err)
+		}
+	}
 
 	// Clean up args. TODO(marius): replace these with symlinks to sha256s also?
 	if err := os.RemoveAll(e.path("arg")); err != nil {
 		e.Log.Errorf("failed to remove arg path: %v", err)
 	}
-	if err := os.RemoveAll(e.path("tmp")); err != nil {
+	e.releaseInputs()
+	retainTmp := e.Executor.TmpRetention.retain(e.Manifest.Result.Err)
+	if retainTmp {
+		e.Log.Debugf("retaining tmpdir %s", e.scratchPath("tmp"))
+	} else if err := os.RemoveAll(e.scratchPath("tmp")); err != nil {
 		e.Log.Errorf("failed to remove tmpdir: %v", err)
 	}
+	if err := e.removeTmpfsOutputs(); err != nil {
+		e.Log.Errorf("failed to remove tmpfs outputs: %v", err)
+	}
+	// The quota filesystem is released once the outputs are installed,
+	// unless they are yet to be digested, or $tmp is retained.
+	if !retainTmp && !e.Config.LazyDigests {
+		if err := e.unmountQuota(); err != nil {
+			e.Log.Errorf("failed to unmount disk quota: %v", err)
+		}
+	}
 	return execComplete, nil
 }
 
@@ -449,6 +753,11 @@ func (e *dockerExec) wait(ctx context.Context) (state execState, err error) {
 // mem: Memory usage in bytes.
 // tmp: Disk usage in the tmp directory in bytes.
 // disk: Total disk usage of the return directory in bytes.
+// outmem: Memory usage of the return directory in bytes, if the
+// exec's outputs are backed by tmpfs; out and disk are then not
+// profiled.
+// gpu, gpumem: GPU utilization (in GPUs) and GPU memory usage in
+// bytes, if the executor profiles GPUs.
 // Note that profile logs all its errors to e.Log.Error
 // and does not return an error. It simply attempts
 // to profile resources until ctx is cancelled.
@@ -458,9 +767,17 @@ func (e *dockerExec) profile(ctx context.Context) stats {
 		mu     sync.Mutex
 		stats  = make(stats)
 		gauges = make(reflow.Gauges)
-		paths  = map[string]string{"tmp": e.path("tmp"), "disk": e.path("return")}
+		paths  = map[string]string{"tmp": e.scratchPath("tmp")}
+		watch  = newThresholdWatcher(e.Executor, e.id, e.resources())
+		clock  = e.Executor.clock()
 	)
 
+	if e.Config.OutputTmpfs {
+		paths["outmem"] = e.returnPath()
+	} else {
+		paths["out"] = e.returnPath()
+	}
+
 	// Profile the disk usage every minute.
 	wg.Add(1)
 	go func() {
@@ -468,13 +785,7 @@ func (e *dockerExec) profile(ctx context.Context) stats {
 		// This means that disk will always be profiled at least once, regardless of when
 		// ctx is canceled.
 		defer wg.Done()
-		ticker := time.NewTicker(time.Minute)
-		defer ticker.Stop()
-		for ctx.Err() == nil {
-			select {
-			case <-ticker.C:
-			case <-ctx.Done():
-			}
+		sampleEvery(ctx, clock, time.Minute, func() {
 			// Find disk usage in "tmp" and "return" directories.
 			for k, v := range paths {
 				n, err := du(v)
@@ -482,16 +793,26 @@ func (e *dockerExec) profile(ctx context.Context) stats {
 					e.Log.Errorf("du %s: %v", v, err)
 					continue
 				}
+				now := clock.Now()
 				mu.Lock()
-				stats.Observe(k, float64(n))
+				stats.Observe(k, float64(n), now)
 				gauges[k] = float64(n)
+				if k == "out" {
+					// The exec's disk usage, which is accounted against its
+					// "disk" resource, is that of its outputs.
+					stats.Observe("disk", float64(n), now)
+					gauges["disk"] = float64(n)
+				}
 				mu.Unlock()
 			}
 
 			mu.Lock()
-			e.Manifest.Gauges = gauges.Snapshot()
+			snapshot := gauges.Snapshot()
+			e.Manifest.Gauges = snapshot
 			mu.Unlock()
-		}
+			watch.Observe(snapshot)
+			e.verifyDisk(snapshot)
+		})
 	}()
 
 	// Profile CPU and memory.
@@ -535,20 +856,57 @@ func (e *dockerExec) profile(ctx context.Context) stats {
 				// and so needs to be multiplied by the number of CPUs to get a
 				// portable load number.
 				load := ncpu * deltaCPU / deltaSys
-				stats.Observe("cpu", load)
+				stats.Observe("cpu", load, clock.Now())
 				gauges["cpu"] = load
 			}
 			// We exclude page cache memory since this is not counted towards
 			// your limits.
 			mem := float64(v.MemoryStats.Usage - v.MemoryStats.Stats["cache"])
 
-			stats.Observe("mem", mem)
+			stats.Observe("mem", mem, clock.Now())
 			gauges["mem"] = mem
-			e.Manifest.Gauges = gauges.Snapshot()
+			snapshot := gauges.Snapshot()
+			e.Manifest.Gauges = snapshot
 			mu.Unlock()
+			watch.Observe(snapshot)
 		}
 	}()
 
+	// Profile GPU utilization and memory of the container's processes.
+	if e.Executor.ProfileGPU {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sampleEvery(ctx, clock, 10*time.Second, func() {
+				// The container is gone once ctx is done.
+				if ctx.Err() != nil {
+					return
+				}
+				pids, err := e.containerPIDs(ctx)
+				if err != nil {
+					e.Log.Errorf("top %s: %v", e.containerName(), err)
+					return
+				}
+				usage, err := sampleGPU(ctx)
+				if err != nil {
+					e.Log.Errorf("nvidia-smi: %v", err)
+					return
+				}
+				total := gpuUsageOf(usage, pids)
+				now := clock.Now()
+				mu.Lock()
+				stats.Observe("gpu", total.Util, now)
+				stats.Observe("gpumem", total.Mem, now)
+				gauges["gpu"] = total.Util
+				gauges["gpumem"] = total.Mem
+				snapshot := gauges.Snapshot()
+				e.Manifest.Gauges = snapshot
+				mu.Unlock()
+				watch.Observe(snapshot)
+			})
+		}()
+	}
+
 	wg.Wait()
 	return stats
 }
@@ -569,6 +927,11 @@ func (e *dockerExec) Go(ctx context.Context) {
 			}()
 		}
 	*/
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.mu.Lock()
+	e.cancel = cancel
+	e.mu.Unlock()
 	for state, err := e.getState(); err == nil && state != execComplete; e.setState(state, err) {
 		switch state {
 		case execUnstarted:
@@ -585,6 +948,9 @@ func (e *dockerExec) Go(ctx context.Context) {
 		if err == nil {
 			err = e.save(state)
 		}
+		if state != execComplete && e.isAborted() {
+			err = e.cleanupAborted()
+		}
 		if state == execComplete {
 			if err := e.client.ContainerRemove(context.Background(), e.containerName(), types.ContainerRemoveOptions{}); err != nil {
 				e.Log.Errorf("failed to remove container %s: %s", e.containerName(), err)
@@ -609,6 +975,12 @@ func (e *dockerExec) Logs(ctx context.Context, stdout, stderr, follow bool) (io.
 	if !stdout && !stderr {
 		return nil, errors.Errorf("logs %v %v %v: must specify at least one of stdout, stderr", e.id, stdout, stderr)
 	}
+	if e.Config.MergeStderr {
+		// The command's standard error is written to its standard
+		// output; what remains on stderr is written only by the shell
+		// (or a wrapper) before the command starts.
+		stdout, stderr = true, true
+	}
 	switch state {
 	case execUnstarted, execInit, execCreated:
 		return nil, errors.Errorf("logs %v %v %v: exec not yet started", e.id, stdout, stderr)
@@ -695,6 +1067,12 @@ func (e *dockerExec) Inspect(ctx context.Context) (reflow.ExecInspect, error) {
 		Docker:  e.Docker,
 		Profile: e.Manifest.Stats.Profile(),
 		Gauges:  e.Manifest.Gauges,
+
+		Attempts: e.Manifest.Attempts,
+		Memory:   e.resources()["mem"],
+		Limits:   containerLimits(e.Docker),
+		Version:  e.Manifest.Version,
+		Warnings: e.Manifest.Warnings,
 	}
 	state, err := e.getState()
 	if err != nil {
@@ -735,7 +1113,29 @@ func (e *dockerExec) Inspect(ctx context.Context) (reflow.ExecInspect, error) {
 	return inspect, nil
 }
 
-// Value returns the value computed by the exec.
+// containerLimits returns the resource limits recorded in the
+// container inspection info, or nil if the inspection has no host
+// configuration.
+func containerLimits(info types.ContainerJSON) *reflow.ContainerLimits {
+	if info.ContainerJSONBase == nil || info.HostConfig == nil {
+		return nil
+	}
+	r := info.HostConfig.Resources
+	return &reflow.ContainerLimits{
+		Memory:     r.Memory,
+		MemorySwap: r.MemorySwap,
+		NanoCPUs:   r.NanoCPUs,
+		PidsLimit:  r.PidsLimit,
+	}
+}
+
+// Result returns the value computed by the exec. Once the exec is
+// complete, Result may be called any number of times, concurrently;
+// each call returns the same result, which is held in memory. The
+// one exception is an exec with lazy digests (see
+// reflow.ExecConfig.LazyDigests): its result of reference files is
+// replaced by the resolved result when the exec is first promoted,
+// and every later call returns the resolved result.
 func (e *dockerExec) Result(ctx context.Context) (reflow.Result, error) {
 	state, err := e.getState()
 	if err != nil {
@@ -744,6 +1144,8 @@ func (e *dockerExec) Result(ctx context.Context) (reflow.Result, error) {
 	if state != execComplete {
 		return reflow.Result{}, errors.Errorf("result %v: exec not complete", e.id)
 	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.Manifest.Result, nil
 }
 
@@ -753,6 +1155,11 @@ func (e *dockerExec) Promote(ctx context.Context) error {
 	// The first call to Promote moves these objects and ref counts them. Later calls are
 	// a no-op.
 	err := e.promoteOnce.Do(func() error {
+		if e.Config.LazyDigests {
+			if err := e.digestOutputs(ctx); err != nil {
+				return err
+			}
+		}
 		res, err := e.Result(ctx)
 		if err != nil {
 			return err
@@ -764,13 +1171,76 @@ func (e *dockerExec) Promote(ctx context.Context) error {
 
 // Kill kills the exec's container and removes it entirely.
 func (e *dockerExec) Kill(ctx context.Context) error {
-	e.client.ContainerKill(ctx, e.containerName(), "KILL")
+	if state, err := e.getState(); err == nil && state != execComplete {
+		e.Executor.markKilled(e.id)
+	}
+	if e.stopsGracefully() {
+		timeout := e.stopTimeout()
+		e.client.ContainerStop(ctx, e.containerName(), &timeout)
+	} else {
+		e.client.ContainerKill(ctx, e.containerName(), "KILL")
+	}
 	if err := e.Wait(ctx); err != nil {
 		return err
 	}
+	e.releaseInputs()
+	if err := e.removeTmpfsOutputs(); err != nil {
+		return err
+	}
+	if err := e.unmountQuota(); err != nil {
+		return err
+	}
 	return os.RemoveAll(e.path())
 }
 
+// umask returns the umask with which the exec's command is run, if
+// any: that of its config, or else the executor's default.
+func (e *dockerExec) umask() string {
+	if e.Config.Umask != "" {
+		return e.Config.Umask
+	}
+	return e.Executor.Umask
+}
+
+// stopsGracefully tells whether the exec's container should be
+// stopped gracefully, as configured by ExecConfig.StopSignal and
+// ExecConfig.StopTimeout.
+func (e *dockerExec) stopsGracefully() bool {
+	return e.Config.StopSignal != "" || e.Config.StopTimeout > 0
+}
+
+// stopTimeout returns the time the exec's container is given to exit
+// when it is stopped gracefully. Docker's stop timeouts are given in
+// whole seconds, so the configured timeout is rounded up.
+func (e *dockerExec) stopTimeout() time.Duration {
+	if e.Config.StopTimeout > 0 {
+		return (e.Config.StopTimeout + time.Second - 1).Truncate(time.Second)
+	}
+	return defaultStopTimeout
+}
+
+// stopSignals are the names, without their "SIG" prefix, of the
+// signals that may be used as a container's stop signal.
+var stopSignals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CONT": true,
+	"FPE": true, "HUP": true, "ILL": true, "INT": true, "IO": true,
+	"IOT": true, "KILL": true, "PIPE": true, "POLL": true, "PROF": true,
+	"PWR": true, "QUIT": true, "SEGV": true, "STKFLT": true, "STOP": true,
+	"SYS": true, "TERM": true, "TRAP": true, "TSTP": true, "TTIN": true,
+	"TTOU": true, "URG": true, "USR1": true, "USR2": true, "VTALRM": true,
+	"WINCH": true, "XCPU": true, "XFSZ": true,
+}
+
+// validStopSignal tells whether sig names a signal as accepted by
+// Docker: a signal number, or a signal name, with or without its
+// "SIG" prefix.
+func validStopSignal(sig string) bool {
+	if n, err := strconv.Atoi(sig); err == nil {
+		return n > 0 && n <= 64
+	}
+	return stopSignals[strings.TrimPrefix(strings.ToUpper(sig), "SIG")]
+}
+
 // WaitUntil returns when the object state reaches at least min, or
 // an error occurs.
 func (e *dockerExec) WaitUntil(min execState) error {
@@ -803,6 +1273,34 @@ func (e *dockerExec) hostPath(elems ...string) string {
 	return e.Executor.execHostPath(e.id, elems...)
 }
 
+// returnPath constructs a path in the exec's return directory. The
+// return directory of an exec with tmpfs outputs is placed in the
+// executor's OutputTmpfsDir.
+func (e *dockerExec) returnPath(elems ...string) string {
+	if !e.Config.OutputTmpfs {
+		return e.scratchPath(append([]string{"return"}, elems...)...)
+	}
+	elems = append([]string{e.Executor.Prefix, e.returnHostPath()}, elems...)
+	return filepath.Join(elems...)
+}
+
+// returnHostPath returns the host path of the exec's return directory.
+func (e *dockerExec) returnHostPath() string {
+	if !e.Config.OutputTmpfs {
+		return e.scratchHostPath("return")
+	}
+	return filepath.Join(e.Executor.OutputTmpfsDir, e.Executor.Namespace, e.id.Hex())
+}
+
+// removeTmpfsOutputs releases the memory held by the exec's return
+// directory, if it is backed by tmpfs.
+func (e *dockerExec) removeTmpfsOutputs() error {
+	if !e.Config.OutputTmpfs {
+		return nil
+	}
+	return os.RemoveAll(e.returnPath())
+}
+
 // setState sets the current state and error. It broadcasts
 // on the exec's condition variable to wake up all waiters.
 func (e *dockerExec) setState(state execState, err error) {
@@ -823,26 +1321,162 @@ func (e *dockerExec) getState() (execState, error) {
 // install installs the exec's result object into the repository.
 // install removes the original copy of each object, replacing it
 // with a symlink to the digest of that object; this is to aid with
-// debugging.
+// debugging. If the exec's digests are lazy, install instead lists
+// the result's files, which are installed when the exec is promoted.
 func (e *dockerExec) install(ctx context.Context) error {
 	if e.Manifest.Result.Fileset.Map != nil || e.Manifest.Result.Fileset.List != nil {
 		return nil
 	}
+	var err error
+	e.Manifest.Result.Fileset, err = e.installOutputs(ctx, e.Config.LazyDigests)
+	return err
+}
+
+// installOutputs installs the exec's outputs from its return
+// directory, returning the resulting fileset. If list is true, the
+// outputs are listed as reference files instead (see listTree).
+func (e *dockerExec) installOutputs(ctx context.Context, list bool) (reflow.Fileset, error) {
+	if err := e.filterOutputs(); err != nil {
+		return reflow.Fileset{}, err
+	}
+	limits := newOutputLimits(e.Config)
+	installTree := func(path string) (reflow.Fileset, error) {
+		if list {
+			return listTree(path, limits)
+		}
+		return e.Executor.install(ctx, path, true, &e.staging, limits, nil)
+	}
+	outputs := e.Config.OutputIsDir
+	if outputs == nil {
+		return installTree(e.returnPath("default"))
+	}
+	fs := reflow.Fileset{List: make([]reflow.Fileset, len(outputs))}
+	for i := range outputs {
+		var err error
+		if fs.List[i], err = installTree(e.returnPath(strconv.Itoa(i))); err != nil {
+			return reflow.Fileset{}, err
+		}
+	}
+	return fs, nil
+}
+
+// salvageOutputs installs the outputs that the failed exec has
+// written into a partial result, recording the outputs that are
+// missing. Outputs that cannot be installed are considered missing.
+func (e *dockerExec) salvageOutputs(ctx context.Context) {
+	names := []string{"default"}
 	if outputs := e.Config.OutputIsDir; outputs != nil {
-		e.Manifest.Result.Fileset.List = make([]reflow.Fileset, len(outputs))
+		names = make([]string, len(outputs))
 		for i := range outputs {
-			var err error
-			e.Manifest.Result.Fileset.List[i], err =
-				e.Executor.install(ctx, e.path("return", strconv.Itoa(i)), true, &e.staging)
-			if err != nil {
-				return err
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	if err := e.filterOutputs(); err != nil {
+		e.Log.Errorf("filter outputs: %v", err)
+	}
+	var (
+		limits  = newOutputLimits(e.Config)
+		list    = make([]reflow.Fileset, len(names))
+		missing []int
+	)
+	for i, name := range names {
+		var err error
+		path := e.returnPath(name)
+		if _, err = os.Stat(path); err == nil {
+			list[i], err = e.Executor.install(ctx, path, true, &e.staging, limits, nil)
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				e.Log.Errorf("salvage output %s: %v", name, err)
 			}
+			list[i] = reflow.Fileset{Map: map[string]reflow.File{}}
+		}
+		if list[i].Empty() {
+			missing = append(missing, i)
+		}
+	}
+	if e.Config.OutputIsDir == nil {
+		e.Manifest.Result.Fileset = list[0]
+	} else {
+		e.Manifest.Result.Fileset = reflow.Fileset{List: list}
+	}
+	e.Manifest.Result.Partial = true
+	e.Manifest.Result.Missing = missing
+}
+
+// listTree returns a fileset of reference files for the directory
+// tree rooted at path. Each file has its size and a localfile Source
+// naming the file.
+func listTree(path string, limits *outputLimits) (reflow.Fileset, error) {
+	fs := reflow.Fileset{Map: map[string]reflow.File{}}
+	w := new(walker.Walker)
+	w.Init(path)
+	for w.Scan() {
+		if w.Info().IsDir() {
+			continue
+		}
+		if err := limits.add(w.Info().Size()); err != nil {
+			return reflow.Fileset{}, err
 		}
+		fs.Map[w.Relpath()] = reflow.File{Size: w.Info().Size(), Source: "localfile://" + w.Path()}
+	}
+	return fs, w.Err()
+}
+
+// digestOutputs installs the lazily listed outputs of the exec,
+// resolving its result.
+func (e *dockerExec) digestOutputs(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.Manifest.Result
+	e.mu.Unlock()
+	if pending.Err != nil || !hasRefs(pending.Fileset) {
 		return nil
 	}
-	var err error
-	e.Manifest.Result.Fileset, err = e.Executor.install(ctx, e.path("return", "default"), true, &e.staging)
-	return err
+	res, err := e.installOutputs(ctx, false)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.Manifest.Result.Fileset = res
+	e.mu.Unlock()
+	return e.save(execComplete)
+}
+
+// hasRefs tells whether the fileset contains reference files.
+func hasRefs(fs reflow.Fileset) bool {
+	for _, file := range fs.Files() {
+		if file.IsRef() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOutput returns an error if the exec with the provided config
+// is required to produce output, but the fileset it produced has an
+// empty output.
+func checkOutput(cfg reflow.ExecConfig, fs reflow.Fileset) error {
+	if !cfg.RequireOutput {
+		return nil
+	}
+	if cfg.OutputIsDir == nil {
+		if fs.Empty() {
+			return errors.New("exec produced no output: nothing was written to $out")
+		}
+		return nil
+	}
+	for i := range cfg.OutputIsDir {
+		if i >= len(fs.List) || fs.List[i].Empty() {
+			return errors.Errorf("exec produced no output: nothing was written to output %d", i)
+		}
+	}
+	return nil
+}
+
+// useInit tells whether the container of an exec with the provided
+// config should be run with an init process.
+func (e *Executor) useInit(cfg reflow.ExecConfig) bool {
+	return !e.NoInit && !cfg.NoInit
 }
 
 // allCloser defines a io.ReadCloser over a number of a reader
@@ -881,6 +1515,129 @@ func kind(err error) errors.Kind {
 	}
 }
 
+// retryOOM prepares an OOM-killed exec to be re-run with more
+// memory, as configured by ExecConfig.MemoryRetryFactor. It returns
+// true if the exec should be re-created. The retry's memory
+// requirement is recorded in the exec's manifest, leaving its config
+// as it was put; it is bounded by the executor's memory less that
+// reserved by its other live execs.
+func (e *dockerExec) retryOOM(ctx context.Context) bool {
+	e.mu.Lock()
+	cur := e.resources()["mem"]
+	e.mu.Unlock()
+	max := e.Config.MemoryRetryMax
+	if max <= 0 {
+		max = e.Executor.Resources()["mem"]
+	}
+	// The exec's own reservation is counted by reserved.
+	if avail := e.Executor.Resources()["mem"] - e.Executor.reserved()["mem"] + cur; avail < max {
+		max = avail
+	}
+	mem, ok := nextMemory(cur, e.Config.MemoryRetryFactor, max)
+	if !ok {
+		return false
+	}
+	if err := e.client.ContainerRemove(ctx, e.containerName(), types.ContainerRemoveOptions{}); err != nil {
+		e.Log.Errorf("failed to remove container %s: %s", e.containerName(), err)
+		return false
+	}
+	e.clearAttempt()
+	e.Log.Printf("killed by the OOM killer (attempt %d); retrying with %s memory",
+		e.Manifest.Attempts, data.Size(int64(mem)))
+	var limit float64
+	if limit = e.memoryLimit(); limit > 0 {
+		// Maintain the limit's headroom over the request.
+		if limit *= e.Config.MemoryRetryFactor; limit < mem {
+			limit = mem
+		}
+	}
+	e.mu.Lock()
+	e.Manifest.RetryMemory = mem
+	e.Manifest.RetryMemoryLimit = limit
+	// Warnings pertain to the failed attempt.
+	e.diskExceeded = ""
+	e.Manifest.Warnings = nil
+	e.mu.Unlock()
+	return true
+}
+
+// resources returns the resources required by the exec's current
+// attempt: those of its config, with the memory requirement of an
+// OOM retry, if any. The caller must hold e.mu or run the exec.
+func (e *dockerExec) resources() reflow.Resources {
+	if e.Manifest.RetryMemory <= 0 {
+		return e.Config.Resources
+	}
+	var r reflow.Resources
+	r.Set(e.Config.Resources)
+	r["mem"] = e.Manifest.RetryMemory
+	return r
+}
+
+// memoryLimit returns the container memory limit of the exec's
+// current attempt, or zero if the exec's config has no memory limit.
+func (e *dockerExec) memoryLimit() float64 {
+	if e.Manifest.RetryMemoryLimit > 0 {
+		return e.Manifest.RetryMemoryLimit
+	}
+	return e.Config.Limits["mem"]
+}
+
+// verifyDisk records a warning if the exec's disk usage, as sampled
+// in gauges, exceeds its disk resource. Only the first such sample is
+// recorded.
+func (e *dockerExec) verifyDisk(gauges reflow.Gauges) {
+	declared := e.Config.Resources["disk"]
+	if (!e.Executor.VerifyDisk && !e.Executor.StrictDisk) || declared <= 0 {
+		return
+	}
+	used := gauges["tmp"] + gauges["disk"]
+	if used <= declared {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.diskExceeded != "" {
+		return
+	}
+	e.diskExceeded = fmt.Sprintf("disk usage of %s ($tmp %s, outputs %s) exceeded the declared %s",
+		data.Size(int64(used)), data.Size(int64(gauges["tmp"])), data.Size(int64(gauges["disk"])), data.Size(int64(declared)))
+	e.Manifest.Warnings = append(e.Manifest.Warnings, e.diskExceeded)
+	e.Log.Printf("warning: %s", e.diskExceeded)
+}
+
+// clearAttempt removes the directories of an exec's previous attempt
+// before it is retried: its arguments, outputs, and, unless
+// ExecConfig.MemoryRetryKeepTmp is set, $tmp.
+func (e *dockerExec) clearAttempt() {
+	dirs := []string{e.path("arg"), e.returnPath()}
+	if e.Config.MemoryRetryKeepTmp {
+		e.Log.Debugf("preserving tmpdir %s for retry", e.scratchPath("tmp"))
+	} else {
+		dirs = append(dirs, e.scratchPath("tmp"))
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			e.Log.Errorf("failed to remove %s: %v", dir, err)
+		}
+	}
+}
+
+// nextMemory returns the memory requirement with which to retry an
+// exec that was OOM-killed while requiring mem, given a scaling
+// factor and a maximum. The retry is capped at max; nextMemory
+// returns false if no retry should be attempted.
+func nextMemory(mem, factor, max float64) (float64, bool) {
+	if factor <= 1 || mem <= 0 || mem >= max {
+		return 0, false
+	}
+	next := mem * factor
+	if next > max {
+		next = max
+	}
+	return next, true
+}
+
 // isOOMSystem checks to see if the docker exec was killed by the
 // OOM Killer.
 func (e *dockerExec) isOOMSystem() bool {
@@ -0,0 +1,289 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/grailbio/reflow"
+)
+
+func TestContainerID(t *testing.T) {
+	var e dockerExec
+	if id, ok := e.ContainerID(); ok {
+		t.Errorf("unexpected container ID %q", id)
+	}
+	e.Manifest.Docker.ContainerJSONBase = &types.ContainerJSONBase{ID: "inspected"}
+	if id, ok := e.ContainerID(); !ok || id != "inspected" {
+		t.Errorf("got %q, %v, want %q, true", id, ok, "inspected")
+	}
+	e.Manifest.ContainerID = "created"
+	if id, ok := e.ContainerID(); !ok || id != "created" {
+		t.Errorf("got %q, %v, want %q, true", id, ok, "created")
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	file := reflow.File{ID: reflow.Digester.FromString("x"), Size: 1}
+	full := reflow.Fileset{Map: map[string]reflow.File{".": file}}
+	for _, c := range []struct {
+		cfg reflow.ExecConfig
+		fs  reflow.Fileset
+		ok  bool
+	}{
+		{reflow.ExecConfig{}, reflow.Fileset{}, true},
+		{reflow.ExecConfig{RequireOutput: true}, reflow.Fileset{}, false},
+		{reflow.ExecConfig{RequireOutput: true}, full, true},
+		{reflow.ExecConfig{RequireOutput: true, OutputIsDir: []bool{true, false}},
+			reflow.Fileset{List: []reflow.Fileset{full, full}}, true},
+		{reflow.ExecConfig{RequireOutput: true, OutputIsDir: []bool{true, false}},
+			reflow.Fileset{List: []reflow.Fileset{full, {}}}, false},
+	} {
+		if err := checkOutput(c.cfg, c.fs); (err == nil) != c.ok {
+			t.Errorf("%v, %v: got %v, want ok=%v", c.cfg.RequireOutput, c.fs, err, c.ok)
+		}
+	}
+}
+
+func TestContainerLimits(t *testing.T) {
+	if limits := containerLimits(types.ContainerJSON{}); limits != nil {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+	hostConfig := &container.HostConfig{}
+	hostConfig.Resources.Memory = 1 << 30
+	hostConfig.Resources.MemorySwap = 1 << 30
+	hostConfig.Resources.NanoCPUs = 2e9
+	hostConfig.Resources.PidsLimit = 100
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{HostConfig: hostConfig}}
+	want := reflow.ContainerLimits{Memory: 1 << 30, MemorySwap: 1 << 30, NanoCPUs: 2e9, PidsLimit: 100}
+	if got := containerLimits(info); got == nil || *got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestUseInit(t *testing.T) {
+	for _, c := range []struct {
+		executor, exec bool
+		want           bool
+	}{
+		{false, false, true},
+		{true, false, false},
+		{false, true, false},
+		{true, true, false},
+	} {
+		x := &Executor{NoInit: c.executor}
+		if got, want := x.useInit(reflow.ExecConfig{NoInit: c.exec}), c.want; got != want {
+			t.Errorf("executor %v, exec %v: got %v, want %v", c.executor, c.exec, got, want)
+		}
+	}
+}
+
+func TestTmpfsOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmpfsoutputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: filepath.Join(dir, "x"), OutputTmpfsDir: filepath.Join(dir, "shm")}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	id := reflow.Digester.FromString("tmpfs")
+	e := newDockerExec(id, x, reflow.ExecConfig{OutputTmpfs: true}, nil, nil)
+	if got, want := e.returnPath("default"), filepath.Join(dir, "shm", id.Hex(), "default"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := e.returnHostPath(), filepath.Join(dir, "shm", id.Hex()); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := os.MkdirAll(e.returnPath(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(e.returnPath("default"), []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.install(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Manifest.Result.Fileset.Map["."].ID, reflow.Digester.FromString("hello"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := e.removeTmpfsOutputs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(e.returnPath()); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", e.returnPath(), err)
+	}
+
+	e = newDockerExec(reflow.Digester.FromString("disk"), x, reflow.ExecConfig{}, nil, nil)
+	if got, want := e.returnPath("default"), e.path("return", "default"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLazyDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lazydigests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	e := newDockerExec(reflow.Digester.FromString("lazy"), x, reflow.ExecConfig{LazyDigests: true}, nil, nil)
+	out := filepath.Join(e.path("return", "default"), "a")
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(out, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.install(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e.State = execComplete
+	res, err := e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := res.Fileset.Map["a"]
+	if !file.IsRef() || file.Size != 5 || file.Source != "localfile://"+out {
+		t.Errorf("unexpected file %v", file)
+	}
+	if err := e.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err = e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Fileset.Map["a"].ID, reflow.Digester.FromString("hello"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := x.FileRepository.Stat(ctx, reflow.Digester.FromString("hello")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClearAttempt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clearattempt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, keep := range []bool{false, true} {
+		e := newDockerExec(reflow.Digester.FromString("clear"), x, reflow.ExecConfig{MemoryRetryKeepTmp: keep}, nil, nil)
+		for _, path := range []string{e.path("arg", "0"), e.scratchPath("tmp", "checkpoint"), e.returnPath("default")} {
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte("partial"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e.clearAttempt()
+		for _, path := range []string{e.path("arg"), e.returnPath()} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("keep %v: expected %s to be removed, got %v", keep, path, err)
+			}
+		}
+		_, err := os.Stat(e.scratchPath("tmp", "checkpoint"))
+		if keep && err != nil {
+			t.Errorf("expected $tmp to be preserved, got %v", err)
+		}
+		if !keep && !os.IsNotExist(err) {
+			t.Errorf("expected $tmp to be removed, got %v", err)
+		}
+	}
+}
+
+func TestVerifyDisk(t *testing.T) {
+	x := &Executor{VerifyDisk: true}
+	e := newDockerExec(reflow.Digester.FromString("disk"), x, reflow.ExecConfig{Resources: reflow.Resources{"disk": 10 << 20}}, nil, nil)
+	e.verifyDisk(reflow.Gauges{"tmp": 4 << 20, "disk": 4 << 20})
+	if e.diskExceeded != "" || len(e.Manifest.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", e.Manifest.Warnings)
+	}
+	e.verifyDisk(reflow.Gauges{"tmp": 8 << 20, "disk": 4 << 20})
+	e.verifyDisk(reflow.Gauges{"tmp": 16 << 20, "disk": 4 << 20})
+	if got, want := len(e.Manifest.Warnings), 1; got != want {
+		t.Fatalf("got %d warnings, want %d", got, want)
+	}
+	if e.diskExceeded == "" {
+		t.Error("expected disk to be exceeded")
+	}
+
+	x.VerifyDisk = false
+	e = newDockerExec(reflow.Digester.FromString("unverified"), x, reflow.ExecConfig{Resources: reflow.Resources{"disk": 10 << 20}}, nil, nil)
+	e.verifyDisk(reflow.Gauges{"tmp": 16 << 20})
+	if len(e.Manifest.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", e.Manifest.Warnings)
+	}
+}
+
+func TestWrapper(t *testing.T) {
+	entrypoint := []string{"/bin/bash", "-c", "echo $tmp"}
+	var x Executor
+	e := newDockerExec(reflow.Digester.FromString("nowrapper"), &x, reflow.ExecConfig{}, nil, nil)
+	if got, want := e.wrap(entrypoint), entrypoint; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	wrapper := []string{
+		"strace", "-o", "$tmp/trace", "${tmp}/x", "$tmpdir", "${tmpdir}",
+		"$HOME", "${HOME}", "$1", "$", "${", "a$$b", "cost: $5",
+	}
+	e = newDockerExec(reflow.Digester.FromString("wrapper"), &x, reflow.ExecConfig{Wrapper: wrapper}, nil, nil)
+	want := []string{
+		"strace", "-o", "/tmp/trace", "/tmp/x", "$tmpdir", "${tmpdir}",
+		"$HOME", "${HOME}", "$1", "$", "${", "a$$b", "cost: $5",
+		"/bin/bash", "-c", "echo $tmp",
+	}
+	if got := e.wrap(entrypoint); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The exec's config is not modified.
+	if got, want := e.Config.Wrapper[2], "$tmp/trace"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	var x Executor
+	for _, c := range []struct {
+		signal   string
+		timeout  time.Duration
+		graceful bool
+		want     time.Duration
+	}{
+		{"", 0, false, defaultStopTimeout},
+		{"SIGINT", 0, true, defaultStopTimeout},
+		{"", 30 * time.Second, true, 30 * time.Second},
+		{"", 1500 * time.Millisecond, true, 2 * time.Second},
+		{"SIGINT", time.Millisecond, true, time.Second},
+	} {
+		e := newDockerExec(reflow.Digester.FromString("stop"), &x, reflow.ExecConfig{StopSignal: c.signal, StopTimeout: c.timeout}, nil, nil)
+		if got, want := e.stopsGracefully(), c.graceful; got != want {
+			t.Errorf("%q, %s: got %v, want %v", c.signal, c.timeout, got, want)
+		}
+		if got, want := e.stopTimeout(), c.want; got != want {
+			t.Errorf("%q, %s: got %s, want %s", c.signal, c.timeout, got, want)
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"expvar"
 	"io"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -17,8 +19,13 @@ import (
 	"docker.io/go-docker/api/types"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/base/limiter"
 	"github.com/grailbio/base/retry"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/internal/ecrauth"
+	"github.com/grailbio/reflow/log"
 )
 
 // imageExists checks whether an image exists at a Docker client.
@@ -65,9 +72,70 @@ func imageExists(ctx context.Context, client *docker.Client, id string) (bool, e
 	return false, nil
 }
 
+// hostPlatform is the platform of the images that run natively on
+// the host.
+var hostPlatform = "linux/" + runtime.GOARCH
+
+// validPlatform tells whether p is a platform of the form "os/arch"
+// or "os/arch/variant".
+func validPlatform(p string) bool {
+	parts := strings.Split(p, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// imagePlatform returns the platform, as "os/arch", of the image ref
+// present at a Docker client.
+func imagePlatform(ctx context.Context, client *docker.Client, ref string) (string, error) {
+	info, _, err := client.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.Os + "/" + info.Architecture, nil
+}
+
+// platformMatches tells whether an image of platform have, as
+// returned by imagePlatform, satisfies the platform want. Variants are
+// not compared, as Docker does not report them.
+func platformMatches(have, want string) bool {
+	parts := strings.SplitN(want, "/", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	return have == parts[0]+"/"+parts[1]
+}
+
+// imagePresent tells whether the image ref is present at a Docker
+// client for the provided platform; any platform is accepted if
+// platform is empty.
+func imagePresent(ctx context.Context, client *docker.Client, ref, platform string) (bool, error) {
+	ok, err := imageExists(ctx, client, ref)
+	if err != nil || !ok || platform == "" {
+		return ok, err
+	}
+	have, err := imagePlatform(ctx, client, ref)
+	if err != nil {
+		return false, err
+	}
+	return platformMatches(have, platform), nil
+}
+
 // pullImage pulls an image (by reference) to a Docker client using an authenticator.
-func pullImage(ctx context.Context, client *docker.Client, authenticator ecrauth.Interface, ref string) error {
-	var options types.ImagePullOptions
+// The image is pulled for the provided platform, unless it is empty.
+// If maxSize is positive, pullImage fails with an errors.NotAllowed error
+// for images larger than maxSize bytes. The pull is abandoned as soon as
+// the (compressed) sizes of the layers being downloaded exceed maxSize;
+// otherwise the pulled image's size is checked, and the image removed
+// if it is too large.
+func pullImage(ctx context.Context, client *docker.Client, authenticator ecrauth.Interface, ref, platform string, maxSize int64) error {
+	options := types.ImagePullOptions{Platform: platform}
 	if authenticator != nil {
 		if ok, err := authenticator.Authenticates(ctx, ref); ok && err == nil {
 			var auth types.AuthConfig
@@ -104,7 +172,9 @@ func pullImage(ctx context.Context, client *docker.Client, authenticator ecrauth
 	decoder := json.NewDecoder(resp)
 	// Docker sends status messages (e.g., "x% downloaded").
 	// We don't currently display these, but nonetheless have to
-	// consume them.
+	// consume them. They do however tell us the sizes of the layers
+	// being downloaded.
+	layers := make(layerSizes)
 	for {
 		var msg jsonmessage.JSONMessage
 		if err := decoder.Decode(&msg); err == io.EOF {
@@ -115,10 +185,49 @@ func pullImage(ctx context.Context, client *docker.Client, authenticator ecrauth
 		if msg.Error != nil {
 			return msg.Error
 		}
+		// Returning closes the response, which cancels the pull.
+		if size := layers.add(msg); maxSize > 0 && size > maxSize {
+			return errImageTooLarge(ref, size, maxSize)
+		}
+	}
+	if maxSize <= 0 {
+		return nil
+	}
+	info, _, err := client.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if info.Size > maxSize {
+		if _, err := client.ImageRemove(ctx, ref, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+			log.Errorf("failed to remove image %s: %v", ref, err)
+		}
+		return errImageTooLarge(ref, info.Size, maxSize)
 	}
 	return nil
 }
 
+// layerSizes records the sizes of the layers of an image pull, as
+// reported by Docker's progress messages.
+type layerSizes map[string]int64
+
+// add records the layer size reported by msg, if any, and returns
+// the total size of the layers seen so far.
+func (l layerSizes) add(msg jsonmessage.JSONMessage) int64 {
+	if msg.ID != "" && msg.Progress != nil && msg.Progress.Total > 0 {
+		l[msg.ID] = msg.Progress.Total
+	}
+	var total int64
+	for _, size := range l {
+		total += size
+	}
+	return total
+}
+
+func errImageTooLarge(ref string, size, maxSize int64) error {
+	return errors.E("ImagePull", ref, errors.NotAllowed,
+		errors.Errorf("image size %s exceeds the executor's maximum image size of %s", data.Size(size), data.Size(maxSize)))
+}
+
 // image manages the status of a single image that is either pulled
 // or in the process of being pulled. It is used to rendezvous
 // multiple execs that are pulling a single image.
@@ -136,15 +245,43 @@ var (
 
 // ensureImage returns nil when the image is known to be present
 // at the given Docker client. ensureImage ensures that there is only
-// one concurrent pull per image, per client.
-func ensureImage(ctx context.Context, client *docker.Client, authenticator ecrauth.Interface, ref string) error {
+// one concurrent pull per image, per client. Images are pulled
+// according to the given policy: with PullNever, ensureImage returns
+// an errors.NotExist error if the image is not present; with
+// PullAlways, the image is pulled unless a pull is already in
+// progress. Images are present only if they are for the given
+// platform; any platform is accepted if it is empty.
+// Pulls of images larger than maxSize fail; see pullImage.
+func ensureImage(ctx context.Context, client *docker.Client, authenticator ecrauth.Interface, pulls *limiter.Limiter, ref, platform string, policy reflow.PullPolicy, maxSize int64) error {
+	if policy == reflow.PullNever {
+		ok, err := imagePresent(ctx, client, ref, platform)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.E(errors.NotExist, errors.Errorf("image %s is not present for platform %q and its pull policy is %s", ref, platform, policy))
+		}
+		return nil
+	}
+	// Images are pulled separately for each platform.
+	key := ref
+	if platform != "" {
+		key += " " + platform
+	}
 	clientMu.Lock()
 	images := clientIm[client]
 	if images == nil {
 		images = map[string]*image{}
 		clientIm[client] = images
 	}
-	im := images[ref]
+	im := images[key]
+	if im != nil && policy == reflow.PullAlways {
+		im.Lock()
+		if im.done {
+			im = nil
+		}
+		im.Unlock()
+	}
 	if im != nil {
 		clientMu.Unlock()
 		im.Lock()
@@ -156,7 +293,7 @@ func ensureImage(ctx context.Context, client *docker.Client, authenticator ecrau
 	}
 	im = &image{}
 	im.Cond = sync.NewCond(im)
-	images[ref] = im
+	images[key] = im
 	clientMu.Unlock()
 	defer func() {
 		im.Lock()
@@ -164,15 +301,41 @@ func ensureImage(ctx context.Context, client *docker.Client, authenticator ecrau
 		im.Broadcast()
 		im.Unlock()
 	}()
-	if ok, _ := imageExists(ctx, client, ref); ok {
-		return nil
+	if policy != reflow.PullAlways {
+		if ok, _ := imagePresent(ctx, client, ref, platform); ok {
+			return nil
+		}
 	}
-	im.err = pullImage(ctx, client, authenticator, ref)
+	im.err = limitPull(ctx, pulls, func() error {
+		return pullImage(ctx, client, authenticator, ref, platform, maxSize)
+	})
 	if im.err != nil {
 		// Let subsequent fetches retry.
 		clientMu.Lock()
-		delete(images, ref)
+		delete(images, key)
 		clientMu.Unlock()
 	}
 	return im.err
 }
+
+var (
+	queuedPulls   = expvar.NewInt("imagepullqueued")
+	pullingImages = expvar.NewInt("imagepulling")
+)
+
+// limitPull calls pull once it has acquired a token from the limiter
+// pulls. A nil limiter admits any number of concurrent pulls.
+func limitPull(ctx context.Context, pulls *limiter.Limiter, pull func() error) error {
+	if pulls != nil {
+		queuedPulls.Add(1)
+		err := pulls.Acquire(ctx, 1)
+		queuedPulls.Add(-1)
+		if err != nil {
+			return errors.E("ImagePull", err)
+		}
+		defer pulls.Release(1)
+	}
+	pullingImages.Add(1)
+	defer pullingImages.Add(-1)
+	return pull()
+}
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"docker.io/go-docker"
+	"github.com/docker/docker/pkg/jsonmessage"
 )
 
 func newDockerClientOrSkip(t *testing.T) *docker.Client {
@@ -36,7 +37,7 @@ func TestPullImage(t *testing.T) {
 		"grailbio/awstool:latest",
 		"grailbio/awstool@sha256:b9a5e983e2de3f5319bca2fc015d279665096af20a27013c90583ac899c8b35a",
 	}
-	err := pullImage(ctx, client, nil, images[0])
+	err := pullImage(ctx, client, nil, images[0], "", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,3 +51,22 @@ func TestPullImage(t *testing.T) {
 		}
 	}
 }
+
+func TestLayerSizes(t *testing.T) {
+	layers := make(layerSizes)
+	for _, c := range []struct {
+		msg  jsonmessage.JSONMessage
+		want int64
+	}{
+		{jsonmessage.JSONMessage{ID: "a", Status: "Pulling fs layer"}, 0},
+		{jsonmessage.JSONMessage{ID: "a", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 10, Total: 100}}, 100},
+		{jsonmessage.JSONMessage{ID: "b", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 1, Total: 50}}, 150},
+		{jsonmessage.JSONMessage{ID: "a", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 90, Total: 100}}, 150},
+		{jsonmessage.JSONMessage{ID: "a", Status: "Download complete"}, 150},
+		{jsonmessage.JSONMessage{Status: "Digest: sha256:abc"}, 150},
+	} {
+		if got, want := layers.add(c.msg), c.want; got != want {
+			t.Errorf("%v: got %v, want %v", c.msg, got, want)
+		}
+	}
+}
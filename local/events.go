@@ -0,0 +1,122 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/errors"
+)
+
+// eventBufferSize is the number of events buffered by the channel
+// returned by (*Executor).Events.
+const eventBufferSize = 1024
+
+var droppedEvents = expvar.NewInt("execeventsdropped")
+
+// ExecEventType is the type of an exec lifecycle event.
+type ExecEventType string
+
+const (
+	// ExecQueued is emitted when an exec is put to the executor.
+	ExecQueued ExecEventType = "Queued"
+	// ExecPulling is emitted when an exec begins to pull its image.
+	ExecPulling ExecEventType = "Pulling"
+	// ExecStarted is emitted when an exec's container is started, or
+	// its transfer begins.
+	ExecStarted ExecEventType = "Started"
+	// ExecCompleted is emitted when an exec completes successfully.
+	ExecCompleted ExecEventType = "Completed"
+	// ExecFailed is emitted when an exec fails.
+	ExecFailed ExecEventType = "Failed"
+	// ExecKilled is emitted when an exec completes after it was
+	// killed or aborted.
+	ExecKilled ExecEventType = "Killed"
+)
+
+// An ExecEvent describes a lifecycle event of one of an executor's
+// execs.
+type ExecEvent struct {
+	// ID is the ID of the exec.
+	ID digest.Digest
+	// Type is the type of the event.
+	Type ExecEventType
+	// Time is the time at which the event occurred.
+	Time time.Time
+	// Err is the exec's error, for failed and killed execs.
+	Err error
+}
+
+// Events returns the channel on which the lifecycle events of all
+// of the executor's execs are emitted, beginning with the first call
+// to Events; all calls return the same channel. The channel buffers
+// 1024 events. Events never block execs: when the buffer is full,
+// because the channel's consumer is slow, new events are dropped, and
+// counted in the "execeventsdropped" expvar. The channel is never
+// closed.
+func (e *Executor) Events() <-chan ExecEvent {
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+	if e.events == nil {
+		e.events = make(chan ExecEvent, eventBufferSize)
+	}
+	return e.events
+}
+
+// emit emits an event of the provided type for exec id, if events
+// are consumed.
+func (e *Executor) emit(id digest.Digest, typ ExecEventType, err error) {
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+	if e.events == nil {
+		return
+	}
+	select {
+	case e.events <- ExecEvent{ID: id, Type: typ, Time: time.Now(), Err: err}:
+	default:
+		droppedEvents.Add(1)
+	}
+}
+
+// markKilled records that exec id, which is not yet complete, was
+// killed, so that its completion is emitted as such.
+func (e *Executor) markKilled(id digest.Digest) {
+	e.eventsMu.Lock()
+	if e.killed == nil {
+		e.killed = make(map[digest.Digest]bool)
+	}
+	e.killed[id] = true
+	e.eventsMu.Unlock()
+}
+
+// emitDone emits the completion event of exec x, whose state machine
+// has returned.
+func (e *Executor) emitDone(x exec) {
+	e.eventsMu.Lock()
+	killed := e.killed[x.ID()]
+	delete(e.killed, x.ID())
+	e.eventsMu.Unlock()
+	err := x.WaitUntil(execComplete)
+	if err == nil {
+		r, rerr := x.Result(context.Background())
+		switch {
+		case rerr != nil:
+			err = rerr
+		case r.Err != nil:
+			err = r.Err
+		}
+	}
+	switch {
+	case killed || errors.Is(errors.Canceled, err):
+		e.emit(x.ID(), ExecKilled, err)
+	case err != nil:
+		e.emit(x.ID(), ExecFailed, err)
+	default:
+		e.emit(x.ID(), ExecCompleted, nil)
+	}
+}
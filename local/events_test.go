@@ -0,0 +1,78 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+)
+
+func TestEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo", "false"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	events := x.Events()
+	ctx := context.Background()
+	var (
+		ok     = reflow.Digester.FromString("ok")
+		failed = reflow.Digester.FromString("failed")
+	)
+	for id, url := range map[digest.Digest]string{ok: "exec://echo ok", failed: "exec://false"} {
+		exec, err := x.Put(ctx, id, reflow.ExecConfig{Type: intern, URL: url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec.Wait(ctx)
+	}
+	got := make(map[digest.Digest][]ExecEventType)
+	for n := 0; n < 4; n++ {
+		event := <-events
+		if event.Time.IsZero() {
+			t.Errorf("event %v has no time", event)
+		}
+		got[event.ID] = append(got[event.ID], event.Type)
+	}
+	for id, want := range map[digest.Digest][]ExecEventType{
+		ok:     {ExecQueued, ExecCompleted},
+		failed: {ExecQueued, ExecFailed},
+	} {
+		if len(got[id]) != len(want) || got[id][0] != want[0] || got[id][1] != want[1] {
+			t.Errorf("%v: got %v, want %v", id, got[id], want)
+		}
+	}
+	if x.Events() != events {
+		t.Error("expected the same channel")
+	}
+}
+
+func TestEventsDropped(t *testing.T) {
+	var x Executor
+	x.emit(reflow.Digester.FromString("unconsumed"), ExecQueued, nil)
+	events := x.Events()
+	if got := len(events); got != 0 {
+		t.Errorf("got %v events before Events was called, want 0", got)
+	}
+	before := droppedEvents.Value()
+	for i := 0; i < eventBufferSize+10; i++ {
+		x.emit(reflow.Digester.FromString("exec"), ExecQueued, nil)
+	}
+	if got, want := len(events), eventBufferSize; got != want {
+		t.Errorf("got %v buffered events, want %v", got, want)
+	}
+	if got, want := droppedEvents.Value()-before, int64(10); got != want {
+		t.Errorf("got %v dropped events, want %v", got, want)
+	}
+}
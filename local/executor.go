@@ -11,7 +11,10 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,10 +23,13 @@ import (
 	"docker.io/go-docker/api/types"
 	"docker.io/go-docker/api/types/container"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/digest"
+	"github.com/grailbio/base/limiter"
 	"github.com/grailbio/base/traverse"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/blob/s3blob"
 	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/internal/ecrauth"
 	"github.com/grailbio/reflow/internal/walker"
@@ -70,6 +76,13 @@ type Executor struct {
 	// Dir is the root directory of this executor. All of its state is contained
 	// within it.
 	Dir string
+	// Namespace, if set, isolates this executor's execs from those of
+	// other executors that share its directory (and Docker daemon):
+	// execs are stored in, and restored from, a subdirectory of the
+	// executor's exec directory named by the namespace, and are thus
+	// distinct from execs with the same IDs in other namespaces. The
+	// namespace must be a valid file name.
+	Namespace string
 	// Client is the Docker client used by this executor.
 	Client *docker.Client
 	// Authenticator is used to pull images that are stored on Amazon's ECR
@@ -81,9 +94,22 @@ type Executor struct {
 	// AWSCreds is an AWS credentials provider, used for S3 operations
 	// and "$aws" passthroughs.
 	AWSCreds *credentials.Credentials
+	// AWSProfile and AWSCredentialsFile, if set, are used by Start to
+	// construct AWSCreds from the named profile in the given shared
+	// credentials (or config) file when AWSCreds is nil. See
+	// ProfileCredentials.
+	AWSProfile         string
+	AWSCredentialsFile string
 	// Log is this executor's logger where operational status is printed.
 	Log *log.Logger
 
+	// Version identifies the build of Reflow running this executor. It
+	// is recorded in the manifests of the execs it creates, and
+	// reported by their Inspect. Execs restored from manifests of a
+	// different version are logged, as a debugging aid for
+	// incompatibilities across versions.
+	Version string
+
 	// ExternalS3 defines whether to use external processes (AWS CLI tool
 	// running in docker) for S3 operations. At the moment, this flag only
 	// works for interns.
@@ -99,20 +125,282 @@ type Executor struct {
 
 	Blob blob.Mux
 
+	// TmpSnapshotLimit is the maximum number of bytes of file data
+	// included in snapshots of an exec's $tmp directory. Snapshots are
+	// retained for failed execs. If zero, a default of 1GiB is used.
+	TmpSnapshotLimit int64
+
+	// TmpRetention determines whether the $tmp directories of
+	// completed execs are retained (in the exec's directory) or
+	// removed. By default, they are removed as soon as the exec
+	// completes; snapshots of failed execs' $tmp are retained
+	// regardless (see TmpSnapshotLimit). Retained directories are
+	// removed with their execs.
+	TmpRetention TmpRetention
+
+	// MinFreeInodes is the number of inodes that must remain free on
+	// the file system of the executor's directory. If positive, Put
+	// fails, and interns abort, with errors.ResourcesExhausted when
+	// fewer inodes are free. This guards against inode exhaustion by
+	// interns of very many small files, which otherwise surfaces as
+	// "no space left on device" errors despite free disk space.
+	MinFreeInodes uint64
+
+	// CacheInternDigests enables a persistent cache of the digests of
+	// files interned from the local filesystem (localfile://). Files
+	// whose size and modification time are unchanged since they were
+	// last digested are installed without being rehashed. Digests are
+	// checkpointed as they are computed, so that retrying a failed
+	// intern of a large tree is fast.
+	CacheInternDigests bool
+
+	// CompareInternDigests extends CacheInternDigests to files whose
+	// modification time, but not size, has changed since they were
+	// digested, as is the case for trees that are rewritten (e.g., by
+	// copying or syncing them) without being modified: if the
+	// repository contains the object with a file's cached digest, and
+	// the file's contents are identical to that object's, the digest
+	// is reused without rehashing the file. The comparison reads the
+	// file and the object in full; the digest is computed anew if they
+	// differ.
+	CompareInternDigests bool
+
+	// InternCommands lists the commands that may be run on the host by
+	// command interns, whose URLs are of the form "exec://command args".
+	// Command interns run the named command, without a shell, and
+	// intern its standard output as a single file. Since the commands
+	// run outside of a container, with the executor's privileges, only
+	// the listed commands are permitted; if the list is empty, command
+	// interns are not allowed.
+	InternCommands []string
+
+	// AllowDockerSocketMount permits execs to request that the Docker
+	// socket be mounted into their containers (see
+	// reflow.ExecConfig.MountDockerSocket). Since this gives execs
+	// control over the Docker daemon, and thus the host, it is
+	// disabled by default; Put fails for execs that request the mount
+	// unless it is set.
+	AllowDockerSocketMount bool
+
+	// ProfileGPU enables the profiling of execs' GPU usage: the GPU
+	// utilization (in GPUs, as "gpu") and GPU memory (in bytes, as
+	// "gpumem") of each exec's processes is sampled with nvidia-smi,
+	// which must be installed on the host.
+	ProfileGPU bool
+
+	// PullTimeout, if positive, bounds the time an exec may spend
+	// pulling its image (including retries), separately from the
+	// exec's own context. Execs whose pulls exceed it fail with an
+	// errors.Timeout error from the "ImagePull" operation.
+	PullTimeout time.Duration
+
+	// MaxConcurrentPulls, if positive, limits the number of images
+	// that may be pulled concurrently. Execs waiting for a pull
+	// remain in the initializing state, so they are queued rather
+	// than counted as running. Images that are already present are
+	// not subject to the limit.
+	MaxConcurrentPulls int
+
+	// Platform is the default platform ("os/arch" or
+	// "os/arch/variant") of exec images, used for execs whose configs
+	// do not specify one. If empty, the host's platform, "linux/"
+	// followed by the executor's architecture, is used.
+	Platform string
+
+	// MaxImageSize, if positive, is the size (in bytes) of the largest
+	// image the executor will pull. Execs whose images exceed it fail
+	// with an errors.NotAllowed error from the "ImagePull" operation.
+	// Pulls are abandoned as soon as the layers being downloaded exceed
+	// the limit, so that large images cannot fill the executor's disk.
+	MaxImageSize int64
+
+	// RequireSignedImages enforces Docker Content Trust: exec images
+	// are run only if they are signed, and they are then pulled and
+	// run by their signed digests. Execs whose images are not signed
+	// fail with an errors.NotAllowed error. Trust data is retrieved
+	// with the Docker CLI ("docker trust inspect"), which must be
+	// installed on the executor's host.
+	RequireSignedImages bool
+
+	// Offline guarantees hermetic execution: Put rejects interns and
+	// externs of any URL other than localfile URLs, and containers are
+	// run without networking (Docker's "none" network mode) instead of
+	// on the host network.
+	Offline bool
+
+	// CapAdd and CapDrop are the Linux capabilities added to and
+	// dropped from every exec container, in addition to those of the
+	// exec's config (see reflow.ExecConfig.CapAdd). If both are empty,
+	// containers run with Docker's default capabilities; hardened
+	// executors may set CapDrop to []string{"ALL"}, so that execs hold
+	// only the capabilities they add.
+	CapAdd, CapDrop []string
+
+	// AllowedCaps lists the capabilities that execs may add to their
+	// containers. Put fails for execs that add other capabilities.
+	AllowedCaps []string
+
+	// ShmSize is the default size, in bytes, of the /dev/shm of exec
+	// containers that do not specify one (see
+	// reflow.ExecConfig.ShmSize). If zero, Docker's default is used.
+	ShmSize int64
+
+	// OutputTmpfsDir is a directory on a (host) tmpfs filesystem, such
+	// as /dev/shm/reflow, in which the outputs of execs with
+	// reflow.ExecConfig.OutputTmpfs are placed. Like Dir, it is
+	// interpreted relative to Prefix. If empty, such execs are not
+	// supported.
+	OutputTmpfsDir string
+
+	// DiskQuotas enforces the disk resource of execs (see
+	// reflow.ExecConfig.Resources) as a quota on their scratch space:
+	// each such exec's $tmp and outputs are placed on a dedicated
+	// loopback filesystem of that size, so that an exec that exceeds
+	// its disk fails with ENOSPC instead of exhausting the executor's
+	// disk. Such failures are reported as errors.ResourcesExhausted.
+	// DiskQuotas requires that the executor run as root on the Docker
+	// host (Prefix must be empty), with mkfs.ext4, mount, and umount
+	// available.
+	DiskQuotas bool
+
+	// VerifyDisk compares the disk usage of execs, as sampled by their
+	// profiles, against their disk resource. The first sample in which
+	// an exec's $tmp and outputs together exceed its disk resource is
+	// recorded as a warning in the exec's inspect. Execs that do not
+	// request disk are not verified.
+	VerifyDisk bool
+
+	// StrictDisk, in addition to VerifyDisk (which it implies), fails
+	// otherwise successful execs that exceeded their disk resource with
+	// errors.ResourcesExhausted.
+	StrictDisk bool
+
+	// PidsLimit is the default process limit of exec containers that
+	// do not specify one (see reflow.ExecConfig.PidsLimit). If zero,
+	// the number of processes is not limited.
+	PidsLimit int64
+
+	// Runtime is the Docker runtime with which exec containers that do
+	// not specify one (see reflow.ExecConfig.Runtime) are run. If
+	// empty, the Docker daemon's default runtime is used.
+	Runtime string
+
+	// SharedInputs stages each distinct input fileset of exec
+	// containers once, in the executor's directory, and binds it
+	// read-only into the containers that use it, instead of
+	// materializing the inputs of each exec separately. Inputs are
+	// staged by hard linking their files from the repository, or by
+	// copying them where hard links are not possible, and are removed
+	// once no exec uses them. Single-file inputs are not shared.
+	SharedInputs bool
+
+	// Umask is the umask with which the commands of execs that do not
+	// specify one (see reflow.ExecConfig.Umask) are run.
+	Umask string
+
+	// NoInit disables the init process with which exec containers are
+	// otherwise run (see reflow.ExecConfig.NoInit).
+	NoInit bool
+
+	// ConfigMiddleware, if non-nil, transforms the config of each exec
+	// that is put to the executor before the config is validated and
+	// the exec is defined, e.g., to enforce organization-wide policies.
+	// If ConfigMiddleware returns an error, the exec is rejected with
+	// it.
+	ConfigMiddleware func(reflow.ExecConfig) (reflow.ExecConfig, error)
+
+	// AdmissionController, if non-nil, is consulted for each exec that
+	// is put to the executor once the exec is otherwise certain to be
+	// defined, and is told when each admitted exec completes. It is not
+	// consulted for puts of execs that are already defined.
+	AdmissionController AdmissionController
+
+	// OnStart, if non-nil, is invoked when an exec's container is
+	// started, with the exec's ID and the time it waited since it was
+	// put, e.g., for its image to be pulled. OnStart is invoked
+	// synchronously from the exec's state machine and should not
+	// block.
+	OnStart func(id digest.Digest, queueWait time.Duration)
+
+	// OnInternProgress, if non-nil, is invoked as the files of blob
+	// (e.g., S3) interns are downloaded, with the intern's ID, the
+	// path of the file in the intern's fileset, and the number of
+	// bytes of the file that have been downloaded so far of its total
+	// size. It is invoked concurrently for the files of an intern (and
+	// even for a single file), and should not block.
+	OnInternProgress func(id digest.Digest, path string, done, total int64)
+
+	// RetryableError, if non-nil, tells whether an error of a blob
+	// (e.g., S3) extern's upload is retryable. Retryable errors are
+	// retried with backoff; other errors fail the extern immediately.
+	// If nil, transient and throttling errors (errors.Restartable or
+	// errors.ResourcesExhausted) are retryable, but permanent errors,
+	// such as denied access, are not.
+	RetryableError func(error) bool
+
+	// Clock is the clock used to time profiling samples. If nil,
+	// the wall clock is used.
+	Clock Clock
+
+	// DigestBlockSize, if positive, is the block size used to digest
+	// large files installed by this executor's execs: files larger
+	// than DigestBlockSize are digested in parallel blocks and named
+	// by their block digest (see reflow.File.BlockDigest). See
+	// filerepo.Repository.BlockSize.
+	DigestBlockSize int64
+
+	// RepositoryCodec, if non-nil, compresses the objects stored in
+	// the executor's default repository, e.g., filerepo.Gzip. Objects
+	// are still named by their uncompressed digests. Compression
+	// trades CPU for disk: objects are compressed as they are
+	// installed, and decompressed whenever they are materialized as
+	// exec arguments. See filerepo.Repository.Codec.
+	RepositoryCodec filerepo.Codec
+
 	// remoteStream is the client used to write logs to a remote cloud
 	// stream.
 	remoteStream remoteStream
 
-	resources reflow.Resources
+	// resourcesMu guards resources, the executor's total capacity;
+	// see SetResources.
+	resourcesMu sync.Mutex
+	resources   reflow.Resources
+
+	// digests caches the digests of interned local files. It is nil
+	// unless CacheInternDigests is set.
+	digests *digestCache
 
 	// The executor's context. This is used to propagate
 	// cancellation to execs.
 	cancel context.CancelFunc
 	ctx    context.Context
 
+	thresholdsMu sync.Mutex
+	thresholds   []*threshold
+
+	// runtimes caches the Docker runtimes known to be registered
+	// with the daemon.
+	runtimesMu sync.Mutex
+	runtimes   map[string]bool
+
+	// inputs are the shared inputs staged for execs.
+	inputsMu sync.Mutex
+	inputs   map[digest.Digest]*sharedInput
+
+	// pulls limits concurrent image pulls; see MaxConcurrentPulls.
+	pulls *limiter.Limiter
+
+	// events is the channel returned by Events; killed records the
+	// execs that were killed, until their completion is emitted.
+	eventsMu sync.Mutex
+	events   chan ExecEvent
+	killed   map[digest.Digest]bool
+
 	mu         sync.Mutex
 	dead       bool                   // tells whether the executor is dead
 	execs      map[digest.Digest]exec // the set of execs managed by this executor.
+	running    int                    // the number of execs whose state machines are running
+	idle       chan struct{}          // closed when running drops to zero
 	oomTracker *oomTracker
 
 	// reference count of the objects in the executor repository.
@@ -151,8 +439,32 @@ func (e *Executor) decr(id digest.Digest) {
 }
 
 // Start initializes the executor and recovers previously stored
-// state. It re-initializes all stored execs.
+// state. It re-initializes all stored execs: each exec found in the
+// executor's directory is resumed from its last saved state, so that
+// an exec whose container was running when a previous executor
+// stopped is reattached to it, and its results are installed when it
+// completes. Restored execs are available through Get and Execs as
+// soon as Start returns; recovery is always performed, and callers
+// need not resume execs individually.
 func (e *Executor) Start() error {
+	if ns := e.Namespace; ns != "" && (ns == "." || ns == ".." || strings.ContainsRune(ns, filepath.Separator)) {
+		return errors.E("start", errors.Invalid, errors.Errorf("invalid namespace %q", ns))
+	}
+	if e.Umask != "" {
+		if mask, err := strconv.ParseUint(e.Umask, 8, 32); err != nil || mask > 0777 {
+			return errors.E("start", errors.Invalid, errors.Errorf("invalid umask %q", e.Umask))
+		}
+	}
+	if e.Platform != "" && !validPlatform(e.Platform) {
+		return errors.E("start", errors.Invalid, errors.Errorf("invalid platform %q", e.Platform))
+	}
+	if e.MaxConcurrentPulls > 0 {
+		e.pulls = limiter.New()
+		e.pulls.Release(e.MaxConcurrentPulls)
+	}
+	if e.DiskQuotas && e.Prefix != "" {
+		return errors.E("start", errors.NotSupported, errors.New("disk quotas are not supported with a path prefix"))
+	}
 	e.refCountsCond = sync.NewCond(&e.refCountsMu)
 	e.deadObjects = make(map[digest.Digest]bool)
 	e.execs = map[digest.Digest]exec{}
@@ -162,16 +474,32 @@ func (e *Executor) Start() error {
 	e.oomTracker = newOOMTracker()
 	go e.oomTracker.Monitor(e.ctx, e.Log)
 
+	if e.AWSCreds == nil && (e.AWSProfile != "" || e.AWSCredentialsFile != "") {
+		creds, err := ProfileCredentials(e.AWSProfile, e.AWSCredentialsFile)
+		if err != nil {
+			return err
+		}
+		e.AWSCreds = creds
+	}
+
 	if e.FileRepository == nil {
-		e.FileRepository = &filerepo.Repository{Root: filepath.Join(e.Prefix, e.Dir, objectsDir)}
+		e.FileRepository = &filerepo.Repository{
+			Root:      filepath.Join(e.Prefix, e.Dir, objectsDir),
+			BlockSize: e.DigestBlockSize,
+			Codec:     e.RepositoryCodec,
+		}
 	}
 	os.MkdirAll(e.FileRepository.Root, 0777)
+	if e.CacheInternDigests {
+		e.digests = newDigestCache(filepath.Join(e.Prefix, e.Dir, digestCacheFile), e.Log)
+		e.digests.compare = e.CompareInternDigests
+	}
 	tempdir := filepath.Join(e.Prefix, e.Dir, "download")
 	if err := os.MkdirAll(tempdir, 0777); err != nil {
 		return err
 	}
 
-	execdir := filepath.Join(e.Prefix, e.Dir, execsDir)
+	execdir := filepath.Join(e.Prefix, e.Dir, execsDir, e.Namespace)
 	file, err := os.Open(execdir)
 	if os.IsNotExist(err) {
 		return nil
@@ -204,6 +532,9 @@ func (e *Executor) Start() error {
 			e.Log.Errorf("decode %v: %v", path, err)
 			continue
 		}
+		if m.Version != e.Version {
+			e.Log.Printf("exec %s was created by reflow version %q; this executor is version %q", id, m.Version, e.Version)
+		}
 		var x exec
 		switch m.Type {
 		case execDocker:
@@ -223,32 +554,60 @@ func (e *Executor) Start() error {
 			blobx.Init(e)
 			blobx.Manifest = m
 			x = blobx
+		case execScheme:
+			var handler InternExterner
+			if u, err := parseURL(m.Config.URL); err == nil {
+				handler, _ = schemeHandler(u)
+			}
+			sx := newSchemeExec(id, e, m.Config, handler)
+			sx.Manifest = m
+			x = sx
 		default:
 			e.Log.Errorf("unknown exec type %v", m.Type)
 			continue
 		}
+		e.mu.Lock()
 		e.execs[id] = x
-		go x.Go(e.ctx)
+		e.busy()
+		e.mu.Unlock()
+		go func() {
+			e.goExec(e.ctx, x)
+			e.done()
+		}()
 	}
 	return nil
 }
 
 // ensureImage returns nil when the image is known to be present
-// at the local Docker client.
+// at the local Docker client for the provided platform, pulling it
+// according to the provided pull policy.
 // TODO(marius): image pulling may be(?) better off as part of the executor interface
-func (e *Executor) ensureImage(ctx context.Context, ref string) error {
-	return ensureImage(ctx, e.Client, e.Authenticator, ref)
+func (e *Executor) ensureImage(ctx context.Context, ref, platform string, policy reflow.PullPolicy) error {
+	return ensureImage(ctx, e.Client, e.Authenticator, e.pulls, ref, platform, policy, e.MaxImageSize)
+}
+
+// platform returns the platform of images for execs that request the
+// provided platform, applying the executor's default.
+func (e *Executor) platform(platform string) string {
+	switch {
+	case platform != "":
+		return platform
+	case e.Platform != "":
+		return e.Platform
+	default:
+		return hostPlatform
+	}
 }
 
 // execPath constructs a path for the exec with the given id.
 func (e *Executor) execPath(id digest.Digest, elem ...string) string {
-	elem = append([]string{e.Prefix, e.Dir, execsDir, id.Hex()}, elem...)
+	elem = append([]string{e.Prefix, e.Dir, execsDir, e.Namespace, id.Hex()}, elem...)
 	return filepath.Join(elem...)
 }
 
 // execHostPath constructs a host path for the exec with the given id.
 func (e *Executor) execHostPath(id digest.Digest, elem ...string) string {
-	elem = append([]string{e.Dir, execsDir, id.Hex()}, elem...)
+	elem = append([]string{e.Dir, execsDir, e.Namespace, id.Hex()}, elem...)
 	return filepath.Join(elem...)
 }
 
@@ -277,31 +636,204 @@ func (e *Executor) getRemoteStreams(id digest.Digest, wantStdout, wantStderr boo
 }
 
 // Put idempotently defines a new exec with a given ID and config.
-// The exec may be (deterministically) rewritten.
+// The exec may be (deterministically) rewritten. If ctx is done
+// before the exec is defined, Put returns the context's error, and
+// the exec is neither defined nor started; once defined, the exec
+// runs independently of ctx.
 func (e *Executor) Put(ctx context.Context, id digest.Digest, cfg reflow.ExecConfig) (reflow.Exec, error) {
-	if err := e.rewriteConfig(&cfg); err != nil {
-		return nil, errors.E("put", id, fmt.Sprint(cfg), err)
+	execs, errs := e.PutBatch(ctx, []PutRequest{{ID: id, Config: cfg}})
+	return execs[0], errs[0]
+}
+
+// An AdmissionController enforces policies beyond the executor's
+// resource accounting, e.g., per-team rate limits or license
+// availability, by deciding which execs may be defined. Its methods
+// are called while the executor's lock is held, and so must not call
+// back into the executor.
+type AdmissionController interface {
+	// Admit tells whether the exec with the provided ID and config may
+	// be defined. Execs that are not admitted are rejected with an
+	// errors.ResourcesExhausted error; if Admit returns an error, the
+	// exec is rejected with it. Admit is called at most once for each
+	// exec that is defined, and only for execs that are defined if it
+	// admits them.
+	Admit(id digest.Digest, cfg reflow.ExecConfig) (bool, error)
+	// Release is called once an admitted exec has completed (or
+	// failed), so that the resources it was admitted against can be
+	// reused.
+	Release(id digest.Digest)
+}
+
+// admit consults the executor's admission controller, if any, for
+// the exec with the provided ID and config. admit must be called with
+// e.mu held.
+func (e *Executor) admit(id digest.Digest, cfg reflow.ExecConfig) error {
+	if e.AdmissionController == nil {
+		return nil
+	}
+	ok, err := e.AdmissionController.Admit(id, cfg)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.E(errors.ResourcesExhausted, errors.New("exec was not admitted"))
+	}
+	return nil
+}
+
+// release tells the executor's admission controller, if any, that
+// the admitted exec id has completed.
+func (e *Executor) release(id digest.Digest) {
+	if e.AdmissionController == nil {
+		return
 	}
 	e.mu.Lock()
-	if e.dead {
-		e.mu.Unlock()
-		return nil, errors.E("put", id, errors.NotExist)
+	e.AdmissionController.Release(id)
+	e.mu.Unlock()
+}
+
+// A PutRequest defines an exec to be put through PutBatch.
+type PutRequest struct {
+	// ID is the exec's ID.
+	ID digest.Digest
+	// Config is the exec's configuration.
+	Config reflow.ExecConfig
+}
+
+// PutBatch idempotently defines the execs in the provided requests,
+// as if by Put, returning each request's exec and error at the
+// request's index. Configurations are validated before any exec is
+// defined, and all execs are then defined under a single acquisition
+// of the executor's lock. Requests may share IDs, in which case they
+// return the same exec. Execs with prerequisites (see
+// reflow.ExecConfig.After) are returned as soon as they are defined;
+// they are started once their prerequisites complete.
+func (e *Executor) PutBatch(ctx context.Context, reqs []PutRequest) ([]reflow.Exec, []error) {
+	var (
+		execs = make([]reflow.Exec, len(reqs))
+		errs  = make([]error, len(reqs))
+		cfgs  = make([]reflow.ExecConfig, len(reqs))
+	)
+	inodesErr := e.checkInodes()
+	for i, req := range reqs {
+		if inodesErr != nil {
+			errs[i] = errors.E("put", req.ID, inodesErr)
+			continue
+		}
+		cfg := req.Config
+		if mw := e.ConfigMiddleware; mw != nil {
+			var err error
+			if cfg, err = mw(cfg); err != nil {
+				errs[i] = errors.E("put", req.ID, fmt.Sprint(req.Config), err)
+				continue
+			}
+		}
+		if err := e.rewriteConfig(&cfg); err != nil {
+			errs[i] = errors.E("put", req.ID, fmt.Sprint(cfg), err)
+			continue
+		}
+		if cfg.Type != intern && cfg.Type != extern {
+			if err := e.checkRuntime(ctx, e.runtime(cfg)); err != nil {
+				errs[i] = errors.E("put", req.ID, fmt.Sprint(cfg), err)
+				continue
+			}
+		}
+		cfgs[i] = cfg
 	}
-	if obj := e.execs[id]; obj != nil {
-		e.mu.Unlock()
-		return obj, nil
+	var (
+		started []int
+		held    = make(map[int][]exec)
+	)
+	e.mu.Lock()
+	for i, req := range reqs {
+		if errs[i] != nil {
+			continue
+		}
+		if e.dead {
+			errs[i] = errors.E("put", req.ID, errors.NotExist)
+			continue
+		}
+		// Checking for cancellation under the lock guarantees that a
+		// canceled put leaves no exec (and thus no reservation) behind.
+		if err := ctx.Err(); err != nil {
+			errs[i] = errors.E("put", req.ID, err)
+			continue
+		}
+		if obj := e.execs[req.ID]; obj != nil {
+			execs[i] = obj
+			continue
+		}
+		var after []exec
+		if len(cfgs[i].After) > 0 {
+			var err error
+			if after, err = e.prerequisites(req.ID, cfgs[i]); err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+		x, err := e.newExec(req.ID, cfgs[i])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := e.admit(req.ID, cfgs[i]); err != nil {
+			errs[i] = errors.E("put", req.ID, fmt.Sprint(cfgs[i]), err)
+			continue
+		}
+		e.execs[req.ID] = x
+		e.busy()
+		execs[i] = x
+		e.emit(req.ID, ExecQueued, nil)
+		if after != nil {
+			held[i] = after
+		} else {
+			started = append(started, i)
+		}
+	}
+	e.mu.Unlock()
+	for i, after := range held {
+		go func(x exec, cfg reflow.ExecConfig, after []exec) {
+			e.goAfter(e.ctx, x, cfg, after)
+			e.emitDone(x)
+			e.release(x.ID())
+			e.done()
+		}(execs[i].(exec), cfgs[i], after)
+	}
+	for _, i := range started {
+		go func(x exec) {
+			e.goExec(e.ctx, x)
+			e.release(x.ID())
+			e.done()
+		}(execs[i].(exec))
 	}
-	var exec exec
+	for _, i := range started {
+		errs[i] = execs[i].(exec).WaitUntil(execInit)
+	}
+	return execs, errs
+}
+
+// goExec runs the state machine of exec x, and then emits its
+// completion.
+func (e *Executor) goExec(ctx context.Context, x exec) {
+	x.Go(ctx)
+	e.emitDone(x)
+}
+
+// newExec returns a new, unstarted exec for the provided (rewritten)
+// config.
+func (e *Executor) newExec(id digest.Digest, cfg reflow.ExecConfig) (exec, error) {
 	switch cfg.Type {
 	case intern, extern:
-		u, err := url.Parse(cfg.URL)
+		u, err := parseURL(cfg.URL)
 		if err != nil {
-			e.mu.Unlock()
 			return nil, err
 		}
-		switch u.Scheme {
-		case "localfile":
-			exec = newLocalfileExec(id, e, cfg)
+		handler, registered := schemeHandler(u)
+		switch {
+		case u.Scheme == "localfile":
+			return newLocalfileExec(id, e, cfg), nil
+		case registered:
+			return newSchemeExec(id, e, cfg, handler), nil
 		default:
 			_, stderr := e.getRemoteStreams(id, false, true)
 			blob := &blobExec{
@@ -312,16 +844,12 @@ func (e *Executor) Put(ctx context.Context, id digest.Digest, cfg reflow.ExecCon
 			}
 			blob.Config = cfg
 			blob.Init(e)
-			exec = blob
+			return blob, nil
 		}
 	default:
 		stdout, stderr := e.getRemoteStreams(id, true, true)
-		exec = newDockerExec(id, e, cfg, log.New(stdout, log.InfoLevel), log.New(stderr, log.InfoLevel))
+		return newDockerExec(id, e, cfg, log.New(stdout, log.InfoLevel), log.New(stderr, log.InfoLevel)), nil
 	}
-	e.execs[id] = exec
-	e.mu.Unlock()
-	go exec.Go(e.ctx)
-	return exec, exec.WaitUntil(execInit)
 }
 
 // Get returns the exec named ID, or an errors.NotExist if the exec
@@ -509,13 +1037,26 @@ func (e *Executor) Load(ctx context.Context, repo *url.URL, fs reflow.Fileset) (
 // Repository returns the repository attached to this executor.
 func (e *Executor) Repository() reflow.Repository { return e.FileRepository }
 
-// SetResources sets the resources reported by Resources() to r.
-func (e *Executor) SetResources(r reflow.Resources) {
+// SetResources sets the resources reported by Resources() to r. It
+// is safe to call while execs are running: the new resources take
+// effect immediately for all subsequent capacity decisions (e.g.,
+// CanFit and OOM retries). SetResources returns an errors.Invalid
+// error, leaving the executor's resources unchanged, if r is less
+// than the resources reserved by the executor's live execs.
+func (e *Executor) SetResources(r reflow.Resources) error {
+	e.resourcesMu.Lock()
+	defer e.resourcesMu.Unlock()
+	if reason := shortfall(e.reserved(), r); reason != "" {
+		return errors.E("setresources", errors.Invalid, errors.Errorf("resources %s are less than those reserved by live execs: %s", r, reason))
+	}
 	e.resources = r
+	return nil
 }
 
 // Resources reports the total capacity of this executor.
 func (e *Executor) Resources() reflow.Resources {
+	e.resourcesMu.Lock()
+	defer e.resourcesMu.Unlock()
 	return e.resources
 }
 
@@ -532,6 +1073,46 @@ func (e *Executor) Execs(ctx context.Context) ([]reflow.Exec, error) {
 	return execs, nil
 }
 
+// WaitIdle blocks until none of the executor's execs are running,
+// that is, until every exec has either completed or failed. WaitIdle
+// returns immediately if the executor is already idle, and returns
+// ctx's error if ctx is done before the executor becomes idle.
+// Execs that are added while WaitIdle is waiting are also awaited.
+func (e *Executor) WaitIdle(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		running, idle := e.running, e.idle
+		e.mu.Unlock()
+		if running == 0 {
+			return nil
+		}
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// busy records that the state machine of an exec is about to be
+// run. It must be called with e.mu held.
+func (e *Executor) busy() {
+	if e.running == 0 {
+		e.idle = make(chan struct{})
+	}
+	e.running++
+}
+
+// done records that the state machine of an exec, recorded by busy,
+// has returned.
+func (e *Executor) done() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running--; e.running == 0 {
+		close(e.idle)
+	}
+}
+
 func (e *Executor) promote(ctx context.Context, res reflow.Fileset, repo *filerepo.Repository) error {
 	e.refCount(res)
 	return e.FileRepository.Vacuum(ctx, repo)
@@ -565,7 +1146,12 @@ func (e *Executor) Kill(ctx context.Context) error {
 		if !strings.HasPrefix(c.Names[0], "/reflow-"+e.ID) {
 			continue
 		}
-		e.Client.ContainerKill(ctx, c.ID, "KILL")
+		if c.Labels[stopLabel] != "" {
+			// Use the container's own stop signal and timeout.
+			e.Client.ContainerStop(ctx, c.ID, nil)
+		} else {
+			e.Client.ContainerKill(ctx, c.ID, "KILL")
+		}
 		respc, errc := e.Client.ContainerWait(ctx, c.ID, container.WaitConditionNotRunning)
 		select {
 		case err := <-errc:
@@ -582,25 +1168,150 @@ func (e *Executor) Kill(ctx context.Context) error {
 	return e.FileRepository.Collect(ctx, nil)
 }
 
+// hostnamePattern matches valid (RFC 1123) hostnames.
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// hintedResources returns the resources required by an exec with the
+// provided config: its requested resources, raised to those computed
+// by its ResourceHint (if any) from the size of its inputs.
+func hintedResources(cfg reflow.ExecConfig) reflow.Resources {
+	if cfg.ResourceHint == nil {
+		return cfg.Resources
+	}
+	var size int64
+	for _, arg := range cfg.Args {
+		if !arg.Out && arg.Fileset != nil {
+			size += arg.Fileset.Size()
+		}
+	}
+	var resources reflow.Resources
+	resources.Max(cfg.Resources, cfg.ResourceHint(size))
+	return resources
+}
+
 // rewriteConfig possibly rewrites the exec config cfg. In
 // particular, it rewrites interns and externs (which are not
 // intrinsic) to execs implementing those operations.
 func (e *Executor) rewriteConfig(cfg *reflow.ExecConfig) error {
+	if cfg.ResourceHint != nil {
+		cfg.Resources = hintedResources(*cfg)
+		cfg.ResourceHint = nil
+	}
+	for key, limit := range cfg.Limits {
+		if req := cfg.Resources[key]; limit < req {
+			return errors.E(errors.Invalid, errors.Errorf("%s limit %g is less than the requested %g", key, limit, req))
+		}
+	}
+	if !cfg.PullPolicy.Valid() {
+		return errors.E(errors.Invalid, errors.Errorf("invalid pull policy %q", cfg.PullPolicy))
+	}
+	if cfg.Platform != "" && !validPlatform(cfg.Platform) {
+		return errors.E(errors.Invalid, errors.Errorf("invalid platform %q", cfg.Platform))
+	}
+	if !cfg.FilenamePolicy.Valid() {
+		return errors.E(errors.Invalid, errors.Errorf("invalid filename policy %q", cfg.FilenamePolicy))
+	}
+	if !cfg.OutputMode.Valid() {
+		return errors.E(errors.Invalid, errors.Errorf("invalid output mode %q", cfg.OutputMode))
+	}
+	if cfg.OutputMode != "" && cfg.OutputIsDir != nil {
+		return errors.E(errors.Invalid, errors.New("output modes are not supported for execs with multiple outputs"))
+	}
+	if cfg.ShmSize < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("invalid shm size %d", cfg.ShmSize))
+	}
+	if cfg.OutputTmpfs {
+		if e.OutputTmpfsDir == "" {
+			return errors.E(errors.NotSupported, errors.New("tmpfs outputs are not supported by this executor"))
+		}
+		if cfg.LazyDigests {
+			return errors.E(errors.Invalid, errors.New("tmpfs outputs cannot be digested lazily"))
+		}
+	}
+	for _, pattern := range cfg.OutputFilter {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.E(errors.Invalid, errors.Errorf("invalid output filter %q: %v", pattern, err))
+		}
+	}
+	if cfg.TmpLog && cfg.TmpfsOptions != nil {
+		return errors.E(errors.Invalid, errors.New("logs cannot be teed to a tmpfs $tmp"))
+	}
+	if cfg.MemoryRetryKeepTmp && cfg.TmpfsOptions != nil {
+		return errors.E(errors.Invalid, errors.New("a tmpfs $tmp cannot be preserved across retries"))
+	}
+	if cfg.StopSignal != "" && !validStopSignal(cfg.StopSignal) {
+		return errors.E(errors.Invalid, errors.Errorf("invalid stop signal %q", cfg.StopSignal))
+	}
+	if cfg.StopTimeout < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("invalid stop timeout %s", cfg.StopTimeout))
+	}
+	if cfg.PidsLimit < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("invalid pids limit %d", cfg.PidsLimit))
+	}
+	if cfg.Umask != "" {
+		if mask, err := strconv.ParseUint(cfg.Umask, 8, 32); err != nil || mask > 0777 {
+			return errors.E(errors.Invalid, errors.Errorf("invalid umask %q", cfg.Umask))
+		}
+	}
+	if h := cfg.Hostname; h != "" && (len(h) > 253 || !hostnamePattern.MatchString(h)) {
+		return errors.E(errors.Invalid, errors.Errorf("invalid hostname %q", h))
+	}
+	if cfg.MountDockerSocket && !e.AllowDockerSocketMount {
+		return errors.E(errors.NotAllowed, errors.New("docker socket mounts are not allowed by this executor"))
+	}
+	for _, name := range cfg.CapAdd {
+		if !containsCap(e.AllowedCaps, name) {
+			return errors.E(errors.NotAllowed, errors.Errorf("capability %s is not allowed by this executor", name))
+		}
+	}
 	if cfg.Type != intern && cfg.Type != extern {
 		return nil
 	}
-	u, err := url.Parse(cfg.URL)
+	u, err := parseURL(cfg.URL)
 	if err != nil {
 		return err
 	}
+	if e.Offline && u.Scheme != "localfile" {
+		return errors.E(errors.NotAllowed, errors.Errorf("%s of %s URLs is not allowed by this offline executor", cfg.Type, u.Scheme))
+	}
+	if cfg.ExternTar {
+		if cfg.Type != extern {
+			return errors.E(errors.Invalid, errors.New("tar archives are supported only for externs"))
+		}
+		switch u.Scheme {
+		case "s3", "s3f", "http", "https":
+		default:
+			return errors.E(errors.NotSupported, errors.Errorf("tar externs are not supported for %s URLs", u.Scheme))
+		}
+		if e.ExternalS3 {
+			return errors.E(errors.NotSupported, errors.New("tar externs are not supported with external S3 transfers"))
+		}
+		if strings.HasSuffix(u.Path, "/") || strings.Trim(u.Path, "/") == "" {
+			return errors.E(errors.Invalid, errors.Errorf("tar extern URL %s does not name an object", cfg.URL))
+		}
+	}
 	switch u.Scheme {
 	case "localfile":
 		return nil
+	case commandScheme:
+		return e.checkCommand(cfg.Type, u)
+	case "http", "https":
+		// HTTP object stores cannot be listed, and so support only externs.
+		if cfg.Type != extern {
+			return errors.E(errors.NotSupported, errors.Errorf("%s is supported only for externs", u.Scheme))
+		}
+		return nil
 	case "s3", "s3f":
+		if class := cfg.StorageClass; class != "" && !s3blob.ValidStorageClass(class) {
+			return errors.E(errors.Invalid, errors.Errorf("invalid S3 storage class %q", class))
+		}
 		if !e.ExternalS3 {
 			return nil
 		}
 	default:
+		if _, ok := lookupScheme(u.Scheme); ok {
+			return nil
+		}
 		return errors.E(errors.NotSupported, errors.Errorf("unsupported scheme %q", u.Scheme))
 	}
 	creds, err := e.AWSCreds.Get()
@@ -658,6 +1369,10 @@ func (e *Executor) rewriteConfig(cfg *reflow.ExecConfig) error {
 			exit 1`, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, awsCLIFlags, uu.String())
 		}
 	case extern:
+		flags := awsCLIFlags
+		if cfg.StorageClass != "" {
+			flags += " --storage-class " + cfg.StorageClass
+		}
 		cfg.Cmd = fmt.Sprintf(`
 			aws configure set default.region us-west-2
 			export AWS_ACCESS_KEY_ID=%q
@@ -676,33 +1391,139 @@ func (e *Executor) rewriteConfig(cfg *reflow.ExecConfig) error {
 				n=$[$n+1]
 				sleep 10
 			done
-			exit 1`, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, awsCLIFlags, u.String(), awsCLIFlags, u.String())
+			exit 1`, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, flags, u.String(), flags, u.String())
 	}
 	cfg.Type = "exec"
 	return nil
 }
 
+// outputLimits bounds the number of files and bytes that may be
+// installed by (*Executor).install. Limits may be shared across
+// multiple installs, in which case they apply to the total.
+type outputLimits struct {
+	what     string // what is limited, for error messages
+	maxFiles int
+	maxBytes int64
+
+	nfiles int
+	nbytes int64
+}
+
+// newOutputLimits returns the output limits defined by cfg, or nil
+// if cfg does not define any.
+func newOutputLimits(cfg reflow.ExecConfig) *outputLimits {
+	if cfg.MaxOutputFiles <= 0 && cfg.MaxOutputBytes <= 0 {
+		return nil
+	}
+	return &outputLimits{what: "output", maxFiles: cfg.MaxOutputFiles, maxBytes: cfg.MaxOutputBytes}
+}
+
+// newInternLimits returns the intern budget defined by cfg, or nil
+// if cfg does not define one.
+func newInternLimits(cfg reflow.ExecConfig) *outputLimits {
+	if cfg.MaxFiles <= 0 && cfg.MaxTotalBytes <= 0 {
+		return nil
+	}
+	return &outputLimits{what: "intern", maxFiles: cfg.MaxFiles, maxBytes: cfg.MaxTotalBytes}
+}
+
+// add accounts for a file of the given size, returning an
+// errors.ResourcesExhausted error if a limit is exceeded.
+// A nil outputLimits imposes no limits.
+func (l *outputLimits) add(size int64) error {
+	if l == nil {
+		return nil
+	}
+	l.nfiles++
+	l.nbytes += size
+	if l.maxFiles > 0 && l.nfiles > l.maxFiles {
+		return errors.E(errors.ResourcesExhausted,
+			errors.Errorf("%s exceeds the maximum of %d files", l.what, l.maxFiles))
+	}
+	if l.maxBytes > 0 && l.nbytes > l.maxBytes {
+		return errors.E(errors.ResourcesExhausted,
+			errors.Errorf("%s exceeds the maximum of %s", l.what, data.Size(l.maxBytes)))
+	}
+	return nil
+}
+
+// checkLimits walks the directory tree rooted at path, returning an
+// errors.ResourcesExhausted error as soon as the tree is found to
+// exceed limits. File contents are not read.
+func checkLimits(path string, limits *outputLimits) error {
+	if limits == nil {
+		return nil
+	}
+	w := new(walker.Walker)
+	w.Init(path)
+	for w.Scan() {
+		if w.Info().IsDir() {
+			continue
+		}
+		if err := limits.add(w.Info().Size()); err != nil {
+			return err
+		}
+	}
+	return w.Err()
+}
+
 // install installs a directory tree into a repository and
 // returns a value representing the tree. If replace is true, the
 // original files are replaced with a symlink pointing to a textual
-// representation of the file's digest.
-func (e *Executor) install(ctx context.Context, path string, replace bool, repo *filerepo.Repository) (reflow.Fileset, error) {
+// representation of the file's digest. If limits is non-nil, install
+// fails as soon as the tree is found to exceed them. If cache is
+// non-nil, files with cached digests are installed without being
+// rehashed, and newly computed digests are added to the cache.
+func (e *Executor) install(ctx context.Context, path string, replace bool, repo *filerepo.Repository, limits *outputLimits, cache *digestCache) (reflow.Fileset, error) {
 	w := new(walker.Walker)
 	w.Init(path)
 	g, ctx := errgroup.WithContext(ctx)
 	var (
 		mu  sync.Mutex
 		val = reflow.Fileset{Map: map[string]reflow.File{}}
+		n   int
 	)
 	for w.Scan() {
 		if w.Info().IsDir() {
 			continue
 		}
-		path, relpath, size := w.Path(), w.Relpath(), w.Info().Size()
+		path, relpath, info := w.Path(), w.Relpath(), w.Info()
+		size := info.Size()
+		if err := limits.add(size); err != nil {
+			// Wait for in-flight installs before returning.
+			g.Wait()
+			return reflow.Fileset{}, err
+		}
+		if n++; n%inodeCheckInterval == 0 {
+			if err := e.checkInodes(); err != nil {
+				g.Wait()
+				return reflow.Fileset{}, err
+			}
+		}
 		g.Go(func() error {
+			if id, ok := cache.Lookup(path, info, repo.BlockSize); ok {
+				if err := repo.InstallDigest(id, path); err == nil {
+					mu.Lock()
+					val.Map[relpath] = repo.File(id, size)
+					mu.Unlock()
+					return nil
+				}
+			}
+			if id, ok := cache.Reuse(path, info, repo); ok {
+				if err := repo.InstallDigest(id, path); err == nil {
+					cache.Record(path, info, repo.BlockSize, id)
+					mu.Lock()
+					val.Map[relpath] = repo.File(id, size)
+					mu.Unlock()
+					return nil
+				}
+			}
 			file, err := repo.Install(path)
+			if err == nil {
+				cache.Record(path, info, repo.BlockSize, file.ID)
+			}
 			mu.Lock()
-			val.Map[relpath] = reflow.File{ID: file.ID, Size: size}
+			val.Map[relpath] = reflow.File{ID: file.ID, Size: size, BlockDigest: file.BlockDigest, BlockSize: file.BlockSize}
 			mu.Unlock()
 			return err
 		})
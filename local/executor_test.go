@@ -14,6 +14,7 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/blob"
 	"github.com/grailbio/reflow/blob/testblob"
+	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/internal/walker"
 	"github.com/grailbio/reflow/log"
 	"github.com/grailbio/reflow/repository"
@@ -32,8 +34,7 @@ import (
 )
 
 const (
-	dockerSocket = "/var/run/docker.sock"
-	bashImage    = "yikaus/alpine-bash" // the default alpine image doesn't have Bash.
+	bashImage = "yikaus/alpine-bash" // the default alpine image doesn't have Bash.
 	// We put this in /tmp because it's one of the default locations
 	// that are bindable from Docker for Mac.
 	tmpDir = "/tmp"
@@ -108,6 +109,12 @@ func TestExec(t *testing.T) {
 	if got, zero := gauges["tmp"], 0.0; got <= zero {
 		t.Fatalf("tmp gauge: %v !> %v", got, zero)
 	}
+	if got, want := gauges["out"], gauges["disk"]; got != want {
+		t.Fatalf("out gauge: got %v, want %v", got, want)
+	}
+	if got, want := profile["out"].N, profile["disk"].N; got != want {
+		t.Fatalf("out N: got %v, want %v", got, want)
+	}
 	if got, zero := profile["disk"].Mean, 0.0; got <= zero {
 		t.Fatalf("disk mean: %v !> %v", got, zero)
 	}
@@ -144,6 +151,225 @@ func TestExec(t *testing.T) {
 	}
 }
 
+func TestExecOutputDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("output dir")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:       "exec",
+		Image:      bashImage,
+		Cmd:        "echo foo > $out/a; mkdir $out/b; echo bar > $out/b/c",
+		OutputMode: reflow.OutputDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := exec.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := reflow.Result{Fileset: reflow.Fileset{
+		Map: map[string]reflow.File{
+			"a":   {ID: reflow.Digester.FromString("foo\n"), Size: 4},
+			"b/c": {ID: reflow.Digester.FromString("bar\n"), Size: 4},
+		},
+	}}
+	if got := res; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecSalvageOutputs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("salvage outputs")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:           "exec",
+		Image:          bashImage,
+		Cmd:            "echo foo > %s/a; exit 1; echo bar > %s/b",
+		Args:           []reflow.Arg{{Out: true, Index: 0}, {Out: true, Index: 1}},
+		OutputIsDir:    []bool{true, true},
+		SalvageOutputs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := exec.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || !res.Partial {
+		t.Fatalf("expected partial, failed result, got %v", res)
+	}
+	want := reflow.Fileset{List: []reflow.Fileset{
+		{Map: map[string]reflow.File{"a": {ID: reflow.Digester.FromString("foo\n"), Size: 4}}},
+		{Map: map[string]reflow.File{}},
+	}}
+	if got := res.Fileset; !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := res.Missing, []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecPidsLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	x.PidsLimit = 128
+	ctx := context.Background()
+	id := reflow.Digester.FromString("pids limit")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:      "exec",
+		Image:     bashImage,
+		Cmd:       "true",
+		PidsLimit: 64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	inspect, err := exec.Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspect.Limits == nil {
+		t.Fatal("missing container limits")
+	}
+	if got, want := inspect.Limits.PidsLimit, int64(64); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecStopSignal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("stop signal")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:        "exec",
+		Image:       bashImage,
+		Cmd:         "true",
+		StopSignal:  "SIGINT",
+		StopTimeout: 1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	inspect, err := exec.Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := inspect.Docker.Config
+	if config == nil {
+		t.Fatal("missing container config")
+	}
+	if got, want := config.StopSignal, "SIGINT"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if config.StopTimeout == nil {
+		t.Fatal("missing stop timeout")
+	}
+	if got, want := *config.StopTimeout, 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	if err := x.Warm(ctx, bashImage, bashImage); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := imageExists(ctx, x.Client, bashImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("image %s was not pulled", bashImage)
+	}
+}
+
+func TestExecOnStart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	var (
+		mu      sync.Mutex
+		started = make(map[digest.Digest]time.Duration)
+	)
+	x.OnStart = func(id digest.Digest, queueWait time.Duration) {
+		mu.Lock()
+		started[id] = queueWait
+		mu.Unlock()
+	}
+	ctx := context.Background()
+	id := reflow.Digester.FromString("on start")
+	begin := time.Now()
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:  "exec",
+		Image: bashImage,
+		Cmd:   "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(begin)
+	mu.Lock()
+	defer mu.Unlock()
+	wait, ok := started[id]
+	if !ok {
+		t.Fatal("OnStart was not invoked")
+	}
+	if wait < 0 || wait > elapsed {
+		t.Errorf("queue wait %s not in [0, %s]", wait, elapsed)
+	}
+}
+
 func TestProfileContextTimeOut(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -220,6 +446,111 @@ func TestProfileContextTimeOut(t *testing.T) {
 	}
 }
 
+func TestExecNoProfile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("noprofile")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:      "exec",
+		Image:     bashImage,
+		Cmd:       "echo foobar > $out",
+		NoProfile: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	i, err := exec.Inspect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(i.Profile), 0; got != want {
+		t.Errorf("got %v profiles, want %v", got, want)
+	}
+	if got, want := len(i.Gauges), 0; got != want {
+		t.Errorf("got %v gauges, want %v", got, want)
+	}
+}
+
+func TestExecMergeStderr(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("mergestderr")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:        "exec",
+		Image:       bashImage,
+		Cmd:         "echo a; echo b >&2; echo c; touch $out",
+		MergeStderr: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := exec.Logs(ctx, true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(rc); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "a\nb\nc\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExecTmpLog(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+	id := reflow.Digester.FromString("tmplog")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:   "exec",
+		Image:  bashImage,
+		Cmd:    "echo a; echo b >&2; sleep 2; cp $tmp/.log $out",
+		TmpLog: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := exec.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, ok := res.Fileset.Map["."]
+	if !ok {
+		t.Fatalf("expected a single file, got %v", res.Fileset)
+	}
+	if got, want := file.ID, reflow.Digester.FromString("a\nb\n"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func TestLocalfile(t *testing.T) {
 	x, cleanup := newTestExecutorOrSkip(t, nil)
 	defer cleanup()
@@ -555,3 +886,28 @@ func TestExecLoadUnloadDeadObjectRace(t *testing.T) {
 		}
 	}
 }
+
+func TestExecPullTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	x, cleanup := newTestExecutorOrSkip(t, nil)
+	defer cleanup()
+	x.PullTimeout = time.Nanosecond
+	ctx := context.Background()
+	id := reflow.Digester.FromString("pulltimeout")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{
+		Type:       "exec",
+		Image:      bashImage,
+		Cmd:        "echo foobar > $out",
+		PullPolicy: reflow.PullAlways,
+	})
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = exec.Wait(ctx)
+		cancel()
+	}
+	if !errors.Is(errors.Timeout, err) {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// tarModTime is the modification time of all entries in externed tar
+// archives. Using a fixed time keeps the archives deterministic.
+var tarModTime = time.Unix(0, 0)
+
+// doExternTar externs the fileset fs to the object key in bucket as a
+// single tar archive. The archive is produced twice: once to compute
+// its digest and size, which are recorded with the object, and again
+// to stream it to the bucket.
+func (e *blobExec) doExternTar(ctx context.Context, bucket blob.Bucket, key string, fs reflow.Fileset) error {
+	var (
+		dw   = reflow.Digester.NewWriter()
+		n    byteCounter
+		h    = md5.New()
+		w    = io.MultiWriter(dw, &n)
+		name = strings.TrimSuffix(path.Base(key), ".tar")
+	)
+	if e.Config.ExternMD5 {
+		w = io.MultiWriter(w, h)
+	}
+	if err := writeTar(ctx, w, fs, e.Repository, name); err != nil {
+		return errors.E("exec", e.ID(), e.Config.URL, err)
+	}
+	file := reflow.File{ID: dw.Digest(), Size: int64(n), Source: e.Config.URL}
+	if e.Config.ExternMD5 {
+		file.MD5 = hex.EncodeToString(h.Sum(nil))
+		ctx = blob.WithMetadata(ctx, map[string]string{md5MetadataKey: file.MD5})
+	}
+	ul := upload{Bucket: bucket, Key: key, ID: file.ID, Size: file.Size}
+	if e.Config.ExternSkipExisting && ul.Exists(ctx) {
+		e.log.Debugf("skipping upload of tar archive: %s%s is up to date", bucket.Location(), key)
+	} else {
+		e.log.Printf("upload tar archive of %s (%s) to %s%s", fs.Short(), data.Size(file.Size), bucket.Location(), key)
+		rw := newRateExporter(externRate)
+		defer rw.Done()
+		err := e.retry(ctx, func() error {
+			pr, pw := io.Pipe()
+			done := make(chan struct{})
+			go func() {
+				pw.CloseWithError(writeTar(ctx, pw, fs, e.Repository, name))
+				close(done)
+			}()
+			err := bucket.Put(ctx, key, file.Size, pr, file.ID.Hex())
+			// Closing the reader unblocks the writer should Put return early.
+			pr.Close()
+			<-done
+			return err
+		})
+		if err != nil {
+			e.log.Printf("upload %s/%s: %v", bucket.Location(), key, err)
+			return err
+		}
+		atomic.AddUint64(&e.transferredSize, uint64(file.Size))
+		rw.Add(file.Size)
+	}
+	e.mu.Lock()
+	e.Manifest.Result.Fileset.Map = map[string]reflow.File{".": file}
+	e.mu.Unlock()
+	return nil
+}
+
+// writeTar writes a tar archive of the fileset fs, whose files are
+// stored in repo, to w. Entries are written in path order with fixed
+// metadata, so that a fileset always produces the same archive. A
+// file with the path "." is archived as name.
+func writeTar(ctx context.Context, w io.Writer, fs reflow.Fileset, repo *filerepo.Repository, name string) error {
+	paths := make([]string, 0, len(fs.Map))
+	for p := range fs.Map {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	tw := tar.NewWriter(w)
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := fs.Map[p]
+		if p == "." {
+			if name == "" || name == "." || name == "/" {
+				return errors.E(errors.Invalid, errors.New("cannot name single file in tar archive"))
+			}
+			p = name
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     p,
+			Mode:     0644,
+			Size:     file.Size,
+			ModTime:  tarModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		rc, err := repo.Get(ctx, file.ID)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, rc)
+		rc.Close()
+		if err != nil {
+			return errors.E("archive", p, err)
+		}
+	}
+	return tw.Close()
+}
+
+// byteCounter is an io.Writer that counts the bytes written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A filenamer applies a filename policy to the names of the files of
+// an intern. It records the names it returns, so that escaped names
+// that collide with other names are detected. A filenamer is not
+// safe for concurrent use.
+type filenamer struct {
+	policy reflow.FilenamePolicy
+	names  map[string]string
+}
+
+// newFilenamer returns a filenamer for the provided policy.
+func newFilenamer(policy reflow.FilenamePolicy) *filenamer {
+	return &filenamer{policy: policy, names: make(map[string]string)}
+}
+
+// Name returns the name under which the file with the provided name
+// is interned.
+func (n *filenamer) Name(name string) (string, error) {
+	if n.policy == "" || n.policy == reflow.FilenameKeep || cleanFilename(name) {
+		return n.record(name, name)
+	}
+	if n.policy == reflow.FilenameReject {
+		return "", errors.E(errors.Invalid, errors.Errorf("invalid filename %q", name))
+	}
+	return n.record(name, escapeFilename(name))
+}
+
+func (n *filenamer) record(orig, name string) (string, error) {
+	if prev, ok := n.names[name]; ok && prev != orig {
+		return "", errors.E(errors.Invalid, errors.Errorf("filenames %q and %q are both interned as %q", prev, orig, name))
+	}
+	n.names[name] = orig
+	return name, nil
+}
+
+// Rename applies the filenamer to the fileset fs, returning a fileset
+// with the renamed files.
+func (n *filenamer) Rename(fs reflow.Fileset) (reflow.Fileset, error) {
+	renamed := reflow.Fileset{Map: make(map[string]reflow.File, len(fs.Map))}
+	for path, file := range fs.Map {
+		name, err := n.Name(path)
+		if err != nil {
+			return reflow.Fileset{}, err
+		}
+		renamed.Map[name] = file
+	}
+	return renamed, nil
+}
+
+// cleanFilename tells whether name is valid UTF-8 without control
+// characters.
+func cleanFilename(name string) bool {
+	if !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeFilename escapes the bytes of name that are not part of
+// valid UTF-8 sequences, or that encode control characters, as
+// "%XX".
+func escapeFilename(name string) string {
+	var b strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		if (r == utf8.RuneError && size <= 1) || unicode.IsControl(r) {
+			for i := 0; i < size; i++ {
+				fmt.Fprintf(&b, "%%%02X", name[i])
+			}
+		} else {
+			b.WriteString(name[:size])
+		}
+		name = name[size:]
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestFilenamePolicy(t *testing.T) {
+	fs := reflow.Fileset{Map: map[string]reflow.File{
+		"ok/héllo":   {ID: reflow.Digester.FromString("a"), Size: 1},
+		"tab\there":  {ID: reflow.Digester.FromString("b"), Size: 1},
+		"bad\xffutf": {ID: reflow.Digester.FromString("c"), Size: 1},
+	}}
+	for _, policy := range []reflow.FilenamePolicy{"", reflow.FilenameKeep} {
+		renamed, err := newFilenamer(policy).Rename(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !renamed.Equal(fs) {
+			t.Errorf("%q: got %v, want %v", policy, renamed, fs)
+		}
+	}
+	if _, err := newFilenamer(reflow.FilenameReject).Rename(fs); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+
+	renamed, err := newFilenamer(reflow.FilenameEscape).Rename(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ok/héllo", "tab%09here", "bad%FFutf"} {
+		if _, ok := renamed.Map[name]; !ok {
+			t.Errorf("missing file %q in %v", name, renamed)
+		}
+	}
+	b, err := json.Marshal(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded reflow.Fileset
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(renamed) {
+		t.Errorf("got %v, want %v", decoded, renamed)
+	}
+
+	n := newFilenamer(reflow.FilenameEscape)
+	if _, err := n.Name("a%01"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Name("a\x01"); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error for colliding names, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// GetFileset returns the fileset with digest d (see
+// reflow.Fileset.Digest) that is the result of one of the executor's
+// completed execs, e.g., a previous intern, so that filesets may be
+// passed by reference. Only filesets whose objects are present in the
+// executor's repository are returned; GetFileset returns an
+// errors.NotExist error if there is no such fileset.
+func (e *Executor) GetFileset(ctx context.Context, d digest.Digest) (reflow.Fileset, error) {
+	e.mu.Lock()
+	execs := make([]exec, 0, len(e.execs))
+	for _, x := range e.execs {
+		execs = append(execs, x)
+	}
+	e.mu.Unlock()
+	for _, x := range execs {
+		res, err := x.Result(ctx)
+		if err != nil || res.Err != nil || res.Fileset.Digest() != d {
+			continue
+		}
+		ok, err := e.hasObjects(ctx, res.Fileset)
+		if err != nil {
+			return reflow.Fileset{}, errors.E("getfileset", d, err)
+		}
+		if ok {
+			return res.Fileset, nil
+		}
+	}
+	return reflow.Fileset{}, errors.E("getfileset", d, errors.NotExist, errors.New("no such fileset"))
+}
+
+// hasObjects tells whether the objects of the files in fs (other
+// than reference files) are all present in the executor's repository.
+func (e *Executor) hasObjects(ctx context.Context, fs reflow.Fileset) (bool, error) {
+	for _, file := range fs.Files() {
+		if file.IsRef() {
+			continue
+		}
+		if _, err := e.FileRepository.Stat(ctx, file.ID); errors.Is(errors.NotExist, err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestGetFileset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exec, err := x.Put(ctx, reflow.Digester.FromString("intern"), reflow.ExecConfig{Type: intern, URL: "exec://echo hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := exec.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := x.GetFileset(ctx, res.Fileset.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fs.Equal(res.Fileset) {
+		t.Errorf("got %v, want %v", fs, res.Fileset)
+	}
+	if _, err := x.GetFileset(ctx, reflow.Digester.FromString("unknown")); !errors.Is(errors.NotExist, err) {
+		t.Errorf("expected NotExist error, got %v", err)
+	}
+}
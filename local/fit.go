@@ -0,0 +1,103 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/fs"
+)
+
+// CanFit tells whether an exec requiring resources r would fit in
+// the executor's currently available capacity. Available capacity
+// is the executor's total resources less the resources reserved by
+// its live (not yet completed) execs; disk is further bounded by the
+// free space on the executor's filesystem. When r does not fit,
+// CanFit also returns a reason describing the first shortfall.
+//
+// CanFit does not reserve any resources; its answer may be
+// invalidated by subsequent calls to Put.
+func (e *Executor) CanFit(r reflow.Resources) (bool, string) {
+	var avail reflow.Resources
+	avail.Sub(e.Resources(), e.reserved())
+	if _, ok := r["disk"]; ok {
+		if usage, err := fs.Stat(filepath.Join(e.Prefix, e.Dir)); err == nil {
+			if free := float64(usage.Avail); free < avail["disk"] {
+				avail["disk"] = free
+			}
+		} else {
+			e.Log.Errorf("stat %s: %v", filepath.Join(e.Prefix, e.Dir), err)
+		}
+	}
+	if reason := shortfall(r, avail); reason != "" {
+		return false, reason
+	}
+	return true, ""
+}
+
+// EstimateBatch returns the total resources required to run the
+// provided execs fully in parallel, applying their resource hints.
+// If the total exceeds the executor's resources, EstimateBatch
+// returns the total along with an errors.ResourcesExhausted error
+// describing the first shortfall. Unlike CanFit, the total is
+// compared against the executor's full capacity, regardless of its
+// current load; this lets callers plan how many executors a batch
+// requires before it is dispatched.
+func (e *Executor) EstimateBatch(cfgs []reflow.ExecConfig) (reflow.Resources, error) {
+	var total reflow.Resources
+	for _, cfg := range cfgs {
+		total.Add(total, hintedResources(cfg))
+	}
+	if reason := shortfall(total, e.Resources()); reason != "" {
+		return total, errors.E("estimatebatch", errors.ResourcesExhausted, errors.New(reason))
+	}
+	return total, nil
+}
+
+// shortfall describes the first (by name) resource of which need
+// requires more than have; it returns the empty string if have
+// suffices.
+func shortfall(need, have reflow.Resources) string {
+	keys := make([]string, 0, len(need))
+	for key := range need {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if n, h := need[key], have[key]; n > h {
+			return fmt.Sprintf("insufficient %s: need %g, have %g", key, n, h)
+		}
+	}
+	return ""
+}
+
+// reserved returns the sum of resources reserved by the executor's
+// live execs. Execs that have failed (including aborted execs) do not
+// hold reservations.
+func (e *Executor) reserved() reflow.Resources {
+	e.mu.Lock()
+	execs := make([]exec, 0, len(e.execs))
+	for _, x := range e.execs {
+		execs = append(execs, x)
+	}
+	e.mu.Unlock()
+	var reserved reflow.Resources
+	for _, x := range execs {
+		d, ok := x.(*dockerExec)
+		if !ok {
+			continue
+		}
+		d.mu.Lock()
+		if d.State < execComplete && d.err == nil {
+			reserved.Add(reserved, d.resources())
+		}
+		d.mu.Unlock()
+	}
+	return reserved
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestCanFit(t *testing.T) {
+	x := &Executor{execs: make(map[digest.Digest]exec)}
+	x.SetResources(reflow.Resources{"mem": 10 << 30, "cpu": 4})
+	running := &dockerExec{}
+	running.State = execRunning
+	running.Config.Resources = reflow.Resources{"mem": 6 << 30, "cpu": 1}
+	done := &dockerExec{}
+	done.State = execComplete
+	done.Config.Resources = reflow.Resources{"mem": 4 << 30, "cpu": 3}
+	x.execs[reflow.Digester.FromString("running")] = running
+	x.execs[reflow.Digester.FromString("done")] = done
+
+	if ok, reason := x.CanFit(reflow.Resources{"mem": 4 << 30, "cpu": 3}); !ok {
+		t.Errorf("expected fit, got %s", reason)
+	}
+	ok, reason := x.CanFit(reflow.Resources{"mem": 5 << 30, "cpu": 1})
+	if ok {
+		t.Error("expected no fit")
+	}
+	if !strings.Contains(reason, "mem") {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	running.State = execComplete
+	if ok, reason := x.CanFit(reflow.Resources{"mem": 10 << 30, "cpu": 4}); !ok {
+		t.Errorf("expected fit, got %s", reason)
+	}
+}
+
+func TestCanFitFailed(t *testing.T) {
+	x := &Executor{execs: make(map[digest.Digest]exec)}
+	x.SetResources(reflow.Resources{"mem": 10 << 30})
+	failed := &dockerExec{err: errAborted}
+	failed.State = execInit
+	failed.Config.Resources = reflow.Resources{"mem": 8 << 30}
+	x.execs[reflow.Digester.FromString("failed")] = failed
+	if ok, reason := x.CanFit(reflow.Resources{"mem": 10 << 30}); !ok {
+		t.Errorf("expected fit, got %s", reason)
+	}
+}
+
+func TestEstimateBatch(t *testing.T) {
+	x := &Executor{execs: make(map[digest.Digest]exec)}
+	x.SetResources(reflow.Resources{"mem": 10 << 30, "cpu": 4})
+	running := &dockerExec{}
+	running.State = execRunning
+	running.Config.Resources = reflow.Resources{"mem": 8 << 30, "cpu": 4}
+	x.execs[reflow.Digester.FromString("running")] = running
+
+	hinted := reflow.ExecConfig{
+		Resources: reflow.Resources{"mem": 1 << 30, "cpu": 1},
+		Args:      []reflow.Arg{{Fileset: &reflow.Fileset{Map: map[string]reflow.File{".": {Size: 3 << 30}}}}},
+		ResourceHint: func(size int64) reflow.Resources {
+			return reflow.Resources{"mem": float64(2 * size)}
+		},
+	}
+	cfgs := []reflow.ExecConfig{{Resources: reflow.Resources{"mem": 2 << 30, "cpu": 2}}, hinted}
+	total, err := x.EstimateBatch(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := total, (reflow.Resources{"mem": 8 << 30, "cpu": 3}); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	total, err = x.EstimateBatch(append(cfgs, hinted))
+	if !errors.Is(errors.ResourcesExhausted, err) {
+		t.Errorf("expected ResourcesExhausted error, got %v", err)
+	}
+	if got, want := total, (reflow.Resources{"mem": 14 << 30, "cpu": 4}); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSetResources(t *testing.T) {
+	x := &Executor{execs: make(map[digest.Digest]exec)}
+	if err := x.SetResources(reflow.Resources{"mem": 10 << 30, "cpu": 4}); err != nil {
+		t.Fatal(err)
+	}
+	running := &dockerExec{}
+	running.State = execRunning
+	running.Config.Resources = reflow.Resources{"mem": 6 << 30, "cpu": 1}
+	x.execs[reflow.Digester.FromString("running")] = running
+
+	if err := x.SetResources(reflow.Resources{"mem": 4 << 30, "cpu": 4}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+	if got, want := x.Resources(), (reflow.Resources{"mem": 10 << 30, "cpu": 4}); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := x.SetResources(reflow.Resources{"mem": 6 << 30, "cpu": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := x.CanFit(reflow.Resources{"cpu": 1}); !ok {
+		t.Error("expected fit")
+	}
+	if ok, _ := x.CanFit(reflow.Resources{"mem": 1 << 30}); ok {
+		t.Error("expected no fit")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A GCPolicy determines which completed execs are collected by
+// (*Executor).GC.
+type GCPolicy struct {
+	// Selector restricts collection to execs whose labels (see
+	// reflow.ExecConfig.Labels) include every one of its key-value
+	// pairs. A nil selector selects all execs.
+	Selector map[string]string
+	// MaxAge is the maximum age of selected execs: selected execs that
+	// were created longer than MaxAge ago are collected.
+	MaxAge time.Duration
+	// MaxCount is the maximum number of selected execs to retain: all
+	// but the MaxCount most recently created selected execs are
+	// collected.
+	MaxCount int
+	// RemoveContainers also removes the containers of collected execs
+	// that linger after the execs completed, e.g., because their
+	// removal failed at the time.
+	RemoveContainers bool
+}
+
+// A GCSummary describes what was removed by (*Executor).GC.
+type GCSummary struct {
+	// Execs are the IDs of the removed execs.
+	Execs []digest.Digest
+	// Containers are the names of the lingering containers that were
+	// removed with the execs.
+	Containers []string
+}
+
+// selects tells whether the policy's selector selects an exec with
+// the provided labels.
+func (p GCPolicy) selects(labels map[string]string) bool {
+	for k, v := range p.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// GC removes the completed execs that are selected by the policy
+// and exceed its age or count limits; if the policy defines neither
+// limit, all selected execs are removed. The directories of removed
+// execs are deleted; objects they have promoted to the executor's
+// repository are not affected. GC returns a summary of what was
+// removed, also when it fails partway through. Policies that differ
+// by workload are implemented by successive calls to GC, each with a
+// different selector.
+func (e *Executor) GC(ctx context.Context, policy GCPolicy) (GCSummary, error) {
+	e.mu.Lock()
+	if e.dead {
+		e.mu.Unlock()
+		return GCSummary{}, errors.E("gc", errors.NotExist, errDead)
+	}
+	execs := make([]exec, 0, len(e.execs))
+	for _, x := range e.execs {
+		execs = append(execs, x)
+	}
+	e.mu.Unlock()
+
+	type candidate struct {
+		x       exec
+		created time.Time
+	}
+	var selected []candidate
+	for _, x := range execs {
+		inspect, err := x.Inspect(ctx)
+		if err != nil {
+			return GCSummary{}, err
+		}
+		if inspect.State == "complete" && policy.selects(inspect.Config.Labels) {
+			selected = append(selected, candidate{x, inspect.Created})
+		}
+	}
+	// Order the execs from the most to the least recently created.
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].created.After(selected[j].created)
+	})
+	var (
+		now       = e.clock().Now()
+		unlimited = policy.MaxAge <= 0 && policy.MaxCount <= 0
+		summary   GCSummary
+	)
+	for n, c := range selected {
+		var (
+			old  = policy.MaxAge > 0 && now.Sub(c.created) > policy.MaxAge
+			over = policy.MaxCount > 0 && n >= policy.MaxCount
+		)
+		if !unlimited && !old && !over {
+			continue
+		}
+		id := c.x.ID()
+		if err := e.Remove(ctx, id); err != nil {
+			return summary, errors.E("gc", id, err)
+		}
+		if policy.RemoveContainers {
+			name, err := removeContainer(ctx, c.x)
+			if err != nil {
+				return summary, errors.E("gc", id, err)
+			}
+			if name != "" {
+				summary.Containers = append(summary.Containers, name)
+			}
+		}
+		if err := os.RemoveAll(e.execPath(id)); err != nil {
+			return summary, errors.E("gc", id, err)
+		}
+		summary.Execs = append(summary.Execs, id)
+	}
+	return summary, nil
+}
+
+// removeContainer removes the container of the exec x if x is a
+// Docker exec whose container still exists, returning the name of
+// the removed container.
+func removeContainer(ctx context.Context, x exec) (string, error) {
+	d, ok := x.(*dockerExec)
+	if !ok || d.client == nil {
+		return "", nil
+	}
+	name := d.containerName()
+	err := d.client.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true})
+	if docker.IsErrNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.E("ContainerRemove", name, kind(err), err)
+	}
+	return name, nil
+}
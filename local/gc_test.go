@@ -0,0 +1,82 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+)
+
+func TestGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := newFakeClock(time.Now())
+	x := &Executor{Dir: dir, Clock: clock, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	put := func(name, team string) digest.Digest {
+		t.Helper()
+		id := reflow.Digester.FromString(name)
+		cfg := reflow.ExecConfig{
+			Type:   intern,
+			URL:    "exec://echo " + name,
+			Labels: map[string]string{"team": team},
+		}
+		exec, err := x.Put(ctx, id, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exec.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		clock.mu.Lock()
+		clock.now = clock.now.Add(time.Minute)
+		clock.mu.Unlock()
+		return id
+	}
+	var (
+		scratch1 = put("scratch1", "scratch")
+		prod1    = put("prod1", "prod")
+		scratch2 = put("scratch2", "scratch")
+		prod2    = put("prod2", "prod")
+		scratch3 = put("scratch3", "scratch")
+	)
+	// Keep only the most recent scratch exec.
+	summary, err := x.GC(ctx, GCPolicy{Selector: map[string]string{"team": "scratch"}, MaxCount: 1, RemoveContainers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summary.Execs, []digest.Digest{scratch2, scratch1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Collect prod execs older than 3 minutes; prod1 was created 4 minutes ago.
+	if got := summary.Containers; len(got) != 0 {
+		t.Errorf("unexpected containers %v", got)
+	}
+	summary, err = x.GC(ctx, GCPolicy{Selector: map[string]string{"team": "prod"}, MaxAge: 3 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summary.Execs, []digest.Digest{prod1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, id := range []digest.Digest{prod2, scratch3} {
+		if _, err := x.Get(ctx, id); err != nil {
+			t.Errorf("%v: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+)
+
+// gpuUsage is the GPU usage of a single process.
+type gpuUsage struct {
+	// Util is the process's utilization of the GPU's streaming
+	// multiprocessors, as a fraction of one GPU.
+	Util float64
+	// Mem is the GPU memory used by the process, in bytes.
+	Mem float64
+}
+
+// nvidiaSMI runs nvidia-smi with the provided arguments, returning
+// its standard output. It may be replaced in tests.
+var nvidiaSMI = func(ctx context.Context, args ...string) ([]byte, error) {
+	return osexec.CommandContext(ctx, "nvidia-smi", args...).Output()
+}
+
+// sampleGPU returns the current GPU usage of each process (by host
+// PID) that is running on a GPU, as reported by nvidia-smi.
+func sampleGPU(ctx context.Context) (map[int]gpuUsage, error) {
+	pmon, err := nvidiaSMI(ctx, "pmon", "-c", "1", "-s", "u")
+	if err != nil {
+		return nil, err
+	}
+	apps, err := nvidiaSMI(ctx, "--query-compute-apps=pid,used_memory", "--format=csv,noheader,nounits")
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[int]gpuUsage)
+	for pid, util := range parsePmon(pmon) {
+		u := usage[pid]
+		u.Util += util
+		usage[pid] = u
+	}
+	for pid, mem := range parseComputeApps(apps) {
+		u := usage[pid]
+		u.Mem += mem
+		usage[pid] = u
+	}
+	return usage, nil
+}
+
+// parsePmon parses the output of "nvidia-smi pmon -s u", returning
+// the streaming multiprocessor utilization (as a fraction) of each
+// process. Processes that run on multiple GPUs are summed. Lines
+// whose utilization is not reported ("-") are skipped.
+//
+//	# gpu        pid  type    sm   mem   enc   dec   command
+//	# Idx          #   C/G     %     %     %     %   name
+//	    0      12345     C    45    10     -     -   python
+func parsePmon(out []byte) map[int]float64 {
+	util := make(map[int]float64)
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		sm, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			continue
+		}
+		util[pid] += sm / 100
+	}
+	return util
+}
+
+// parseComputeApps parses the output of "nvidia-smi
+// --query-compute-apps=pid,used_memory --format=csv,noheader,nounits",
+// returning the GPU memory (in bytes) used by each process.
+func parseComputeApps(out []byte) map[int]float64 {
+	mem := make(map[int]float64)
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Split(scan.Text(), ",")
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			continue
+		}
+		mib, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			continue
+		}
+		mem[pid] += mib * (1 << 20)
+	}
+	return mem
+}
+
+// containerPIDs returns the host PIDs of the processes running in the
+// exec's container.
+func (e *dockerExec) containerPIDs(ctx context.Context) (map[int]bool, error) {
+	top, err := e.client.ContainerTop(ctx, e.containerName(), nil)
+	if err != nil {
+		return nil, err
+	}
+	col := -1
+	for i, title := range top.Titles {
+		if title == "PID" {
+			col = i
+			break
+		}
+	}
+	pids := make(map[int]bool)
+	if col < 0 {
+		return pids, nil
+	}
+	for _, proc := range top.Processes {
+		if col >= len(proc) {
+			continue
+		}
+		if pid, err := strconv.Atoi(proc[col]); err == nil {
+			pids[pid] = true
+		}
+	}
+	return pids, nil
+}
+
+// gpuUsageOf returns the total GPU usage of the provided processes.
+func gpuUsageOf(usage map[int]gpuUsage, pids map[int]bool) (total gpuUsage) {
+	for pid, u := range usage {
+		if pids[pid] {
+			total.Util += u.Util
+			total.Mem += u.Mem
+		}
+	}
+	return
+}
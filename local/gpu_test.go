@@ -0,0 +1,41 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSampleGPU(t *testing.T) {
+	defer func(f func(context.Context, ...string) ([]byte, error)) { nvidiaSMI = f }(nvidiaSMI)
+	nvidiaSMI = func(ctx context.Context, args ...string) ([]byte, error) {
+		if args[0] == "pmon" {
+			return []byte(`# gpu        pid  type    sm   mem   enc   dec   command
+# Idx          #   C/G     %     %     %     %   name
+    0        100     C    50    10     -     -   python
+    1        100     C    25     5     -     -   python
+    1        200     C     -     -     -     -   idle
+    2          -     -     -     -     -     -   -
+`), nil
+		}
+		return []byte("100, 1024\n200, 512\n"), nil
+	}
+	usage, err := sampleGPU(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]gpuUsage{
+		100: {Util: 0.75, Mem: 1 << 30},
+		200: {Mem: 512 << 20},
+	}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("got %v, want %v", usage, want)
+	}
+	if got, want := gpuUsageOf(usage, map[int]bool{200: true, 300: true}), (gpuUsage{Mem: 512 << 20}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestWaitIdle(t *testing.T) {
+	var x Executor
+	ctx := context.Background()
+	if err := x.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	x.mu.Lock()
+	x.busy()
+	x.mu.Unlock()
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	err := x.WaitIdle(tctx)
+	cancel()
+	if got, want := err, context.DeadlineExceeded; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	errc := make(chan error)
+	go func() { errc <- x.WaitIdle(ctx) }()
+	// An exec that is added while WaitIdle is waiting is also awaited.
+	x.mu.Lock()
+	x.busy()
+	x.mu.Unlock()
+	x.done()
+	select {
+	case err := <-errc:
+		t.Fatalf("WaitIdle returned early: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	x.done()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitIdleExecs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waitidle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exec, err := x.Put(ctx, reflow.Digester.FromString("idle"), reflow.ExecConfig{Type: intern, URL: "exec://echo idle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Result(ctx); err != nil {
+		t.Errorf("exec is not complete: %v", err)
+	}
+}
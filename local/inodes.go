@@ -0,0 +1,36 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"path/filepath"
+
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/fs"
+)
+
+// inodeCheckInterval is the number of files installed or downloaded
+// by an intern between checks of the executor's free inodes.
+const inodeCheckInterval = 1024
+
+// checkInodes returns an errors.ResourcesExhausted error if fewer
+// than the executor's MinFreeInodes inodes are free on the file
+// system of its directory. File systems that do not report inode
+// counts are not checked.
+func (e *Executor) checkInodes() error {
+	if e.MinFreeInodes == 0 {
+		return nil
+	}
+	dir := filepath.Join(e.Prefix, e.Dir)
+	usage, err := fs.Stat(dir)
+	if err != nil {
+		return errors.E("statfs", dir, err)
+	}
+	if usage.Inodes == 0 || usage.FreeInodes >= e.MinFreeInodes {
+		return nil
+	}
+	return errors.E(errors.ResourcesExhausted,
+		errors.Errorf("%s has %d free inodes, fewer than the required %d", dir, usage.FreeInodes, e.MinFreeInodes))
+}
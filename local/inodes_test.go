@@ -0,0 +1,42 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/fs"
+)
+
+func TestCheckInodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	usage, err := fs.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Inodes == 0 {
+		t.Skip("file system does not report inodes")
+	}
+	x := &Executor{Dir: dir}
+	if err := x.checkInodes(); err != nil {
+		t.Error(err)
+	}
+	x.MinFreeInodes = 1
+	if err := x.checkInodes(); err != nil {
+		t.Error(err)
+	}
+	x.MinFreeInodes = math.MaxUint64
+	if err := x.checkInodes(); !errors.Is(errors.ResourcesExhausted, err) {
+		t.Errorf("got %v, want %v", err, errors.ResourcesExhausted)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// inputsDir is the directory in the executor's directory in which
+// shared inputs are staged; see Executor.SharedInputs.
+const inputsDir = "inputs"
+
+// A sharedInput is an input fileset staged for the execs that use it.
+type sharedInput struct {
+	// refs is the number of execs using the input.
+	refs int
+	// done is closed once the input is staged; err is the staging
+	// error, if any.
+	done chan struct{}
+	err  error
+}
+
+// inputPath returns the path of the shared input with digest d.
+func (e *Executor) inputPath(d digest.Digest) string {
+	return filepath.Join(e.Prefix, e.Dir, inputsDir, d.Hex())
+}
+
+// inputHostPath returns the host path of the shared input with
+// digest d.
+func (e *Executor) inputHostPath(d digest.Digest) string {
+	return filepath.Join(e.Dir, inputsDir, d.Hex())
+}
+
+// acquireInput acquires a reference to the shared input fs, whose
+// digest is d, staging it if it is not already staged.
+func (e *Executor) acquireInput(d digest.Digest, fs reflow.Fileset) error {
+	e.inputsMu.Lock()
+	if e.inputs == nil {
+		e.inputs = make(map[digest.Digest]*sharedInput)
+	}
+	in := e.inputs[d]
+	first := in == nil
+	if first {
+		in = &sharedInput{done: make(chan struct{})}
+		e.inputs[d] = in
+	}
+	in.refs++
+	e.inputsMu.Unlock()
+	if first {
+		in.err = e.stageInput(d, fs)
+		close(in.done)
+	}
+	<-in.done
+	if in.err != nil {
+		e.releaseInput(d)
+		return in.err
+	}
+	return nil
+}
+
+// releaseInput releases a reference to the shared input with digest
+// d. The input is removed once it is no longer referenced.
+func (e *Executor) releaseInput(d digest.Digest) {
+	e.inputsMu.Lock()
+	in := e.inputs[d]
+	if in == nil {
+		e.inputsMu.Unlock()
+		return
+	}
+	if in.refs--; in.refs > 0 {
+		e.inputsMu.Unlock()
+		return
+	}
+	delete(e.inputs, d)
+	// Move the input aside while the lock is held, so that it does
+	// not race with a subsequent staging of the same input.
+	var (
+		path = e.inputPath(d)
+		dead = path + ".dead"
+	)
+	err := os.Rename(path, dead)
+	e.inputsMu.Unlock()
+	if err == nil {
+		err = os.RemoveAll(dead)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		e.Log.Errorf("failed to remove shared input %v: %v", d, err)
+	}
+}
+
+// stageInput stages the fileset fs, whose digest is d, into its
+// shared input directory. The files are hard linked from the
+// executor's repository, or copied where hard links are not possible.
+// The input is staged in a temporary directory, which is renamed into
+// place when complete, so that a staged input is always complete.
+func (e *Executor) stageInput(d digest.Digest, fs reflow.Fileset) error {
+	path := e.inputPath(d)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return errors.E("stage", d, err)
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(path), "stage-")
+	if err != nil {
+		return errors.E("stage", d, err)
+	}
+	for p, file := range fs.Map {
+		_, src := e.FileRepository.Path(file.ID)
+		dst := filepath.Join(tmp, p)
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			os.RemoveAll(tmp)
+			return errors.E("stage", d, p, err)
+		}
+		err := linkOrCopy(src, dst)
+		if os.IsNotExist(err) {
+			// The object may be compressed; see filerepo.Repository.Codec.
+			err = e.FileRepository.Materialize(tmp, map[string]digest.Digest{p: file.ID})
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return errors.E("stage", d, p, err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.RemoveAll(tmp)
+		if _, serr := os.Stat(path); serr == nil {
+			// The input was staged concurrently, e.g., by a previous
+			// executor process.
+			return nil
+		}
+		return errors.E("stage", d, err)
+	}
+	return nil
+}
+
+// linkOrCopy hard links the file src to dst, or copies it if it
+// cannot be linked, e.g., because dst is on a different device.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0444)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// shareable tells whether the (flattened) input fileset fs may be
+// shared. Single-file inputs are materialized as files, and are not
+// shared.
+func shareable(fs reflow.Fileset) bool {
+	_, ok := fs.Map["."]
+	return !ok
+}
+
+// acquireInputs acquires the shared inputs of the exec, if the
+// executor shares inputs and they have not already been acquired.
+func (e *dockerExec) acquireInputs() error {
+	if !e.Executor.SharedInputs || e.inputs != nil {
+		return nil
+	}
+	inputs := make([]digest.Digest, 0, len(e.Config.Args))
+	for _, arg := range e.Config.Args {
+		if arg.Out {
+			continue
+		}
+		for _, fs := range arg.Fileset.Flatten() {
+			if !shareable(fs) {
+				continue
+			}
+			d := fs.Digest()
+			if err := e.Executor.acquireInput(d, fs); err != nil {
+				for _, d := range inputs {
+					e.Executor.releaseInput(d)
+				}
+				return err
+			}
+			inputs = append(inputs, d)
+		}
+	}
+	e.inputs = inputs
+	return nil
+}
+
+// releaseInputs releases the shared inputs acquired by the exec.
+func (e *dockerExec) releaseInputs() {
+	for _, d := range e.inputs {
+		e.Executor.releaseInput(d)
+	}
+	e.inputs = nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+func TestSharedInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	x := &Executor{Dir: dir, FileRepository: &filerepo.Repository{Root: filepath.Join(dir, "repo")}}
+	fs := reflow.Fileset{Map: map[string]reflow.File{}}
+	for _, p := range []string{"a", "b/c"} {
+		id, err := x.FileRepository.Put(ctx, strings.NewReader(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs.Map[p] = reflow.File{ID: id, Size: int64(len(p))}
+	}
+	d := fs.Digest()
+	for i := 0; i < 2; i++ {
+		if err := x.acquireInput(d, fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p := range fs.Map {
+		b, err := ioutil.ReadFile(filepath.Join(x.inputPath(d), p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), p; got != want {
+			t.Errorf("%s: got %q, want %q", p, got, want)
+		}
+	}
+	x.releaseInput(d)
+	if _, err := os.Stat(x.inputPath(d)); err != nil {
+		t.Errorf("input removed while still referenced: %v", err)
+	}
+	x.releaseInput(d)
+	if _, err := os.Stat(x.inputPath(d)); !os.IsNotExist(err) {
+		t.Errorf("input not removed: %v", err)
+	}
+}
+
+func TestLinkOrCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linkorcopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err := linkOrCopy(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "hello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
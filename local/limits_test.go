@@ -0,0 +1,113 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestCheckLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, path := range []string{"a", "b/c", "b/d"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("0123456789"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		cfg reflow.ExecConfig
+		ok  bool
+	}{
+		{reflow.ExecConfig{}, true},
+		{reflow.ExecConfig{MaxFiles: 3}, true},
+		{reflow.ExecConfig{MaxFiles: 2}, false},
+		{reflow.ExecConfig{MaxTotalBytes: 30}, true},
+		{reflow.ExecConfig{MaxTotalBytes: 29}, false},
+		// Output limits do not apply to interns.
+		{reflow.ExecConfig{MaxOutputFiles: 1}, true},
+	} {
+		err := checkLimits(dir, newInternLimits(c.cfg))
+		if c.ok && err != nil {
+			t.Errorf("%+v: unexpected error %v", c.cfg, err)
+		}
+		if !c.ok && !errors.Is(errors.ResourcesExhausted, err) {
+			t.Errorf("%+v: expected resources exhausted error, got %v", c.cfg, err)
+		}
+	}
+}
+
+func TestOutputLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputlimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i, c := range []struct {
+		cfg reflow.ExecConfig
+		ok  bool
+	}{
+		{reflow.ExecConfig{}, true},
+		// Limits apply across all of the exec's outputs.
+		{reflow.ExecConfig{MaxOutputFiles: 3}, true},
+		{reflow.ExecConfig{MaxOutputFiles: 2}, false},
+		{reflow.ExecConfig{MaxOutputBytes: 30}, true},
+		{reflow.ExecConfig{MaxOutputBytes: 29}, false},
+		{reflow.ExecConfig{MaxOutputFiles: 2, LazyDigests: true}, false},
+		{reflow.ExecConfig{MaxOutputBytes: 29, LazyDigests: true}, false},
+		{reflow.ExecConfig{MaxOutputFiles: 3, MaxOutputBytes: 30, LazyDigests: true}, true},
+		// Intern limits do not apply to outputs.
+		{reflow.ExecConfig{MaxFiles: 1, MaxTotalBytes: 1}, true},
+	} {
+		cfg := c.cfg
+		cfg.OutputIsDir = []bool{true, true}
+		e := newDockerExec(reflow.Digester.FromString(fmt.Sprint(i)), x, cfg, nil, nil)
+		for _, path := range []string{"0/a", "1/b", "1/c/d"} {
+			path = filepath.Join(e.returnPath(), path)
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte("0123456789"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := e.install(ctx)
+		if c.ok && err != nil {
+			t.Errorf("%+v: unexpected error %v", c.cfg, err)
+		}
+		if !c.ok && !errors.Is(errors.ResourcesExhausted, err) {
+			t.Errorf("%+v: expected resources exhausted error, got %v", c.cfg, err)
+		}
+		if !c.ok {
+			continue
+		}
+		fs := e.Manifest.Result.Fileset
+		if got, want := len(fs.List), 2; got != want {
+			t.Fatalf("%+v: got %d outputs, want %d", c.cfg, got, want)
+		}
+		if got, want := fs.N(), 3; got != want {
+			t.Errorf("%+v: got %d files, want %d", c.cfg, got, want)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/grailbio/base/sync/once"
@@ -51,6 +52,7 @@ func newLocalfileExec(id digest.Digest, x *Executor, cfg reflow.ExecConfig) *loc
 		cfg:      cfg,
 	}
 	e.staging.Root = e.Executor.execPath(e.id, objectsDir)
+	e.staging.BlockSize = x.DigestBlockSize
 	e.staging.Log = x.Log
 	e.cond = sync.NewCond(&e.mu)
 	return e
@@ -80,10 +82,17 @@ func (e *localfileExec) do(ctx context.Context) error {
 	}
 	switch e.cfg.Type {
 	case "intern":
-		e.fs, err = e.Executor.install(ctx, filepath.Join(e.Executor.Prefix, u.Host+u.Path), false, &e.staging)
+		if err := checkLimits(filepath.Join(e.Executor.Prefix, u.Host+u.Path), newInternLimits(e.cfg)); err != nil {
+			return errors.E("exec", e.id, e.cfg.URL, err)
+		}
+		e.fs, err = e.Executor.install(ctx, filepath.Join(e.Executor.Prefix, u.Host+u.Path), false, &e.staging, nil, e.Executor.digests)
+		if err == nil {
+			e.fs, err = newFilenamer(e.cfg.FilenamePolicy).Rename(e.fs)
+		}
 		if err != nil {
 			e.Log.Errorf("installing %s: %v", filepath.Join(e.Executor.Prefix, u.Path), err)
 		} else {
+			setSources(e.fs, e.cfg.URL)
 			e.Log.Printf("installed %s: %v", filepath.Join(e.Executor.Prefix, u.Path), e.fs.Short())
 		}
 		return err
@@ -103,6 +112,20 @@ func (e *localfileExec) do(ctx context.Context) error {
 	}
 }
 
+// setSources records the provenance of each file in the interned
+// fileset fs: its Source is set to the file's location under the
+// interned URL u.
+func setSources(fs reflow.Fileset, u string) {
+	for path, file := range fs.Map {
+		if path == "." {
+			file.Source = u
+		} else {
+			file.Source = strings.TrimSuffix(u, "/") + "/" + path
+		}
+		fs.Map[path] = file
+	}
+}
+
 // setState sets the current state and error. It broadcasts
 // on the exec's condition variable to wake up all waiters.
 func (e *localfileExec) setState(state execState, err error) {
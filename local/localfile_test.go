@@ -0,0 +1,37 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestSetSources(t *testing.T) {
+	for _, c := range []struct {
+		url  string
+		fs   reflow.Fileset
+		want map[string]string
+	}{
+		{
+			"localfile:///data/file",
+			reflow.Fileset{Map: map[string]reflow.File{".": {}}},
+			map[string]string{".": "localfile:///data/file"},
+		},
+		{
+			"localfile:///data/dir/",
+			reflow.Fileset{Map: map[string]reflow.File{"a": {}, "b/c": {}}},
+			map[string]string{"a": "localfile:///data/dir/a", "b/c": "localfile:///data/dir/b/c"},
+		},
+	} {
+		setSources(c.fs, c.url)
+		for path, want := range c.want {
+			if got := c.fs.Map[path].Source; got != want {
+				t.Errorf("%s: got %v, want %v", path, got, want)
+			}
+		}
+	}
+}
@@ -18,6 +18,7 @@ type execType int
 const (
 	execDocker execType = iota
 	execBlob
+	execScheme
 )
 
 // Manifest stores the state of an exec. It is serialized to JSON and
@@ -36,4 +37,26 @@ type Manifest struct {
 	Resources reflow.Resources
 	Stats     stats
 	Gauges    reflow.Gauges
+	// Attempts is the number of times the exec's container has been
+	// created; see ExecConfig.MemoryRetryFactor.
+	Attempts int
+	// RetryMemory is the memory requirement (in bytes) of an exec that
+	// is being retried after it was OOM-killed; it overrides the
+	// requirement in Config, which is left as it was put. Zero means
+	// the exec runs with Config's requirement.
+	RetryMemory float64 `json:",omitempty"`
+	// RetryMemoryLimit is the container memory limit that accompanies
+	// RetryMemory, if Config specifies a memory limit.
+	RetryMemoryLimit float64 `json:",omitempty"`
+	// ContainerID is the ID of the exec's (most recently created)
+	// Docker container.
+	ContainerID string `json:",omitempty"`
+	// Transfer summarizes the data transferred by a completed blob
+	// exec.
+	Transfer *reflow.TransferStats `json:",omitempty"`
+	// Version is the version of the Reflow executor that created the
+	// exec; see Executor.Version.
+	Version string `json:",omitempty"`
+	// Warnings are the exec's warnings; see reflow.ExecInspect.
+	Warnings []string `json:",omitempty"`
 }
@@ -0,0 +1,64 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		a   = &Executor{Dir: dir, Namespace: "a", InternCommands: []string{"echo"}}
+		b   = &Executor{Dir: dir, Namespace: "b", InternCommands: []string{"echo"}}
+		id  = reflow.Digester.FromString("shared")
+		ctx = context.Background()
+	)
+	for _, x := range []*Executor{a, b} {
+		if err := x.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.execPath(id) == b.execPath(id) {
+		t.Errorf("namespaces share exec path %s", a.execPath(id))
+	}
+	for _, x := range []*Executor{a, b} {
+		exec, err := x.Put(ctx, id, reflow.ExecConfig{Type: intern, URL: "exec://echo " + x.Namespace})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exec.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, x := range []*Executor{a, b} {
+		exec, err := x.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := exec.Result(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := res.Fileset.Map["."].ID, reflow.Digester.FromString(x.Namespace+"\n"); got != want {
+			t.Errorf("%s: got %v, want %v", x.Namespace, got, want)
+		}
+	}
+
+	x := &Executor{Dir: dir, Namespace: "a/b"}
+	if err := x.Start(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
@@ -3,8 +3,16 @@ package local
 import (
 	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"docker.io/go-docker"
+	"github.com/grailbio/reflow"
 )
 
 const dockerFmt = "2006-01-02T15:04:05.999999999Z"
@@ -62,3 +70,118 @@ func TestLastOOMKill(t *testing.T) {
 		}
 	}
 }
+
+func TestNextMemory(t *testing.T) {
+	const G = 1 << 30
+	for _, c := range []struct {
+		mem, factor, max, next float64
+		ok                     bool
+	}{
+		{2 * G, 2, 16 * G, 4 * G, true},
+		{10 * G, 2, 16 * G, 16 * G, true},
+		{16 * G, 2, 16 * G, 0, false},
+		{2 * G, 1, 16 * G, 0, false},
+		{2 * G, 0, 16 * G, 0, false},
+		{0, 2, 16 * G, 0, false},
+	} {
+		next, ok := nextMemory(c.mem, c.factor, c.max)
+		if got, want := ok, c.ok; got != want {
+			t.Errorf("nextMemory(%g, %g, %g): got %v, want %v", c.mem, c.factor, c.max, got, want)
+		}
+		if got, want := next, c.next; got != want {
+			t.Errorf("nextMemory(%g, %g, %g): got %g, want %g", c.mem, c.factor, c.max, got, want)
+		}
+	}
+}
+
+func TestRetryOOM(t *testing.T) {
+	const M = 1 << 20
+	var (
+		mu      sync.Mutex
+		removed []string
+	)
+	// The retry removes the OOM-killed container; this is the only
+	// Docker API call it makes.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || !strings.Contains(r.URL.Path, "/containers/") {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		removed = append(removed, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	client, err := docker.NewClient("tcp://"+srv.Listener.Addr().String(), "1.22", srv.Client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "retryoom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, Client: client}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.SetResources(reflow.Resources{"mem": 1000 * M}); err != nil {
+		t.Fatal(err)
+	}
+	other := newDockerExec(reflow.Digester.FromString("other"), x, reflow.ExecConfig{Resources: reflow.Resources{"mem": 600 * M}}, nil, nil)
+	other.State = execRunning
+	cfg := reflow.ExecConfig{
+		Resources:         reflow.Resources{"mem": 100 * M},
+		Limits:            reflow.Resources{"mem": 200 * M},
+		MemoryRetryFactor: 8,
+	}
+	id := reflow.Digester.FromString("oom")
+	e := newDockerExec(id, x, cfg, nil, nil)
+	e.State = execRunning
+	e.Manifest.Attempts = 1
+	e.diskExceeded = "disk usage exceeded"
+	e.Manifest.Warnings = []string{e.diskExceeded}
+	x.mu.Lock()
+	x.execs[other.id] = other
+	x.execs[id] = e
+	x.mu.Unlock()
+
+	ctx := context.Background()
+	if !e.retryOOM(ctx) {
+		t.Fatal("expected exec to be retried")
+	}
+	// The retry is bounded by the memory not reserved by the other exec.
+	if got, want := e.resources()["mem"], float64(400*M); got != want {
+		t.Errorf("got memory %g, want %g", got, want)
+	}
+	if got, want := e.memoryLimit(), float64(1600*M); got != want {
+		t.Errorf("got memory limit %g, want %g", got, want)
+	}
+	if got, want := x.reserved()["mem"], float64(1000*M); got != want {
+		t.Errorf("got reserved %g, want %g", got, want)
+	}
+	// The config is left as it was put.
+	if got, want := e.Config.Resources["mem"], float64(100*M); got != want {
+		t.Errorf("got config memory %g, want %g", got, want)
+	}
+	if got, want := e.Config.Limits["mem"], float64(200*M); got != want {
+		t.Errorf("got config memory limit %g, want %g", got, want)
+	}
+	if e.diskExceeded != "" || len(e.Manifest.Warnings) != 0 {
+		t.Errorf("warnings were not reset: %q, %v", e.diskExceeded, e.Manifest.Warnings)
+	}
+	mu.Lock()
+	if got, want := removed, []string{e.containerName()}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got removed containers %v, want %v", got, want)
+	}
+	mu.Unlock()
+
+	// No memory is left to retry with.
+	if e.retryOOM(ctx) {
+		t.Error("expected exec not to be retried")
+	}
+	if got, want := e.resources()["mem"], float64(400*M); got != want {
+		t.Errorf("got memory %g, want %g", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/walker"
+)
+
+// filterOutputs removes the files in the exec's output directories
+// that match its output filter; see reflow.ExecConfig.OutputFilter.
+func (e *dockerExec) filterOutputs() error {
+	if len(e.Config.OutputFilter) == 0 {
+		return nil
+	}
+	names := []string{"default"}
+	if outputs := e.Config.OutputIsDir; outputs != nil {
+		names = make([]string, len(outputs))
+		for i := range outputs {
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	for _, name := range names {
+		dir := e.returnPath(name)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		var (
+			w       walker.Walker
+			dropped []string
+		)
+		w.Init(dir)
+		for w.Scan() {
+			if w.Info().IsDir() {
+				continue
+			}
+			if relpath := filepath.ToSlash(w.Relpath()); filtered(e.Config.OutputFilter, relpath) {
+				dropped = append(dropped, w.Path())
+			}
+		}
+		if err := w.Err(); err != nil {
+			return errors.E("filter", name, err)
+		}
+		for _, file := range dropped {
+			if err := os.Remove(file); err != nil {
+				return errors.E("filter", name, err)
+			}
+		}
+		if len(dropped) > 0 {
+			e.Log.Debugf("dropped %d files from output %s", len(dropped), name)
+		}
+	}
+	return nil
+}
+
+// filtered tells whether the output file with the provided relative
+// path matches any of the patterns.
+func filtered(patterns []string, relpath string) bool {
+	for _, pattern := range patterns {
+		name := relpath
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(relpath)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
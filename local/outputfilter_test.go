@@ -0,0 +1,52 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestFilterOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	e := newDockerExec(reflow.Digester.FromString("filter"), x, reflow.ExecConfig{
+		OutputFilter: []string{"*.tmp", "scratch/*"},
+	}, nil, nil)
+	for _, name := range []string{"a", "a.tmp", "sub/b.tmp", "sub/c", "scratch/d", "sub/scratch/e"} {
+		path := e.returnPath("default", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.filterOutputs(); err != nil {
+		t.Fatal(err)
+	}
+	for name, kept := range map[string]bool{
+		"a": true, "a.tmp": false, "sub/b.tmp": false, "sub/c": true, "scratch/d": false, "sub/scratch/e": true,
+	} {
+		_, err := os.Stat(e.returnPath("default", name))
+		if kept && err != nil {
+			t.Errorf("%s: expected file to be kept, got %v", name, err)
+		}
+		if !kept && !os.IsNotExist(err) {
+			t.Errorf("%s: expected file to be dropped, got %v", name, err)
+		}
+	}
+}
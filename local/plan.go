@@ -0,0 +1,112 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"strings"
+
+	"docker.io/go-docker/api/types"
+	"github.com/grailbio/reflow"
+)
+
+// Planner is implemented by execs that can describe exactly how
+// they are run.
+type Planner interface {
+	// Plan returns the exec's resolved plan. It is available once the
+	// exec's container has been created.
+	Plan(ctx context.Context) (ExecPlan, error)
+}
+
+// An ExecPlan is the fully resolved description of how an exec is
+// run, as determined by the executor from the exec's
+// reflow.ExecConfig. Plans are comparable across runs: for example,
+// diffing the plans of two runs of the same exec shows what changed
+// between them.
+type ExecPlan struct {
+	// Image is the image reference provided by the exec's config.
+	Image string
+	// ImageID is the ID (digest) of the image to which Image resolved.
+	ImageID string
+	// Command is the full command run in the container, including any
+	// wrapper and the bash invocation, with arguments substituted.
+	Command []string
+	// Env is the container's environment. The values of AWS
+	// credentials are redacted.
+	Env []string
+	// Binds are the container's volume bindings, in Docker's
+	// "host:container" form.
+	Binds []string
+	// Tmpfs maps the container's tmpfs mounts to their options.
+	Tmpfs map[string]string `json:",omitempty"`
+	// User is the user (and group) as which the command is run.
+	User string
+	// Runtime is the Docker runtime of the container; empty if the
+	// daemon's default runtime is used.
+	Runtime string `json:",omitempty"`
+	// Init tells whether the container runs an init process that
+	// reaps zombie processes.
+	Init bool `json:",omitempty"`
+	// ShmSize is the size of the container's /dev/shm; zero if
+	// Docker's default is used.
+	ShmSize int64 `json:",omitempty"`
+	// Resources are the resources requested by the exec.
+	Resources reflow.Resources
+	// Limits are the resource limits enforced on the container:
+	// "mem" is its memory limit and "cpu" its CPU quota.
+	Limits reflow.Resources `json:",omitempty"`
+}
+
+// Plan implements Planner. Plans are derived from the exec's
+// container, and are thus available once the container has been
+// created, including for completed execs.
+func (e *dockerExec) Plan(ctx context.Context) (ExecPlan, error) {
+	info, err := e.containerInfo(ctx, "plan")
+	if err != nil {
+		return ExecPlan{}, err
+	}
+	return containerPlan(e.Config, info), nil
+}
+
+// containerPlan returns the plan of an exec with the provided config
+// that was run in the inspected container.
+func containerPlan(cfg reflow.ExecConfig, info types.ContainerJSON) ExecPlan {
+	plan := ExecPlan{
+		Image:     cfg.Image,
+		ImageID:   info.Image,
+		User:      info.Config.User,
+		Runtime:   info.HostConfig.Runtime,
+		ShmSize:   info.HostConfig.ShmSize,
+		Resources: cfg.Resources,
+	}
+	if init := info.HostConfig.Init; init != nil {
+		plan.Init = *init
+	}
+	plan.Command = append(plan.Command, info.Config.Entrypoint...)
+	plan.Command = append(plan.Command, info.Config.Cmd...)
+	for _, env := range info.Config.Env {
+		if strings.HasPrefix(env, "AWS_") {
+			env = strings.SplitN(env, "=", 2)[0] + "=<redacted>"
+		}
+		plan.Env = append(plan.Env, env)
+	}
+	plan.Binds = append(plan.Binds, info.HostConfig.Binds...)
+	if len(info.HostConfig.Tmpfs) > 0 {
+		plan.Tmpfs = make(map[string]string)
+		for path, opts := range info.HostConfig.Tmpfs {
+			plan.Tmpfs[path] = opts
+		}
+	}
+	if mem := info.HostConfig.Resources.Memory; mem > 0 {
+		plan.Limits = reflow.Resources{"mem": float64(mem)}
+	}
+	if cpu := info.HostConfig.Resources.NanoCPUs; cpu > 0 {
+		if plan.Limits == nil {
+			plan.Limits = make(reflow.Resources)
+		}
+		plan.Limits["cpu"] = float64(cpu) / 1e9
+	}
+	return plan
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"reflect"
+	"testing"
+
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/grailbio/reflow"
+)
+
+func TestContainerPlan(t *testing.T) {
+	cfg := reflow.ExecConfig{
+		Image:     "ubuntu",
+		Resources: reflow.Resources{"mem": 1024, "cpu": 1},
+	}
+	init := true
+	hostConfig := &container.HostConfig{
+		Binds:   []string{"/x/arg:/arg", "/x/return:/return"},
+		Runtime: "runsc",
+		Init:    &init,
+	}
+	hostConfig.Resources.Memory = 2048
+	hostConfig.Resources.NanoCPUs = 2e9
+	info := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Image:      "sha256:1234",
+			HostConfig: hostConfig,
+		},
+		Config: &container.Config{
+			Entrypoint: []string{"/bin/bash", "-c", "echo hello"},
+			Env:        []string{"tmp=/tmp", "AWS_SECRET_ACCESS_KEY=secret"},
+			User:       "1000:1000",
+		},
+	}
+	got := containerPlan(cfg, info)
+	want := ExecPlan{
+		Image:     "ubuntu",
+		ImageID:   "sha256:1234",
+		Command:   []string{"/bin/bash", "-c", "echo hello"},
+		Env:       []string{"tmp=/tmp", "AWS_SECRET_ACCESS_KEY=<redacted>"},
+		Binds:     []string{"/x/arg:/arg", "/x/return:/return"},
+		User:      "1000:1000",
+		Runtime:   "runsc",
+		Init:      true,
+		Resources: reflow.Resources{"mem": 1024, "cpu": 1},
+		Limits:    reflow.Resources{"mem": 2048, "cpu": 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
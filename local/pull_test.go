@@ -0,0 +1,71 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/limiter"
+)
+
+func TestLimitPull(t *testing.T) {
+	const (
+		N     = 10
+		limit = 2
+	)
+	pulls := limiter.New()
+	pulls.Release(limit)
+	var (
+		ctx          = context.Background()
+		wg           sync.WaitGroup
+		running, max int64
+		sawQueued    int32
+	)
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := limitPull(ctx, pulls, func() error {
+				n := atomic.AddInt64(&running, 1)
+				defer atomic.AddInt64(&running, -1)
+				for {
+					m := atomic.LoadInt64(&max)
+					if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+						break
+					}
+				}
+				if queuedPulls.Value() > 0 {
+					atomic.StoreInt32(&sawQueued, 1)
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := max, int64(limit); got > want {
+		t.Errorf("got %v concurrent pulls, want at most %v", got, want)
+	}
+	if atomic.LoadInt32(&sawQueued) == 0 {
+		t.Error("no pulls were queued")
+	}
+	if got, want := queuedPulls.Value(), int64(0); got != want {
+		t.Errorf("got %v queued pulls, want %v", got, want)
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	pulls = limiter.New()
+	if err := limitPull(cancelCtx, pulls, func() error { return nil }); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestConfigMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "middleware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	x.ConfigMiddleware = func(cfg reflow.ExecConfig) (reflow.ExecConfig, error) {
+		if cfg.Labels["team"] == "" {
+			return cfg, errors.E(errors.NotAllowed, errors.New("execs must be labeled with a team"))
+		}
+		cfg.URL = "exec://echo " + cfg.Labels["team"]
+		return cfg, nil
+	}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	_, err = x.Put(ctx, reflow.Digester.FromString("unlabeled"), reflow.ExecConfig{Type: intern, URL: "exec://echo hello"})
+	if !errors.Is(errors.NotAllowed, err) {
+		t.Errorf("expected NotAllowed error, got %v", err)
+	}
+	exec, err := x.Put(ctx, reflow.Digester.FromString("labeled"), reflow.ExecConfig{
+		Type:   intern,
+		URL:    "exec://echo hello",
+		Labels: map[string]string{"team": "prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := exec.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Fileset.Map["."].ID, reflow.Digester.FromString("prod\n"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPutBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "putbatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		hello = reflow.Digester.FromString("hello")
+		world = reflow.Digester.FromString("world")
+	)
+	reqs := []PutRequest{
+		{hello, reflow.ExecConfig{Type: intern, URL: "exec://echo hello"}},
+		{world, reflow.ExecConfig{Type: intern, URL: "exec://cat world"}},
+		{hello, reflow.ExecConfig{Type: intern, URL: "exec://echo hello"}},
+	}
+	ctx := context.Background()
+	execs, errs := x.PutBatch(ctx, reqs)
+	if err := errs[0]; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := errs[1], errors.NotAllowed; !errors.Is(want, got) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if execs[1] != nil {
+		t.Errorf("unexpected exec %v", execs[1])
+	}
+	if execs[0] != execs[2] || errs[2] != nil {
+		t.Errorf("got %v, %v, want %v, nil", execs[2], errs[2], execs[0])
+	}
+	if err := execs[0].Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := execs[0].Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Fileset.Map["."].ID, reflow.Digester.FromString("hello\n"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, err := x.Get(ctx, hello); err != nil || got != execs[0] {
+		t.Errorf("got %v, %v, want %v, nil", got, err, execs[0])
+	}
+}
+
+func TestPutCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "putcanceled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	events := x.Events()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	id := reflow.Digester.FromString("canceled")
+	cfg := reflow.ExecConfig{Type: intern, URL: "exec://echo canceled"}
+	if _, err := x.Put(ctx, id, cfg); !errors.Is(errors.Canceled, err) {
+		t.Errorf("expected Canceled error, got %v", err)
+	}
+	x.mu.Lock()
+	n := len(x.execs)
+	x.mu.Unlock()
+	if n != 0 {
+		t.Errorf("got %d execs, want 0", n)
+	}
+	if reserved := x.reserved(); len(reserved) != 0 {
+		t.Errorf("got reservation %v, want none", reserved)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %v", ev)
+	default:
+	}
+	exec, err := x.Put(context.Background(), id, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// teamQuota is an AdmissionController that admits a bounded number of
+// running execs per team.
+type teamQuota struct {
+	quota    int
+	admitted map[string]int
+	teams    map[digest.Digest]string
+	admits   int
+	released chan digest.Digest
+}
+
+func newTeamQuota(quota int) *teamQuota {
+	return &teamQuota{
+		quota:    quota,
+		admitted: make(map[string]int),
+		teams:    make(map[digest.Digest]string),
+		released: make(chan digest.Digest, 16),
+	}
+}
+
+func (q *teamQuota) Admit(id digest.Digest, cfg reflow.ExecConfig) (bool, error) {
+	q.admits++
+	team := cfg.Labels["team"]
+	if team == "" {
+		return false, errors.E(errors.NotAllowed, errors.New("execs must be labeled with a team"))
+	}
+	if q.admitted[team] >= q.quota {
+		return false, nil
+	}
+	q.admitted[team]++
+	q.teams[id] = team
+	return true, nil
+}
+
+func (q *teamQuota) Release(id digest.Digest) {
+	q.admitted[q.teams[id]]--
+	delete(q.teams, id)
+	q.released <- id
+}
+
+func TestAdmissionController(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admission")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	quota := newTeamQuota(1)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}, AdmissionController: quota}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cfg := func(team, arg string) reflow.ExecConfig {
+		return reflow.ExecConfig{Type: intern, URL: "exec://echo " + arg, Labels: map[string]string{"team": team}}
+	}
+	var (
+		a = reflow.Digester.FromString("a")
+		b = reflow.Digester.FromString("b")
+	)
+	// Requests that share an ID are admitted once.
+	execs, errs := x.PutBatch(ctx, []PutRequest{{ID: a, Config: cfg("genomics", "a")}, {ID: a, Config: cfg("genomics", "a")}})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec := execs[0]
+	// Puts of defined execs are not subject to admission.
+	if again, err := x.Put(ctx, a, cfg("genomics", "a")); err != nil || again != exec {
+		t.Errorf("got %v, %v, want %v, nil", again, err, exec)
+	}
+	if got, want := quota.admits, 1; got != want {
+		t.Errorf("got %d admissions, want %d", got, want)
+	}
+	// Puts that are otherwise rejected are not subject to admission.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := x.Put(canceled, reflow.Digester.FromString("canceled"), cfg("imaging", "canceled")); err == nil {
+		t.Error("expected error")
+	}
+	if got, want := quota.admits, 1; got != want {
+		t.Errorf("got %d admissions, want %d", got, want)
+	}
+	if _, err := x.Put(ctx, reflow.Digester.FromString("c"), cfg("", "c")); !errors.Is(errors.NotAllowed, err) {
+		t.Errorf("expected NotAllowed error, got %v", err)
+	}
+	if _, err := x.Put(ctx, reflow.Digester.FromString("d"), cfg("imaging", "d")); err != nil {
+		t.Error(err)
+	}
+	// The team's quota is in use until its exec completes.
+	x.mu.Lock()
+	running := quota.teams[a] != ""
+	x.mu.Unlock()
+	if running {
+		if _, err := x.Put(ctx, b, cfg("genomics", "b")); !errors.Is(errors.ResourcesExhausted, err) {
+			t.Errorf("expected ResourcesExhausted error, got %v", err)
+		}
+	}
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for id := range quota.released {
+		if id == a {
+			break
+		}
+	}
+	if _, err := x.Put(ctx, b, cfg("genomics", "b")); err != nil {
+		t.Errorf("expected exec to be admitted once its team's exec completed, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/fs"
+)
+
+const (
+	// quotaDir is the directory in an exec's run directory at which
+	// its quota filesystem is mounted.
+	quotaDir = "quota"
+	// quotaImage is the file in an exec's run directory that backs
+	// its quota filesystem.
+	quotaImage = "quota.img"
+	// quotaSlack is the free space below which a quota filesystem is
+	// considered full: a write that fails for lack of space may leave
+	// a little space unused.
+	quotaSlack = 1 << 20
+)
+
+// runQuotaCommand runs a command that manages quota filesystems.
+// It is a variable so that it may be replaced in tests.
+var runQuotaCommand = func(ctx context.Context, name string, args ...string) error {
+	out, err := osexec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return errors.E(name, strings.Join(args, " "), errors.Errorf("%v: %s", err, strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// hasQuota tells whether the exec's scratch space ($tmp and its
+// outputs) is placed on a filesystem limited to its disk resource.
+func (e *dockerExec) hasQuota() bool {
+	return e.Executor.DiskQuotas && e.Config.Resources["disk"] > 0
+}
+
+// scratchPath constructs a path in the exec's scratch space: its
+// quota filesystem, if it has one, or else its run directory.
+func (e *dockerExec) scratchPath(elems ...string) string {
+	if e.hasQuota() {
+		elems = append([]string{quotaDir}, elems...)
+	}
+	return e.path(elems...)
+}
+
+// scratchHostPath constructs a host path in the exec's scratch space.
+func (e *dockerExec) scratchHostPath(elems ...string) string {
+	if e.hasQuota() {
+		elems = append([]string{quotaDir}, elems...)
+	}
+	return e.hostPath(elems...)
+}
+
+// mountQuota creates and mounts the exec's quota filesystem, sized
+// to its disk resource. The filesystem is backed by a sparse image
+// file in the exec's run directory, so that it consumes only the
+// space that is used. mountQuota is a no-op if the filesystem was
+// already created, e.g., by a previous attempt of the exec.
+func (e *dockerExec) mountQuota(ctx context.Context) error {
+	image := e.path(quotaImage)
+	if _, err := os.Stat(image); err == nil {
+		return nil
+	}
+	size := int64(e.Config.Resources["disk"])
+	f, err := os.Create(image)
+	if err != nil {
+		return errors.E("quota", e.id, err)
+	}
+	err = f.Truncate(size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = runQuotaCommand(ctx, "mkfs.ext4", "-q", "-F", "-m", "0", image)
+	}
+	if err == nil {
+		err = os.MkdirAll(e.path(quotaDir), 0777)
+	}
+	if err == nil {
+		err = runQuotaCommand(ctx, "mount", "-o", "loop", image, e.path(quotaDir))
+	}
+	if err != nil {
+		os.Remove(image)
+		return errors.E("quota", e.id, err)
+	}
+	e.Log.Debugf("mounted %s disk quota at %s", data.Size(size), e.path(quotaDir))
+	return nil
+}
+
+// unmountQuota unmounts and removes the exec's quota filesystem, if
+// it has one.
+func (e *dockerExec) unmountQuota() error {
+	image := e.path(quotaImage)
+	if _, err := os.Stat(image); os.IsNotExist(err) {
+		return nil
+	}
+	if err := runQuotaCommand(context.Background(), "umount", e.path(quotaDir)); err != nil {
+		return errors.E("quota", e.id, err)
+	}
+	if err := os.Remove(image); err != nil {
+		return errors.E("quota", e.id, err)
+	}
+	return os.Remove(e.path(quotaDir))
+}
+
+// quotaExceeded returns an error if the exec's quota filesystem is
+// full, so that a failure of the exec may be attributed to it.
+func (e *dockerExec) quotaExceeded() error {
+	if !e.hasQuota() {
+		return nil
+	}
+	usage, err := fs.Stat(e.path(quotaDir))
+	if err != nil || usage.Avail >= quotaSlack {
+		return nil
+	}
+	return errors.Errorf("no space left on device: exceeded disk quota of %s", data.Size(e.Config.Resources["disk"]))
+}
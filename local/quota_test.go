@@ -0,0 +1,87 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestDiskQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var commands [][]string
+	save := runQuotaCommand
+	defer func() { runQuotaCommand = save }()
+	runQuotaCommand = func(ctx context.Context, name string, args ...string) error {
+		commands = append(commands, append([]string{name}, args...))
+		return nil
+	}
+
+	x := &Executor{Dir: dir, DiskQuotas: true}
+	e := &dockerExec{Executor: x, id: reflow.Digester.FromString("quota")}
+	e.Config.Resources = reflow.Resources{"disk": 1 << 20}
+	if !e.hasQuota() {
+		t.Fatal("expected exec to have a quota")
+	}
+	if got, want := e.scratchPath("tmp"), e.path(quotaDir, "tmp"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := os.MkdirAll(e.path(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.mountQuota(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(e.path(quotaImage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Size(), int64(1<<20); got != want {
+		t.Errorf("got image size %v, want %v", got, want)
+	}
+	// Mounting is idempotent.
+	if err := e.mountQuota(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.unmountQuota(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"mkfs.ext4", "-q", "-F", "-m", "0", e.path(quotaImage)},
+		{"mount", "-o", "loop", e.path(quotaImage), e.path(quotaDir)},
+		{"umount", e.path(quotaDir)},
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("got commands %v, want %v", commands, want)
+	}
+	for _, p := range []string{e.path(quotaImage), e.path(quotaDir)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s: expected removal, got %v", p, err)
+		}
+	}
+	// Unmounting an exec without a quota filesystem is a no-op.
+	if err := e.unmountQuota(); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Config.Resources = reflow.Resources{"mem": 1 << 30}
+	if e.hasQuota() {
+		t.Error("expected exec without a disk resource to have no quota")
+	}
+	if got := e.scratchPath("tmp"); strings.Contains(got, quotaDir) {
+		t.Errorf("unexpected quota path %v", got)
+	}
+}
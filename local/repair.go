@@ -0,0 +1,49 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// RepairFileset returns a copy of the fileset fs in which the sizes
+// of the files stored in the executor's repository are those of their
+// stored objects. Files that are not present in the repository,
+// including reference files, are left as they are. The structure of
+// the fileset is preserved.
+func (e *Executor) RepairFileset(ctx context.Context, fs reflow.Fileset) (reflow.Fileset, error) {
+	var repaired reflow.Fileset
+	if fs.List != nil {
+		repaired.List = make([]reflow.Fileset, len(fs.List))
+		for i := range fs.List {
+			var err error
+			if repaired.List[i], err = e.RepairFileset(ctx, fs.List[i]); err != nil {
+				return reflow.Fileset{}, err
+			}
+		}
+	}
+	if fs.Map != nil {
+		repaired.Map = make(map[string]reflow.File, len(fs.Map))
+		for path, file := range fs.Map {
+			if !file.IsRef() {
+				stat, err := e.FileRepository.Stat(ctx, file.ID)
+				switch {
+				case err == nil:
+					if stat.Size != file.Size {
+						e.Log.Debugf("repair %s (%v): size %d -> %d", path, file.ID, file.Size, stat.Size)
+						file.Size = stat.Size
+					}
+				case !errors.Is(errors.NotExist, err):
+					return reflow.Fileset{}, errors.E("repair", path, err)
+				}
+			}
+			repaired.Map[path] = file
+		}
+	}
+	return repaired, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/repository/filerepo"
+	reflowtestutil "github.com/grailbio/reflow/test/testutil"
+)
+
+func TestRepairFileset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := &filerepo.Repository{Root: dir}
+	x := &Executor{FileRepository: repo}
+	var (
+		stored  = reflowtestutil.WriteFile(repo, "hello")
+		missing = reflow.File{ID: reflow.Digester.FromString("missing"), Size: 3}
+		ref     = reflow.File{Source: "s3://bucket/key", ETag: "etag", Size: 10}
+		drifted = stored
+	)
+	drifted.Size = 100
+	fs := reflow.Fileset{List: []reflow.Fileset{
+		{Map: map[string]reflow.File{"a": drifted, "b": missing}},
+		{Map: map[string]reflow.File{"c": ref, "d": {ID: stored.ID}}},
+	}}
+	got, err := x.RepairFileset(context.Background(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := reflow.Fileset{List: []reflow.Fileset{
+		{Map: map[string]reflow.File{"a": stored, "b": missing}},
+		{Map: map[string]reflow.File{"c": ref, "d": stored}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := fs.List[0].Map["a"].Size, int64(100); got != want {
+		t.Errorf("input fileset was modified: got %v, want %v", got, want)
+	}
+}
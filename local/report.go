@@ -0,0 +1,108 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A ReportRecord summarizes an exec in the executor's report; see
+// (*Executor).Report.
+type ReportRecord struct {
+	// ID is the exec's ID.
+	ID digest.Digest
+	// Type is the exec's type: "exec", "intern", or "extern".
+	Type string
+	// Labels are the exec's labels.
+	Labels map[string]string `json:",omitempty"`
+	// Resources are the resources requested by the exec.
+	Resources reflow.Resources `json:",omitempty"`
+	// State is the exec's state, as reported by its inspect.
+	State string
+	// Created is the time the exec was created.
+	Created time.Time
+	// Runtime is the time the exec's container ran; it is zero for
+	// execs that have not run a container.
+	Runtime time.Duration
+	// ExitCode is the exit code of the exec's container, if it has
+	// exited.
+	ExitCode *int `json:",omitempty"`
+	// Cached tells whether the exec's result was retrieved from cache.
+	Cached bool `json:",omitempty"`
+	// Peak holds the maximum value of each of the exec's profiled
+	// gauges.
+	Peak reflow.Gauges `json:",omitempty"`
+	// Error is the exec's error, if any.
+	Error *errors.Error `json:",omitempty"`
+}
+
+// Report writes a record (see ReportRecord) of every exec managed by
+// the executor to w, as newline-delimited JSON, in order of creation.
+func (e *Executor) Report(ctx context.Context, w io.Writer) error {
+	e.mu.Lock()
+	execs := make([]exec, 0, len(e.execs))
+	for _, x := range e.execs {
+		execs = append(execs, x)
+	}
+	e.mu.Unlock()
+	records := make([]ReportRecord, len(execs))
+	for i, x := range execs {
+		inspect, err := x.Inspect(ctx)
+		if err != nil {
+			return errors.E("report", x.ID(), err)
+		}
+		records[i] = newReportRecord(x.ID(), inspect)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Created.Equal(records[j].Created) {
+			return records[i].Created.Before(records[j].Created)
+		}
+		return records[i].ID.Less(records[j].ID)
+	})
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return errors.E("report", record.ID, err)
+		}
+	}
+	return nil
+}
+
+// newReportRecord summarizes the exec id described by inspect.
+func newReportRecord(id digest.Digest, inspect reflow.ExecInspect) ReportRecord {
+	record := ReportRecord{
+		ID:        id,
+		Type:      inspect.Config.Type,
+		Labels:    inspect.Config.Labels,
+		Resources: inspect.Config.Resources,
+		State:     inspect.State,
+		Created:   inspect.Created,
+		Runtime:   inspect.Runtime(),
+		Cached:    inspect.Cached,
+		Error:     inspect.Error,
+	}
+	if inspect.ExecError != nil {
+		record.Error = inspect.ExecError
+	}
+	if inspect.Docker.ContainerJSONBase != nil && inspect.Docker.State != nil && !inspect.Docker.State.Running {
+		code := inspect.Docker.State.ExitCode
+		record.ExitCode = &code
+	}
+	if len(inspect.Profile) > 0 {
+		record.Peak = make(reflow.Gauges)
+		for k, v := range inspect.Profile {
+			record.Peak[k] = v.Max
+		}
+	}
+	return record
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"docker.io/go-docker/api/types"
+	"github.com/grailbio/reflow"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ids := []string{"first", "second", "third"}
+	for _, name := range ids {
+		cfg := reflow.ExecConfig{
+			Type:   intern,
+			URL:    "exec://echo " + name,
+			Labels: map[string]string{"name": name},
+		}
+		exec, err := x.Put(ctx, reflow.Digester.FromString(name), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exec.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if err := x.Report(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&b)
+	seen := make(map[string]bool)
+	for dec.More() {
+		var record ReportRecord
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		name := record.Labels["name"]
+		if got, want := record.ID, reflow.Digester.FromString(name); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := record.Type, intern; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if record.ExitCode != nil || record.Error != nil {
+			t.Errorf("unexpected record %+v", record)
+		}
+		seen[name] = true
+	}
+	if got, want := len(seen), len(ids); got != want {
+		t.Errorf("got %v records, want %v", got, want)
+	}
+}
+
+func TestNewReportRecord(t *testing.T) {
+	var inspect reflow.ExecInspect
+	inspect.Docker.ContainerJSONBase = &types.ContainerJSONBase{
+		State: &types.ContainerState{ExitCode: 3},
+	}
+	inspect.Profile = make(reflow.Profile)
+	mem := inspect.Profile["mem"]
+	mem.Mean, mem.Max, mem.N = 5, 10, 1
+	inspect.Profile["mem"] = mem
+	record := newReportRecord(reflow.Digester.FromString("exec"), inspect)
+	if record.ExitCode == nil || *record.ExitCode != 3 {
+		t.Errorf("got exit code %v, want 3", record.ExitCode)
+	}
+	if got, want := record.Peak["mem"], 10.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	inspect.Docker.State.Running = true
+	if record := newReportRecord(reflow.Digester.FromString("exec"), inspect); record.ExitCode != nil {
+		t.Errorf("unexpected exit code %v for running exec", *record.ExitCode)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/grailbio/reflow/errors"
+)
+
+// ReproCommander is implemented by execs that can describe how to
+// reproduce themselves outside of Reflow.
+type ReproCommander interface {
+	// ReproCommand returns a standalone shell command that runs the
+	// exec's container as configured by the executor.
+	ReproCommand(ctx context.Context) (string, error)
+}
+
+// ReproCommand returns a "docker run" invocation equivalent to the
+// container launched for this exec: it has the same image, binds,
+// environment, resource limits and (bash-wrapped) command. The
+// image is the exec's digest-pinned image reference if it has one,
+// or else the resolved image ID. AWS credentials are not included;
+// they are passed through from the invoking environment instead.
+//
+// Note that the executor removes an exec's argument directory when
+// the exec completes, so the command must be run while the exec is
+// running (or with the arguments otherwise restored) for its
+// argument binds to be populated.
+func (e *dockerExec) ReproCommand(ctx context.Context) (string, error) {
+	info, err := e.containerInfo(ctx, "reproduce")
+	if err != nil {
+		return "", err
+	}
+	image := e.Config.Image
+	if !strings.Contains(image, "@") && info.Image != "" {
+		image = info.Image
+	}
+	return reproCommand(image, info.Config, info.HostConfig), nil
+}
+
+// containerInfo returns the Docker inspection of the exec's
+// container: it is retrieved from the daemon while the container
+// exists, and from the exec's manifest once it has completed. The
+// provided operation names the caller in returned errors.
+func (e *dockerExec) containerInfo(ctx context.Context, op string) (types.ContainerJSON, error) {
+	state, err := e.getState()
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	info := e.Docker
+	switch state {
+	case execUnstarted, execInit:
+		return types.ContainerJSON{}, errors.E(op, e.id, errors.NotExist, errors.New("exec container has not been created"))
+	case execCreated, execRunning:
+		info, err = e.client.ContainerInspect(ctx, e.containerName())
+		if err != nil {
+			return types.ContainerJSON{}, errors.E("ContainerInspect", e.containerName(), kind(err), err)
+		}
+	}
+	if info.ContainerJSONBase == nil || info.Config == nil || info.HostConfig == nil {
+		return types.ContainerJSON{}, errors.E(op, e.id, errors.NotExist, errors.New("no container information"))
+	}
+	return info, nil
+}
+
+// reproCommand renders a "docker run" command for the provided
+// container configuration.
+func reproCommand(image string, config *container.Config, hostConfig *container.HostConfig) string {
+	args := []string{"docker", "run", "--rm", "-it"}
+	if mode := hostConfig.NetworkMode; mode != "" {
+		args = append(args, "--network", string(mode))
+	}
+	if config.User != "" {
+		args = append(args, "--user", config.User)
+	}
+	if mem := hostConfig.Resources.Memory; mem > 0 {
+		args = append(args, "--memory", fmt.Sprint(mem))
+	}
+	if swap := hostConfig.Resources.MemorySwap; swap > 0 {
+		args = append(args, "--memory-swap", fmt.Sprint(swap))
+	}
+	for _, bind := range hostConfig.Binds {
+		args = append(args, "-v", bind)
+	}
+	var tmpfs []string
+	for path := range hostConfig.Tmpfs {
+		tmpfs = append(tmpfs, path)
+	}
+	sort.Strings(tmpfs)
+	for _, path := range tmpfs {
+		args = append(args, "--tmpfs", path+":"+hostConfig.Tmpfs[path])
+	}
+	for _, env := range config.Env {
+		if strings.HasPrefix(env, "AWS_") {
+			// Don't leak credentials; pass them through instead.
+			env = strings.SplitN(env, "=", 2)[0]
+		}
+		args = append(args, "-e", env)
+	}
+	var cmd []string
+	if len(config.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", config.Entrypoint[0])
+		cmd = append(cmd, config.Entrypoint[1:]...)
+	}
+	cmd = append(cmd, config.Cmd...)
+	args = append(args, image)
+	args = append(args, cmd...)
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s for the shell, if necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,33 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"testing"
+
+	"docker.io/go-docker/api/types/container"
+)
+
+func TestReproCommand(t *testing.T) {
+	config := &container.Config{
+		Entrypoint: []string{"/bin/bash", "-e", "-l", "-o", "pipefail", "-c", "echo 'hello' > $out"},
+		Env:        []string{"tmp=/tmp", "AWS_SECRET_ACCESS_KEY=secret"},
+		User:       "1000:1000",
+	}
+	hostConfig := &container.HostConfig{
+		Binds:       []string{"/x/arg:/arg", "/x/return:/return"},
+		Tmpfs:       map[string]string{"/tmp": "rw,noexec"},
+		NetworkMode: "host",
+	}
+	hostConfig.Resources.Memory = 1024
+	got := reproCommand("ubuntu@sha256:1234", config, hostConfig)
+	want := `docker run --rm -it --network host --user 1000:1000 --memory 1024 ` +
+		`-v /x/arg:/arg -v /x/return:/return --tmpfs /tmp:rw,noexec ` +
+		`-e tmp=/tmp -e AWS_SECRET_ACCESS_KEY --entrypoint /bin/bash ubuntu@sha256:1234 ` +
+		`-e -l -o pipefail -c 'echo '\''hello'\'' > $out'`
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
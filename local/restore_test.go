@@ -0,0 +1,83 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+// TestStartRestore tests that Start restores scheme execs and
+// resumes them, so that their results become available without the
+// caller retrieving them.
+func TestStartRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	id := reflow.Digester.FromString("restored")
+	exec, err := x.Put(ctx, id, reflow.ExecConfig{Type: intern, URL: "exec://echo restored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	x.cancel()
+	// Rewind the exec's manifest, as if the executor had stopped
+	// before the exec completed.
+	path := x.execPath(id, manifestPath)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	m.State, m.Result = execInit, reflow.Result{}
+	if b, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	x = &Executor{Dir: dir, InternCommands: []string{"echo"}}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	execs, err := x.Execs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(execs), 1; got != want {
+		t.Fatalf("got %v execs, want %v", got, want)
+	}
+	if err := x.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := execs[0].Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if got, want := res.Fileset.Map["."].ID, reflow.Digester.FromString("restored\n"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+const nreaders = 16
+
+// readResults calls x.Result concurrently from nreaders goroutines
+// and checks that each returns want.
+func readResults(t *testing.T, x reflow.Exec, want reflow.Result) {
+	t.Helper()
+	var (
+		wg      sync.WaitGroup
+		results [nreaders]reflow.Result
+		errs    [nreaders]error
+	)
+	for i := 0; i < nreaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = x.Result(context.Background())
+		}(i)
+	}
+	wg.Wait()
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got := results[i]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func testResult() reflow.Result {
+	return reflow.Result{
+		Fileset: reflow.Fileset{Map: map[string]reflow.File{
+			"a": {ID: reflow.Digester.FromString("a"), Size: 1},
+		}},
+	}
+}
+
+func TestDockerExecResultConcurrent(t *testing.T) {
+	e := &dockerExec{}
+	e.cond = sync.NewCond(&e.mu)
+	e.Manifest.Result = testResult()
+	e.setState(execComplete, nil)
+	readResults(t, e, testResult())
+}
+
+func TestDockerExecResultLazyDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lazyresult")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	if err := x.Start(); err != nil {
+		t.Fatal(err)
+	}
+	e := newDockerExec(reflow.Digester.FromString("lazy"), x, reflow.ExecConfig{LazyDigests: true}, nil, nil)
+	out := filepath.Join(e.returnPath("default"), "a")
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(out, []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.install(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e.setState(execComplete, nil)
+	pending := reflow.Result{Fileset: reflow.Fileset{Map: map[string]reflow.File{
+		"a": {Size: 1, Source: "localfile://" + out},
+	}}}
+	readResults(t, e, pending)
+
+	// Results read while the exec is promoted are either pending or
+	// resolved.
+	var (
+		wg      sync.WaitGroup
+		results [nreaders]reflow.Result
+	)
+	for i := 0; i < nreaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = e.Result(ctx)
+		}(i)
+	}
+	if err := e.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	for _, res := range results {
+		if !reflect.DeepEqual(res, pending) && !reflect.DeepEqual(res, testResult()) {
+			t.Errorf("unexpected result %v", res)
+		}
+	}
+	// Every read after promotion returns the resolved result.
+	readResults(t, e, testResult())
+	if err := e.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+	readResults(t, e, testResult())
+}
+
+func TestZombieExecResultConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zombie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	id := reflow.Digester.FromString("exec")
+	z := &zombieExec{zombie: &zombie{dir: dir}, id: id}
+	if err := os.MkdirAll(z.objectPath(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	p, err := json.Marshal(Manifest{Result: testResult()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(z.objectPath(manifestPath), p, 0666); err != nil {
+		t.Fatal(err)
+	}
+	readResults(t, z, testResult())
+	// The result is cached, so it survives the removal of the manifest.
+	if err := os.Remove(z.objectPath(manifestPath)); err != nil {
+		t.Fatal(err)
+	}
+	readResults(t, z, testResult())
+}
@@ -0,0 +1,313 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestRewriteConfigDockerSocket(t *testing.T) {
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "docker ps", MountDockerSocket: true}
+	var x Executor
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.NotAllowed, err) {
+		t.Errorf("expected NotAllowed error, got %v", err)
+	}
+	x.AllowDockerSocketMount = true
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRewriteConfigLimits(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{
+		Type:      "exec",
+		Resources: reflow.Resources{"mem": 4 << 30, "cpu": 2},
+		Limits:    reflow.Resources{"mem": 8 << 30},
+	}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.Limits["cpu"] = 1
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigShmSize(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "df /dev/shm", ShmSize: 1 << 30}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.ShmSize = -1
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigPidsLimit(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", PidsLimit: 100}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.PidsLimit = -1
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigUmask(t *testing.T) {
+	var x Executor
+	for _, umask := range []string{"0022", "077", "0"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", Umask: umask}
+		if err := x.rewriteConfig(&cfg); err != nil {
+			t.Errorf("%s: %v", umask, err)
+		}
+	}
+	for _, umask := range []string{"0028", "1777", "-1", "u=rwx"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", Umask: umask}
+		if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%s: expected Invalid error, got %v", umask, err)
+		}
+	}
+}
+
+func TestRewriteConfigStopSignal(t *testing.T) {
+	var x Executor
+	for _, sig := range []string{"SIGINT", "INT", "sigusr1", "15"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", StopSignal: sig}
+		if err := x.rewriteConfig(&cfg); err != nil {
+			t.Errorf("%s: %v", sig, err)
+		}
+	}
+	for _, sig := range []string{"SIGFOO", "SIG", "0", "65", "-2", "INT2"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", StopSignal: sig}
+		if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%s: expected Invalid error, got %v", sig, err)
+		}
+	}
+}
+
+func TestRewriteConfigStopTimeout(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", StopTimeout: 500 * time.Millisecond}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.StopTimeout = -time.Second
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigHostname(t *testing.T) {
+	var x Executor
+	for _, c := range []struct {
+		hostname string
+		ok       bool
+	}{
+		{"licensed", true},
+		{"node-1.example.com", true},
+		{"-node", false},
+		{"node_1", false},
+		{"node..example", false},
+		{strings.Repeat("a", 64), false},
+	} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", Hostname: c.hostname}
+		err := x.rewriteConfig(&cfg)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.hostname, err)
+		}
+		if !c.ok && !errors.Is(errors.Invalid, err) {
+			t.Errorf("%s: expected Invalid error, got %v", c.hostname, err)
+		}
+	}
+}
+
+func TestRewriteConfigOutputTmpfs(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", OutputTmpfs: true}
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.NotSupported, err) {
+		t.Errorf("expected NotSupported error, got %v", err)
+	}
+	x.OutputTmpfsDir = "/dev/shm/reflow"
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.LazyDigests = true
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigPullPolicy(t *testing.T) {
+	var x Executor
+	for _, policy := range []reflow.PullPolicy{"", reflow.PullIfNotPresent, reflow.PullAlways, reflow.PullNever} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", PullPolicy: policy}
+		if err := x.rewriteConfig(&cfg); err != nil {
+			t.Errorf("%q: %v", policy, err)
+		}
+	}
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", PullPolicy: "Sometimes"}
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigOutputMode(t *testing.T) {
+	var x Executor
+	for _, mode := range []reflow.OutputMode{"", reflow.OutputFile, reflow.OutputDir} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", OutputMode: mode}
+		if err := x.rewriteConfig(&cfg); err != nil {
+			t.Errorf("%q: %v", mode, err)
+		}
+	}
+	for _, cfg := range []reflow.ExecConfig{
+		{Type: "exec", Image: "ubuntu", Cmd: "true", OutputMode: "Symlink"},
+		{Type: "exec", Image: "ubuntu", Cmd: "true", OutputMode: reflow.OutputDir, OutputIsDir: []bool{true}},
+	} {
+		if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%v: expected Invalid error, got %v", cfg, err)
+		}
+	}
+}
+
+func TestRewriteConfigResourceHint(t *testing.T) {
+	var x Executor
+	input := reflow.Fileset{Map: map[string]reflow.File{
+		"a": {ID: reflow.Digester.FromString("a"), Size: 1 << 30},
+		"b": {ID: reflow.Digester.FromString("b"), Size: 1 << 30},
+	}}
+	cfg := reflow.ExecConfig{
+		Type:      "exec",
+		Image:     "ubuntu",
+		Cmd:       "cat %s > %s",
+		Args:      []reflow.Arg{{Fileset: &input}, {Out: true}},
+		Resources: reflow.Resources{"mem": 1 << 30, "cpu": 4, "disk": 8 << 30},
+		ResourceHint: func(size int64) reflow.Resources {
+			return reflow.Resources{"mem": float64(2 * size), "disk": float64(size)}
+		},
+	}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Memory is raised by the hint; disk, which is already requested
+	// in excess of the hint, is not lowered.
+	if got, want := cfg.Resources, (reflow.Resources{"mem": 4 << 30, "cpu": 4, "disk": 8 << 30}); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if cfg.ResourceHint != nil {
+		t.Error("expected hint to be cleared")
+	}
+}
+
+func TestRewriteConfigCapAdd(t *testing.T) {
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "gdb", CapAdd: []string{"SYS_PTRACE"}}
+	var x Executor
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.NotAllowed, err) {
+		t.Errorf("expected NotAllowed error, got %v", err)
+	}
+	x.AllowedCaps = []string{"CAP_SYS_PTRACE"}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRewriteConfigOffline(t *testing.T) {
+	x := Executor{Offline: true, InternCommands: []string{"echo"}}
+	for _, c := range []struct {
+		typ, url string
+		ok       bool
+	}{
+		{intern, "localfile:///tmp/x", true},
+		{extern, "localfile:///tmp/x", true},
+		{intern, "s3://bucket/x", false},
+		{extern, "https://example.com/x", false},
+		{intern, "exec://echo hello", false},
+	} {
+		cfg := reflow.ExecConfig{Type: c.typ, URL: c.url}
+		err := x.rewriteConfig(&cfg)
+		if c.ok && err != nil {
+			t.Errorf("%s %s: %v", c.typ, c.url, err)
+		} else if !c.ok && !errors.Is(errors.NotAllowed, err) {
+			t.Errorf("%s %s: expected NotAllowed error, got %v", c.typ, c.url, err)
+		}
+	}
+}
+
+func TestRewriteConfigMemoryRetryKeepTmp(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", MemoryRetryKeepTmp: true}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.TmpfsOptions = &reflow.TmpfsOptions{Size: 1 << 30}
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigTmpLog(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", TmpLog: true}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.TmpfsOptions = &reflow.TmpfsOptions{Size: 1 << 30}
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigOutputFilter(t *testing.T) {
+	var x Executor
+	cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", OutputFilter: []string{"*.tmp", "scratch/*"}}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Error(err)
+	}
+	cfg.OutputFilter = []string{"[bad"}
+	if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+		t.Errorf("expected Invalid error, got %v", err)
+	}
+}
+
+func TestRewriteConfigPlatform(t *testing.T) {
+	var x Executor
+	for _, platform := range []string{"", "linux/amd64", "linux/arm64/v8"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", Platform: platform}
+		if err := x.rewriteConfig(&cfg); err != nil {
+			t.Errorf("%q: %v", platform, err)
+		}
+	}
+	for _, platform := range []string{"linux", "linux/", "/arm64", "linux/arm64/v8/x"} {
+		cfg := reflow.ExecConfig{Type: "exec", Image: "ubuntu", Cmd: "true", Platform: platform}
+		if err := x.rewriteConfig(&cfg); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%q: expected Invalid error, got %v", platform, err)
+		}
+	}
+	if got, want := x.platform(""), hostPlatform; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	x.Platform = "linux/arm64"
+	if got, want := x.platform(""), "linux/arm64"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := x.platform("linux/amd64"), "linux/amd64"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !platformMatches("linux/arm64", "linux/arm64/v8") {
+		t.Error("variants should not be compared")
+	}
+	if platformMatches("linux/amd64", "linux/arm64") {
+		t.Error("architectures should be compared")
+	}
+}
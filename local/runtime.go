@@ -0,0 +1,56 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// runtime returns the Docker runtime with which the exec with the
+// given config is run: the config's runtime if set, or else the
+// executor's default. An empty runtime denotes the daemon's default.
+func (e *Executor) runtime(cfg reflow.ExecConfig) string {
+	if cfg.Runtime != "" {
+		return cfg.Runtime
+	}
+	return e.Runtime
+}
+
+// checkRuntime returns an error if the named runtime is not
+// registered with the executor's Docker daemon. Registered runtimes
+// are cached, so that the daemon is queried only for runtimes that
+// have not yet been seen; a runtime that is missing is looked up
+// again on each call, since it may since have been registered.
+func (e *Executor) checkRuntime(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+	e.runtimesMu.Lock()
+	ok := e.runtimes[name]
+	e.runtimesMu.Unlock()
+	if ok {
+		return nil
+	}
+	info, err := e.Client.Info(ctx)
+	if err != nil {
+		return errors.E("runtime", name, errors.Unavailable, err)
+	}
+	e.runtimesMu.Lock()
+	defer e.runtimesMu.Unlock()
+	if e.runtimes == nil {
+		e.runtimes = make(map[string]bool)
+	}
+	for runtime := range info.Runtimes {
+		e.runtimes[runtime] = true
+	}
+	if !e.runtimes[name] {
+		return errors.E("runtime", name, errors.NotSupported,
+			errors.Errorf("runtime %q is not registered with the Docker daemon", name))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grailbio/reflow"
+)
+
+func TestRuntime(t *testing.T) {
+	x := &Executor{Runtime: "runc"}
+	if got, want := x.runtime(reflow.ExecConfig{}), "runc"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := x.runtime(reflow.ExecConfig{Runtime: "runsc"}), "runsc"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Known runtimes, and the default runtime, do not consult the
+	// daemon, so we can check them without a client.
+	x.runtimes = map[string]bool{"runsc": true}
+	ctx := context.Background()
+	for _, name := range []string{"", "runsc"} {
+		if err := x.checkRuntime(ctx, name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/base/sync/once"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/log"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// An InternExterner implements interns and externs for a URL scheme.
+// InternExterners are registered with RegisterScheme.
+type InternExterner interface {
+	// Intern copies the data at the URL u into the repository repo,
+	// returning a fileset describing it.
+	Intern(ctx context.Context, u *url.URL, repo *filerepo.Repository) (reflow.Fileset, error)
+
+	// Extern copies the files in the fileset fs, which are stored in
+	// the repository repo, to the URL u.
+	Extern(ctx context.Context, u *url.URL, fs reflow.Fileset, repo *filerepo.Repository) error
+}
+
+// builtinSchemes are the schemes implemented directly by the executor.
+// They may not be registered.
+var builtinSchemes = map[string]bool{
+	"localfile": true,
+	"exec":      true,
+	"s3":        true,
+	"s3f":       true,
+	"http":      true,
+	"https":     true,
+}
+
+var (
+	schemesMu sync.Mutex
+	schemes   = map[string]InternExterner{}
+)
+
+// RegisterScheme registers the handler for interns and externs of URLs
+// with the given scheme. Executors dispatch interns and externs of
+// registered schemes to their handlers in preference to the blob
+// stores of the executor's blob.Mux. RegisterScheme panics if a
+// handler is already registered for the scheme, or if the scheme is
+// built in (localfile, exec, s3, s3f, http, https).
+func RegisterScheme(scheme string, handler InternExterner) {
+	if builtinSchemes[scheme] {
+		panic(fmt.Sprintf("local.RegisterScheme: scheme %q is built in", scheme))
+	}
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if _, ok := schemes[scheme]; ok {
+		panic(fmt.Sprintf("local.RegisterScheme: scheme %q is already registered", scheme))
+	}
+	schemes[scheme] = handler
+}
+
+// lookupScheme returns the handler registered for the given scheme,
+// if any.
+func lookupScheme(scheme string) (InternExterner, bool) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	h, ok := schemes[scheme]
+	return h, ok
+}
+
+// schemeExec implements an exec for interning and externing URLs
+// whose scheme is implemented by a registered InternExterner.
+// Interned files are staged in the exec's own repository and moved
+// to the executor's repository when the exec is promoted. Like blob
+// execs, scheme execs store their state on disk, and are restored by
+// restarted executors.
+type schemeExec struct {
+	// The Executor that owns this exec.
+	Executor *Executor
+	// The (possibly nil) Logger that logs exec's actions, for external consumption.
+	Log *log.Logger
+
+	staging filerepo.Repository
+
+	id          digest.Digest
+	handler     InternExterner
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	cond        *sync.Cond
+	err         error
+	promoteOnce once.Task
+
+	// Manifest stores the serializable state of the exec.
+	Manifest
+}
+
+// newSchemeExec returns a new exec for the provided config. The
+// handler may be nil if the exec is restored in a process in which
+// its scheme is not registered; such execs fail if they are run.
+func newSchemeExec(id digest.Digest, x *Executor, cfg reflow.ExecConfig, handler InternExterner) *schemeExec {
+	e := &schemeExec{
+		Executor: x,
+		Log:      x.Log,
+		id:       id,
+		handler:  handler,
+	}
+	e.Manifest.Type = execScheme
+	e.Manifest.Created = x.clock().Now()
+	e.Manifest.Config = cfg
+	e.Manifest.Version = x.Version
+	e.staging.Root = x.execPath(id, objectsDir)
+	e.staging.BlockSize = x.DigestBlockSize
+	e.staging.Log = x.Log
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// schemeHandler returns the handler of interns and externs of URLs
+// with the scheme of u, if any.
+func schemeHandler(u *url.URL) (InternExterner, bool) {
+	if u.Scheme == commandScheme {
+		return commandInterner{}, true
+	}
+	return lookupScheme(u.Scheme)
+}
+
+func (e *schemeExec) Go(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.cancel = cancel
+	e.mu.Unlock()
+	defer cancel()
+	for state, err := e.getState(); err == nil && state != execComplete; e.setState(state, err) {
+		switch state {
+		case execUnstarted, execInit, execCreated:
+			state = execRunning
+		case execRunning:
+			err = e.do(ctx)
+			if err == nil {
+				state = execComplete
+				break
+			}
+			if err == context.Canceled || err == context.DeadlineExceeded {
+				// The exec's state remains running, so that it is
+				// resumed by a restarted executor.
+				err = errors.E("exec", e.id, e.Config.URL, err)
+				break
+			}
+			state = execComplete
+			e.mu.Lock()
+			e.Manifest.Result.Err = errors.Recover(errors.E(e.Config.Type, e.Config.URL, err))
+			e.mu.Unlock()
+			err = nil
+		default:
+			panic("bug")
+		}
+		if err == nil {
+			err = e.save(state)
+		}
+	}
+}
+
+// do performs the exec's transfer, storing the interned fileset, if
+// any, in the exec's result. Context errors are returned as they
+// are.
+func (e *schemeExec) do(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u, err := parseURL(e.Config.URL)
+	if err != nil {
+		return err
+	}
+	if e.handler == nil {
+		return errors.E(errors.NotSupported, errors.Errorf("no handler is registered for scheme %q", u.Scheme))
+	}
+	switch e.Config.Type {
+	case intern:
+		fs, err := e.handler.Intern(ctx, u, &e.staging)
+		if err != nil {
+			e.Log.Errorf("interning %s: %v", e.Config.URL, err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		e.mu.Lock()
+		e.Manifest.Result = reflow.Result{Fileset: fs}
+		e.mu.Unlock()
+		e.Log.Printf("interned %s: %v", e.Config.URL, fs.Short())
+		return nil
+	case extern:
+		if n := len(e.Config.Args); n != 1 {
+			return errors.Errorf("%s extern needed one arg, got %d", u.Scheme, n)
+		}
+		e.Log.Printf("externing %s", e.Config.URL)
+		if err := e.handler.Extern(ctx, u, *e.Config.Args[0].Fileset, e.Executor.FileRepository); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		return nil
+	default:
+		return errors.E(errors.NotSupported, errors.Errorf("unsupported exec type %v", e.Config.Type))
+	}
+}
+
+// save saves the exec's manifest, with the provided state, to disk.
+func (e *schemeExec) save(state execState) error {
+	path := e.Executor.execPath(e.id)
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	manifest := e.Manifest
+	e.mu.Unlock()
+	manifest.State = state
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, manifestPath), b, 0666)
+}
+
+// setState sets the current state and error. It broadcasts
+// on the exec's condition variable to wake up all waiters.
+func (e *schemeExec) setState(state execState, err error) {
+	e.mu.Lock()
+	e.State = state
+	e.err = err
+	e.cond.Broadcast()
+	e.mu.Unlock()
+}
+
+// getState returns the current state of the exec.
+func (e *schemeExec) getState() (execState, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.State, e.err
+}
+
+func (e *schemeExec) WaitUntil(min execState) error {
+	e.mu.Lock()
+	for e.State < min && e.err == nil {
+		e.cond.Wait()
+	}
+	e.mu.Unlock()
+	return e.err
+}
+
+// Kill cancels the exec's transfer, if it is still in progress, and
+// waits for the exec to stop.
+func (e *schemeExec) Kill(ctx context.Context) error {
+	state, err := e.getState()
+	if err != nil || state == execComplete {
+		return nil
+	}
+	e.mu.Lock()
+	cancel := e.cancel
+	e.mu.Unlock()
+	if cancel == nil {
+		// The exec has not been started.
+		return nil
+	}
+	e.Executor.markKilled(e.id)
+	cancel()
+	if err := e.Wait(ctx); err != nil && !errors.Is(errors.Canceled, err) {
+		return err
+	}
+	return nil
+}
+
+func (e *schemeExec) ID() digest.Digest {
+	return e.id
+}
+
+func (e *schemeExec) URI() string {
+	return e.Executor.URI() + "/" + e.id.Hex()
+}
+
+// Result returns the exec's result once it is complete. Transfer
+// failures are reported in the result's error.
+func (e *schemeExec) Result(ctx context.Context) (reflow.Result, error) {
+	state, err := e.getState()
+	if err != nil {
+		return reflow.Result{}, err
+	}
+	if state != execComplete {
+		return reflow.Result{}, errors.Errorf("result %v: exec not complete", e.id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.Manifest.Result, nil
+}
+
+// Promote implements reflow.Exec. As with localfile execs, only the
+// first call moves the staged objects to the executor's repository.
+func (e *schemeExec) Promote(ctx context.Context) error {
+	return e.promoteOnce.Do(func() error {
+		res, err := e.Result(ctx)
+		if err != nil {
+			return err
+		}
+		return e.Executor.promote(ctx, res.Fileset, &e.staging)
+	})
+}
+
+func (e *schemeExec) Inspect(ctx context.Context) (reflow.ExecInspect, error) {
+	e.mu.Lock()
+	inspect := reflow.ExecInspect{
+		Created: e.Manifest.Created,
+		Config:  e.Config,
+		Version: e.Manifest.Version,
+	}
+	e.mu.Unlock()
+	state, err := e.getState()
+	if err != nil {
+		inspect.Error = errors.Recover(err)
+	}
+	if state < execComplete {
+		inspect.State = "running"
+		inspect.Status = fmt.Sprintf("%s is in progress", e.Config.Type)
+	} else {
+		inspect.State = "complete"
+		inspect.Status = fmt.Sprintf("%s is complete", e.Config.Type)
+	}
+	return inspect, nil
+}
+
+func (e *schemeExec) Wait(ctx context.Context) error {
+	return e.WaitUntil(execComplete)
+}
+
+func (e *schemeExec) Logs(ctx context.Context, stdout bool, stderr bool, follow bool) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(nil)), nil
+}
+
+func (e *schemeExec) Shell(ctx context.Context) (io.ReadWriteCloser, error) {
+	return nil, errors.New("cannot shell into an intern/extern")
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/repository/filerepo"
+)
+
+// memScheme interns the URL's path as file contents and records
+// the contents of externed files.
+type memScheme struct {
+	externed map[string]string
+}
+
+func (m *memScheme) Intern(ctx context.Context, u *url.URL, repo *filerepo.Repository) (reflow.Fileset, error) {
+	d, err := repo.Put(ctx, strings.NewReader(u.Path))
+	if err != nil {
+		return reflow.Fileset{}, err
+	}
+	file, err := repo.Stat(ctx, d)
+	if err != nil {
+		return reflow.Fileset{}, err
+	}
+	return reflow.Fileset{Map: map[string]reflow.File{".": file}}, nil
+}
+
+func (m *memScheme) Extern(ctx context.Context, u *url.URL, fs reflow.Fileset, repo *filerepo.Repository) error {
+	for path, file := range fs.Map {
+		rc, err := repo.Get(ctx, file.ID)
+		if err != nil {
+			return err
+		}
+		p, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		m.externed[u.Host+"/"+path] = string(p)
+	}
+	return nil
+}
+
+func TestRegisterScheme(t *testing.T) {
+	handler := &memScheme{externed: make(map[string]string)}
+	RegisterScheme("memtest", handler)
+	if h, ok := lookupScheme("memtest"); !ok || h != handler {
+		t.Fatalf("got %v, %v, want %v, true", h, ok, handler)
+	}
+	for _, scheme := range []string{"memtest", "s3", "localfile"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", scheme)
+				}
+			}()
+			RegisterScheme(scheme, handler)
+		}()
+	}
+
+	var x Executor
+	cfg := reflow.ExecConfig{Type: intern, URL: "memtest://bucket/hello"}
+	if err := x.rewriteConfig(&cfg); err != nil {
+		t.Errorf("rewrite %s: %v", cfg.URL, err)
+	}
+	cfg.URL = "unregistered://bucket/hello"
+	if err := x.rewriteConfig(&cfg); err == nil {
+		t.Errorf("rewrite %s: expected error", cfg.URL)
+	}
+}
+
+func TestSchemeExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemeexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{
+		Dir:            dir,
+		FileRepository: &filerepo.Repository{Root: dir + "/objects"},
+		refCounts:      make(map[digest.Digest]refCount),
+	}
+	handler := &memScheme{externed: make(map[string]string)}
+	ctx := context.Background()
+
+	cfg := reflow.ExecConfig{Type: intern, URL: "mem://bucket/hello"}
+	e := newSchemeExec(reflow.Digester.FromString("intern"), x, cfg, handler)
+	e.Go(ctx)
+	res, err := e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+	file := res.Fileset.Map["."]
+	if got, want := file.ID, reflow.Digester.FromString("/hello"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cfg = reflow.ExecConfig{
+		Type: extern,
+		URL:  "mem://out",
+		Args: []reflow.Arg{{Fileset: &reflow.Fileset{Map: map[string]reflow.File{"x": file}}}},
+	}
+	e = newSchemeExec(reflow.Digester.FromString("extern"), x, cfg, handler)
+	e.Go(ctx)
+	if err := e.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := handler.externed["out/x"], "/hello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// failScheme fails interns and blocks externs until they are
+// canceled.
+type failScheme struct{}
+
+func (failScheme) Intern(ctx context.Context, u *url.URL, repo *filerepo.Repository) (reflow.Fileset, error) {
+	return reflow.Fileset{}, errors.E(errors.NotExist, errors.New("no such object"))
+}
+
+func (failScheme) Extern(ctx context.Context, u *url.URL, fs reflow.Fileset, repo *filerepo.Repository) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSchemeExecErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemeexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := &Executor{Dir: dir}
+	ctx := context.Background()
+
+	// Handler errors are reported as exec failures.
+	cfg := reflow.ExecConfig{Type: intern, URL: "fail://bucket/key"}
+	e := newSchemeExec(reflow.Digester.FromString("intern"), x, cfg, failScheme{})
+	e.Go(ctx)
+	if err := e.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(errors.NotExist, res.Err) {
+		t.Errorf("expected NotExist result error, got %v", res.Err)
+	}
+
+	// Killed execs are recorded as such.
+	cfg = reflow.ExecConfig{
+		Type: extern,
+		URL:  "fail://bucket/key",
+		Args: []reflow.Arg{{Fileset: &reflow.Fileset{}}},
+	}
+	id := reflow.Digester.FromString("extern")
+	e = newSchemeExec(id, x, cfg, failScheme{})
+	go e.Go(ctx)
+	if err := e.WaitUntil(execRunning); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Kill(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Wait(ctx); !errors.Is(errors.Canceled, err) {
+		t.Errorf("expected Canceled error, got %v", err)
+	}
+	if !x.killed[id] {
+		t.Error("exec was not marked killed")
+	}
+}
@@ -12,13 +12,26 @@ import (
 	"github.com/grailbio/reflow/internal/walker"
 )
 
+// maxClockSkew is the largest discrepancy between the wall clock and
+// the monotonic clock that is tolerated before stats report clock
+// skew.
+const maxClockSkew = time.Second
+
 // stats stores runtime statistics for a container invocation.
+//
+// The times of observations after the first are derived from the
+// monotonic clock: each observation advances Last by the monotonic
+// time elapsed since the previous one. Thus Last never precedes First,
+// and Last-First is the monotonic duration of the profile, even if the
+// wall clock is stepped (e.g., by NTP) while profiling. The largest
+// discrepancy between the two clocks is recorded as Skew.
 type stats map[string]struct {
 	First, Last  time.Time
 	N            int64
 	Sum          float64
 	SumOfSquares float64
 	Max          float64
+	Skew         time.Duration `json:",omitempty"`
 }
 
 func (s stats) Max(stat string) float64 {
@@ -52,7 +65,8 @@ func (s stats) Last(stat string) time.Time {
 	return s[stat].Last
 }
 
-func (s stats) Observe(stat string, v float64) {
+// Observe records the value v of stat, observed at time t.
+func (s stats) Observe(stat string, v float64, t time.Time) {
 	e := s[stat]
 	e.N++
 	if v > e.Max {
@@ -61,12 +75,49 @@ func (s stats) Observe(stat string, v float64) {
 	e.Sum += v
 	e.SumOfSquares += v * v
 	if e.First.IsZero() {
-		e.First = time.Now()
+		e.First, e.Last = t, t
+	} else {
+		d, skew := elapsed(e.Last, t)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > e.Skew {
+			e.Skew = skew
+		}
+		e.Last = e.Last.Add(d)
 	}
-	e.Last = time.Now()
 	s[stat] = e
 }
 
+// Skew returns the largest clock skew observed by the stats, or zero
+// if it does not exceed maxClockSkew.
+func (s stats) Skew() time.Duration {
+	var skew time.Duration
+	for _, e := range s {
+		if e.Skew > skew {
+			skew = e.Skew
+		}
+	}
+	if skew <= maxClockSkew {
+		return 0
+	}
+	return skew
+}
+
+// elapsed returns the time elapsed from u to t, as measured by the
+// monotonic clock when both times carry monotonic clock readings, and
+// the amount by which the wall clock deviated from it. Times without
+// monotonic readings never elapse backwards: the wall clock is then
+// taken to have been stepped back.
+func elapsed(u, t time.Time) (d, skew time.Duration) {
+	d = t.Sub(u)
+	skew = t.Round(0).Sub(u.Round(0)) - d
+	if d < 0 {
+		skew, d = skew+d, 0
+	}
+	return d, skew
+}
+
 func (s stats) Profile() reflow.Profile {
 	prof := make(reflow.Profile)
 	for name := range s {
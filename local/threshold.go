@@ -0,0 +1,79 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"sync"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+)
+
+// A threshold is a callback registered through (*Executor).OnThreshold.
+type threshold struct {
+	resource string
+	fraction float64
+	cb       func(id digest.Digest, gauges reflow.Gauges)
+}
+
+// OnThreshold registers a callback that is invoked whenever the
+// gauge of the named resource of a running exec crosses fraction
+// of the amount of that resource requested by the exec. For example,
+// OnThreshold("mem", 0.9, cb) invokes cb when an exec's memory
+// usage exceeds 90% of its memory requirement. Thresholds are
+// evaluated on each profiling sample; the callback is invoked once
+// per crossing, and again only after usage has dropped below the
+// threshold. Execs that do not request the resource are ignored.
+//
+// Callbacks are invoked synchronously from the exec's profiler and
+// should not block.
+func (e *Executor) OnThreshold(resource string, fraction float64, cb func(id digest.Digest, gauges reflow.Gauges)) {
+	e.thresholdsMu.Lock()
+	e.thresholds = append(e.thresholds, &threshold{resource, fraction, cb})
+	e.thresholdsMu.Unlock()
+}
+
+// thresholdWatcher evaluates an executor's thresholds for a single exec.
+type thresholdWatcher struct {
+	x         *Executor
+	id        digest.Digest
+	resources reflow.Resources
+
+	mu    sync.Mutex
+	above map[*threshold]bool
+}
+
+func newThresholdWatcher(x *Executor, id digest.Digest, resources reflow.Resources) *thresholdWatcher {
+	return &thresholdWatcher{x: x, id: id, resources: resources, above: make(map[*threshold]bool)}
+}
+
+// Observe evaluates the executor's thresholds against the provided
+// gauges, invoking the callbacks of thresholds that were crossed.
+func (w *thresholdWatcher) Observe(gauges reflow.Gauges) {
+	w.x.thresholdsMu.Lock()
+	thresholds := w.x.thresholds
+	w.x.thresholdsMu.Unlock()
+	if len(thresholds) == 0 {
+		return
+	}
+	var crossed []*threshold
+	w.mu.Lock()
+	for _, t := range thresholds {
+		limit := w.resources[t.resource]
+		v, ok := gauges[t.resource]
+		if limit <= 0 || !ok {
+			continue
+		}
+		above := v >= t.fraction*limit
+		if above && !w.above[t] {
+			crossed = append(crossed, t)
+		}
+		w.above[t] = above
+	}
+	w.mu.Unlock()
+	for _, t := range crossed {
+		t.cb(w.id, gauges)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+)
+
+func TestThresholdWatcher(t *testing.T) {
+	var (
+		x     Executor
+		id    = reflow.Digester.FromString("threshold")
+		fired []float64
+	)
+	x.OnThreshold("mem", 0.9, func(xid digest.Digest, g reflow.Gauges) {
+		if xid != id {
+			t.Errorf("got %v, want %v", xid, id)
+		}
+		fired = append(fired, g["mem"])
+	})
+	w := newThresholdWatcher(&x, id, reflow.Resources{"mem": 100, "cpu": 1})
+	for _, mem := range []float64{10, 89, 90, 95, 50, 99} {
+		w.Observe(reflow.Gauges{"mem": mem, "cpu": 1})
+	}
+	if got, want := len(fired), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := fired[0], 90.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := fired[1], 99.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
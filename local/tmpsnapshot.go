@@ -0,0 +1,196 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/errors"
+	"github.com/grailbio/reflow/internal/walker"
+)
+
+// tmpSnapshotPath is the path (relative to the exec's directory) of
+// the tar archive of $tmp that is retained when an exec fails.
+const tmpSnapshotPath = "tmp.tar"
+
+// defaultTmpSnapshotLimit is the default maximum number of bytes of
+// file data included in a snapshot of an exec's $tmp directory.
+const defaultTmpSnapshotLimit = 1 << 30
+
+// TmpRetention is a policy for retaining the $tmp directories of
+// completed execs.
+type TmpRetention int
+
+const (
+	// RetainTmpNever removes the $tmp directory of every exec when it
+	// completes.
+	RetainTmpNever TmpRetention = iota
+	// RetainTmpOnFailure retains the $tmp directories of failed execs
+	// only.
+	RetainTmpOnFailure
+	// RetainTmpAlways retains the $tmp directory of every exec.
+	RetainTmpAlways
+)
+
+// String returns the name of the retention policy.
+func (r TmpRetention) String() string {
+	switch r {
+	case RetainTmpNever:
+		return "never"
+	case RetainTmpOnFailure:
+		return "onfailure"
+	case RetainTmpAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("TmpRetention(%d)", int(r))
+	}
+}
+
+// retain tells whether the $tmp directory of an exec that completed
+// with the provided result error should be retained.
+func (r TmpRetention) retain(err *errors.Error) bool {
+	switch r {
+	case RetainTmpAlways:
+		return true
+	case RetainTmpOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// TmpSnapshotter is implemented by execs that can stream the
+// contents of their $tmp directory for debugging.
+type TmpSnapshotter interface {
+	// SnapshotTmp writes a tar archive of the exec's current $tmp
+	// contents to w. If the exec has completed, the snapshot retained
+	// at the time of failure (if any) is written instead.
+	SnapshotTmp(ctx context.Context, w io.Writer) error
+}
+
+// tmpSnapshotLimit returns the maximum number of bytes to include
+// in $tmp snapshots.
+func (e *Executor) tmpSnapshotLimit() int64 {
+	if e.TmpSnapshotLimit > 0 {
+		return e.TmpSnapshotLimit
+	}
+	return defaultTmpSnapshotLimit
+}
+
+// tarDir writes a tar archive of the directory tree rooted at dir
+// to w. tarDir fails with errors.ResourcesExhausted if the archive
+// would contain more than limit bytes of file data. Symbolic links
+// are followed.
+func tarDir(ctx context.Context, w io.Writer, dir string, limit int64) error {
+	var (
+		walk walker.Walker
+		tw   = tar.NewWriter(w)
+		n    int64
+	)
+	walk.Init(dir)
+	for walk.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relpath := walk.Relpath()
+		if relpath == "." {
+			continue
+		}
+		info := walk.Info()
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = relpath
+		if info.IsDir() {
+			hdr.Name += "/"
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if n += info.Size(); n > limit {
+			return errors.E("snapshot", dir, errors.ResourcesExhausted,
+				errors.Errorf("snapshot exceeds limit of %d bytes", limit))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(walk.Path())
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, f, info.Size())
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := walk.Err(); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// saveTmpSnapshot saves a tar archive of the exec's $tmp directory
+// into the exec's directory, so that it may be retrieved after the
+// exec's $tmp has been removed.
+func (e *dockerExec) saveTmpSnapshot(ctx context.Context) error {
+	f, err := os.Create(e.path(tmpSnapshotPath))
+	if err != nil {
+		return err
+	}
+	if err := tarDir(ctx, f, e.scratchPath("tmp"), e.Executor.tmpSnapshotLimit()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return f.Close()
+}
+
+// SnapshotTmp implements TmpSnapshotter. While the exec is running,
+// the live contents of $tmp are archived; once the exec is complete,
+// the snapshot saved on failure is returned.
+func (e *dockerExec) SnapshotTmp(ctx context.Context, w io.Writer) error {
+	state, err := e.getState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case execUnstarted, execInit:
+		return errors.E("snapshot", e.id, errors.Precondition, errors.New("exec not yet created"))
+	case execCreated, execRunning:
+		return tarDir(ctx, w, e.scratchPath("tmp"), e.Executor.tmpSnapshotLimit())
+	default:
+		return copySnapshot(w, e.path(tmpSnapshotPath), e.id)
+	}
+}
+
+// SnapshotTmp implements TmpSnapshotter for zombie execs by
+// returning the snapshot saved on failure, if any.
+func (z *zombieExec) SnapshotTmp(ctx context.Context, w io.Writer) error {
+	return copySnapshot(w, z.objectPath(tmpSnapshotPath), z.id)
+}
+
+// copySnapshot copies the saved snapshot at path for exec id to w.
+func copySnapshot(w io.Writer, path string, id digest.Digest) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return errors.E("snapshot", id, errors.NotExist, errors.New("no tmp snapshot was retained"))
+	} else if err != nil {
+		return errors.E("snapshot", id, err)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestTarDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tardir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a":     "hello",
+		"b/c":   "world",
+		"b/d/e": "!",
+	}
+	for path, contents := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	var b bytes.Buffer
+	if err := tarDir(ctx, &b, dir, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	r := tar.NewReader(&b)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		p, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(p)
+	}
+	if want := files; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	err = tarDir(ctx, ioutil.Discard, dir, 8)
+	if err == nil || !errors.Is(errors.ResourcesExhausted, err) {
+		t.Errorf("expected resources exhausted error, got %v", err)
+	}
+}
+
+func TestTmpRetention(t *testing.T) {
+	failed := errors.Recover(errors.New("failed"))
+	for _, c := range []struct {
+		policy           TmpRetention
+		success, failure bool
+	}{
+		{RetainTmpNever, false, false},
+		{RetainTmpOnFailure, false, true},
+		{RetainTmpAlways, true, true},
+	} {
+		if got, want := c.policy.retain(nil), c.success; got != want {
+			t.Errorf("%s: success: got %v, want %v", c.policy, got, want)
+		}
+		if got, want := c.policy.retain(failed), c.failure; got != want {
+			t.Errorf("%s: failure: got %v, want %v", c.policy, got, want)
+		}
+	}
+}
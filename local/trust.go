@@ -0,0 +1,91 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/grailbio/reflow/errors"
+)
+
+// inspectTrust returns the output of "docker trust inspect" for the
+// provided repository or tag. It is a variable so that it may be
+// replaced in tests.
+var inspectTrust = func(ctx context.Context, ref string) ([]byte, error) {
+	out, err := osexec.CommandContext(ctx, "docker", "trust", "inspect", ref).Output()
+	if err != nil {
+		if exitErr, ok := err.(*osexec.ExitError); ok {
+			err = errors.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, errors.E("docker trust inspect", ref, err)
+	}
+	return out, nil
+}
+
+// trustData is the subset of the output of "docker trust inspect"
+// that is used to verify images.
+type trustData []struct {
+	Name       string
+	SignedTags []struct {
+		SignedTag string
+		Digest    string
+	}
+}
+
+// signedImage verifies, using Docker Content Trust, that the image
+// ref is signed, and returns a reference to the image by its signed
+// digest. Tagged (or untagged) references are resolved to the digest
+// signed for the tag; references by digest must name a digest that
+// is signed for one of the repository's tags. Images that are not
+// signed fail with an errors.NotAllowed error.
+//
+// Trust data is retrieved with the Docker CLI, which must be
+// installed on the executor's host, and which uses the CLI's
+// credentials and notary configuration.
+func signedImage(ctx context.Context, ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", errors.E("verify", ref, errors.Invalid, err)
+	}
+	var (
+		name = reference.FamiliarName(named)
+		tag  string
+		want string
+	)
+	if digested, ok := named.(reference.Digested); ok {
+		want = strings.TrimPrefix(digested.Digest().String(), "sha256:")
+	} else {
+		tag = "latest"
+		if tagged, ok := named.(reference.Tagged); ok {
+			tag = tagged.Tag()
+		}
+	}
+	target := name
+	if tag != "" {
+		target += ":" + tag
+	}
+	out, err := inspectTrust(ctx, target)
+	if err != nil {
+		return "", errors.E("verify", ref, err)
+	}
+	var data trustData
+	if err := json.Unmarshal(out, &data); err != nil {
+		return "", errors.E("verify", ref, errors.Invalid, err)
+	}
+	for _, repo := range data {
+		for _, signed := range repo.SignedTags {
+			d := strings.TrimPrefix(signed.Digest, "sha256:")
+			if d == "" || (tag != "" && signed.SignedTag != tag) || (want != "" && d != want) {
+				continue
+			}
+			return name + "@sha256:" + d, nil
+		}
+	}
+	return "", errors.E("verify", ref, errors.NotAllowed, errors.New("image is not signed"))
+}
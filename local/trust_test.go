@@ -0,0 +1,53 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grailbio/reflow/errors"
+)
+
+func TestSignedImage(t *testing.T) {
+	const (
+		signed   = "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"
+		unsigned = "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"
+	)
+	save := inspectTrust
+	defer func() { inspectTrust = save }()
+	var inspected []string
+	inspectTrust = func(ctx context.Context, ref string) ([]byte, error) {
+		inspected = append(inspected, ref)
+		return []byte(`[{"Name": "` + ref + `", "SignedTags": [{"SignedTag": "latest", "Digest": "` + signed + `", "Signers": ["alice"]}]}]`), nil
+	}
+	ctx := context.Background()
+	for _, c := range []struct {
+		ref, target, want string
+	}{
+		{"ubuntu", "ubuntu:latest", "ubuntu@sha256:" + signed},
+		{"ubuntu:latest", "ubuntu:latest", "ubuntu@sha256:" + signed},
+		{"ubuntu@sha256:" + signed, "ubuntu", "ubuntu@sha256:" + signed},
+		{"example.com/team/tool:latest", "example.com/team/tool:latest", "example.com/team/tool@sha256:" + signed},
+	} {
+		inspected = nil
+		got, err := signedImage(ctx, c.ref)
+		if err != nil {
+			t.Errorf("%s: %v", c.ref, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.ref, got, c.want)
+		}
+		if len(inspected) != 1 || inspected[0] != c.target {
+			t.Errorf("%s: inspected %v, want %v", c.ref, inspected, c.target)
+		}
+	}
+	for _, ref := range []string{"ubuntu:unsigned", "ubuntu@sha256:" + unsigned} {
+		if _, err := signedImage(ctx, ref); !errors.Is(errors.NotAllowed, err) {
+			t.Errorf("%s: expected NotAllowed error, got %v", ref, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/grailbio/base/traverse"
+	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
+)
+
+// warmConcurrency is the number of images pulled concurrently by
+// (*Executor).Warm.
+const warmConcurrency = 4
+
+// Warm ensures that the provided images are present at the executor's
+// Docker daemon, pulling those that are not, so that execs put later
+// with these images need not pull them (unless their pull policy is
+// reflow.PullAlways). Each distinct image is pulled once, with the
+// executor's authenticator, and concurrently with pulls by execs.
+// Progress is logged to the executor's log as images become present.
+// Warm fails if any of the images could not be pulled.
+func (e *Executor) Warm(ctx context.Context, images ...string) error {
+	var (
+		seen   = make(map[string]bool)
+		unique []string
+	)
+	for _, image := range images {
+		if !seen[image] {
+			seen[image] = true
+			unique = append(unique, image)
+		}
+	}
+	var done int32
+	return traverse.Limit(warmConcurrency).Each(len(unique), func(i int) error {
+		ref := unique[i]
+		if e.RequireSignedImages {
+			var err error
+			if ref, err = signedImage(ctx, ref); err != nil {
+				return errors.E("warm", unique[i], err)
+			}
+		}
+		if err := e.ensureImage(ctx, ref, e.platform(""), reflow.PullIfNotPresent); err != nil {
+			return errors.E("warm", unique[i], err)
+		}
+		e.Log.Printf("warmed image %s (%d/%d)", unique[i], atomic.AddInt32(&done, 1), len(unique))
+		return nil
+	})
+}
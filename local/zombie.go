@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/grailbio/base/digest"
+	"github.com/grailbio/base/sync/once"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/pool"
@@ -71,7 +72,7 @@ func (z *zombie) Get(ctx context.Context, id digest.Digest) (reflow.Exec, error)
 	if err != nil {
 		return nil, errors.E("get", z.id, id, err)
 	}
-	return &zombieExec{z, id}, nil
+	return &zombieExec{zombie: z, id: id}, nil
 }
 
 func (z *zombie) Remove(ctx context.Context, id digest.Digest) error {
@@ -113,7 +114,7 @@ func (z *zombie) Execs(ctx context.Context) ([]reflow.Exec, error) {
 		if err != nil {
 			continue
 		}
-		execs = append(execs, &zombieExec{z, id})
+		execs = append(execs, &zombieExec{zombie: z, id: id})
 	}
 	return execs, nil
 }
@@ -129,6 +130,10 @@ func (z *zombie) Unload(ctx context.Context, fs reflow.Fileset) error {
 type zombieExec struct {
 	*zombie
 	id digest.Digest
+
+	// resultOnce guards the read of result from the exec's manifest.
+	resultOnce once.Task
+	result     reflow.Result
 }
 
 func (z *zombieExec) objectPath(elems ...string) string {
@@ -150,6 +155,10 @@ func (z *zombieExec) Inspect(ctx context.Context) (reflow.ExecInspect, error) {
 		State:   "zombie",
 		Status:  "zombie",
 		Profile: manifest.Stats.Profile(),
+
+		Transfer: manifest.Transfer,
+		Limits:   containerLimits(manifest.Docker),
+		Version:  manifest.Version,
 	}
 	// Blob execs don't have Docker manifests.
 	if manifest.Docker.ContainerJSONBase == nil {
@@ -199,12 +208,22 @@ func (z *zombieExec) Wait(ctx context.Context) error {
 	return errors.E("wait", z.URI(), errors.NotSupported, errZombieExec)
 }
 
+// Result returns the result stored in the zombie exec's manifest.
+// The manifest is read once; subsequent (and concurrent) calls
+// return the same result.
 func (z *zombieExec) Result(ctx context.Context) (reflow.Result, error) {
-	manifest, err := z.manifest(z.id)
+	err := z.resultOnce.Do(func() error {
+		manifest, err := z.manifest(z.id)
+		if err != nil {
+			return err
+		}
+		z.result = manifest.Result
+		return nil
+	})
 	if err != nil {
 		return reflow.Result{}, err
 	}
-	return manifest.Result, nil
+	return z.result, nil
 }
 
 func (z *zombieExec) Promote(ctx context.Context) error {
@@ -0,0 +1,195 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package reflow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grailbio/base/digest"
+)
+
+// metricFamilies are the metric families exported by
+// WriteOpenMetrics, in order. Each family has one sample per profiled
+// resource of each exec.
+var metricFamilies = []struct {
+	name, help string
+	// value returns the sample's value and timestamp.
+	value func(k string, inspect ExecInspect) (float64, time.Time)
+}{
+	{
+		"reflow_exec_profile_mean",
+		"Mean of the sampled resource usage over the exec's lifetime.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			return inspect.Profile[k].Mean, inspect.Profile[k].Last
+		},
+	},
+	{
+		"reflow_exec_profile_max",
+		"Maximum of the sampled resource usage over the exec's lifetime.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			return inspect.Profile[k].Max, inspect.Profile[k].Last
+		},
+	},
+	{
+		"reflow_exec_profile_variance",
+		"Variance of the sampled resource usage over the exec's lifetime.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			return inspect.Profile[k].Var, inspect.Profile[k].Last
+		},
+	},
+	{
+		"reflow_exec_profile_samples",
+		"Number of samples of the resource usage.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			return float64(inspect.Profile[k].N), inspect.Profile[k].Last
+		},
+	},
+	{
+		"reflow_exec_profile_first_timestamp_seconds",
+		"Time of the first sample of the resource usage.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			first := inspect.Profile[k].First
+			return unixSeconds(first), first
+		},
+	},
+	{
+		"reflow_exec_profile_last_timestamp_seconds",
+		"Time of the last sample of the resource usage.",
+		func(k string, inspect ExecInspect) (float64, time.Time) {
+			last := inspect.Profile[k].Last
+			return unixSeconds(last), last
+		},
+	},
+}
+
+// WriteOpenMetrics writes the profiles and gauges of the provided
+// execs, keyed by exec ID, to w in the OpenMetrics text exposition
+// format. Samples are labeled with the exec's ID ("exec") and
+// identifier ("ident"), the profiled resource ("resource"), and the
+// exec's labels, whose names are sanitized and prefixed with
+// "label_".
+//
+// Profile summaries are timestamped with the time of their last
+// sample, when the summary became final; the first and last sample
+// times are also exported as their own families. Resources without
+// samples are omitted. Gauges are exported, without timestamps, as
+// the "reflow_exec_gauge" family.
+func WriteOpenMetrics(w io.Writer, execs map[digest.Digest]ExecInspect) error {
+	ids := make([]digest.Digest, 0, len(execs))
+	labels := make(map[digest.Digest]string, len(execs))
+	for id, inspect := range execs {
+		ids = append(ids, id)
+		labels[id] = metricLabels(id, inspect)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	var b bytes.Buffer
+	for _, family := range metricFamilies {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", family.name)
+		fmt.Fprintf(&b, "# HELP %s %s\n", family.name, family.help)
+		for _, id := range ids {
+			inspect := execs[id]
+			for _, k := range profileKeys(inspect.Profile) {
+				if inspect.Profile[k].N == 0 {
+					continue
+				}
+				v, t := family.value(k, inspect)
+				writeSample(&b, family.name, labels[id], k, v, t)
+			}
+		}
+	}
+	b.WriteString("# TYPE reflow_exec_gauge gauge\n")
+	b.WriteString("# HELP reflow_exec_gauge Last value of the exec's gauge.\n")
+	for _, id := range ids {
+		gauges := execs[id].Gauges
+		keys := make([]string, 0, len(gauges))
+		for k := range gauges {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeSample(&b, "reflow_exec_gauge", labels[id], k, gauges[k], time.Time{})
+		}
+	}
+	b.WriteString("# EOF\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeSample writes a sample of the named metric with the provided
+// exec labels and resource; the sample is timestamped unless t is
+// zero.
+func writeSample(b *bytes.Buffer, name, labels, resource string, v float64, t time.Time) {
+	fmt.Fprintf(b, "%s{%s,resource=\"%s\"} %s", name, labels, escapeLabelValue(resource), strconv.FormatFloat(v, 'g', -1, 64))
+	if !t.IsZero() {
+		fmt.Fprintf(b, " %d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond))
+	}
+	b.WriteByte('\n')
+}
+
+// metricLabels returns the rendered labels of the exec with the
+// provided ID.
+func metricLabels(id digest.Digest, inspect ExecInspect) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "exec=\"%s\"", id)
+	if ident := inspect.Config.Ident; ident != "" {
+		fmt.Fprintf(&b, ",ident=\"%s\"", escapeLabelValue(ident))
+	}
+	keys := make([]string, 0, len(inspect.Config.Labels))
+	for k := range inspect.Config.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// Sanitization may map distinct labels to the same name; the
+	// first, in key order, is kept.
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		name := "label_" + sanitizeLabelName(k)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		fmt.Fprintf(&b, ",%s=\"%s\"", name, escapeLabelValue(inspect.Config.Labels[k]))
+	}
+	return b.String()
+}
+
+// sanitizeLabelName replaces the characters of name that are not
+// permitted in OpenMetrics label names with underscores.
+func sanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// escapeLabelValue escapes backslashes, double quotes, and newlines
+// in the label value v.
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func profileKeys(p Profile) []string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package reflow_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var (
+		id    = reflow.Digester.FromString("exec")
+		first = time.Unix(1500000000, 0)
+		last  = time.Unix(1500000060, 250*int64(time.Millisecond))
+	)
+	inspect := reflow.ExecInspect{
+		Config: reflow.ExecConfig{
+			Ident:  "align",
+			Labels: map[string]string{"sample-id": `a"b`},
+		},
+		Profile: reflow.Profile{},
+		Gauges:  reflow.Gauges{"mem": 5},
+	}
+	inspect.Profile["mem"] = struct {
+		Max, Mean, Var float64
+		N              int64
+		First, Last    time.Time
+	}{Max: 10, Mean: 4.5, Var: 1, N: 12, First: first, Last: last}
+	inspect.Profile["cpu"] = struct {
+		Max, Mean, Var float64
+		N              int64
+		First, Last    time.Time
+	}{}
+	var b bytes.Buffer
+	if err := reflow.WriteOpenMetrics(&b, map[digest.Digest]reflow.ExecInspect{id: inspect}); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	labels := `{exec="` + id.String() + `",ident="align",label_sample_id="a\"b",resource="mem"}`
+	for _, line := range []string{
+		"# TYPE reflow_exec_profile_mean gauge",
+		"reflow_exec_profile_mean" + labels + " 4.5 1500000060.250",
+		"reflow_exec_profile_max" + labels + " 10 1500000060.250",
+		"reflow_exec_profile_samples" + labels + " 12 1500000060.250",
+		"reflow_exec_profile_first_timestamp_seconds" + labels + " 1.5e+09 1500000000.000",
+		"reflow_exec_gauge" + labels + " 5",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing line %q in output:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, `resource="cpu"`) {
+		t.Errorf("unsampled resource exported:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("output not terminated:\n%s", out)
+	}
+}
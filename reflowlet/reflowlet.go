@@ -28,6 +28,7 @@ import (
 	infratls "github.com/grailbio/infra/tls"
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/blob/httpblob"
 	"github.com/grailbio/reflow/blob/s3blob"
 	"github.com/grailbio/reflow/ec2authenticator"
 	"github.com/grailbio/reflow/ec2cluster/volume"
@@ -210,6 +211,12 @@ func (s *Server) ListenAndServe() error {
 	} else if dockerconfig.Value() == "hard" {
 		hardMemLimit = true
 	}
+	// HTTP object stores are authenticated only if a token is
+	// configured; configurations need not provide one.
+	var httptoken *infra2.HTTPTokenConfig
+	if err := s.Config.Instance(&httptoken); err != nil {
+		httptoken = nil
+	}
 	if err := s.setTags(sess); err != nil {
 		return fmt.Errorf("set tags: %v", err)
 	}
@@ -230,7 +237,9 @@ func (s *Server) ListenAndServe() error {
 		AWSImage:      string(*tool),
 		AWSCreds:      creds,
 		Blob: blob.Mux{
-			"s3": s3blob.New(sess),
+			"s3":    s3blob.New(sess),
+			"http":  httpblob.New("http", nil, httptoken.TokenProvider()),
+			"https": httpblob.New("https", nil, httptoken.TokenProvider()),
 		},
 		Log:          log.Std.Tee(nil, "executor: "),
 		HardMemLimit: hardMemLimit,
@@ -0,0 +1,103 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filerepo
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	"golang.org/x/sync/errgroup"
+)
+
+// BlockDigest computes the block (tree) digest of the size bytes
+// read from r. The data is split into consecutive blocks of
+// blockSize bytes (the last block may be shorter); each block is
+// digested independently, and up to parallelism blocks are
+// digested concurrently. The resulting digest is the reflow.Digester
+// digest of the concatenation of:
+//
+//   - blockSize, as a little-endian uint64;
+//   - size, as a little-endian uint64;
+//   - the binary digest of each block, in order.
+//
+// The digest is a function only of the data and blockSize; it does
+// not depend on parallelism. Block digests differ from the flat
+// digest of the same data, and digests computed with different block
+// sizes differ from each other. Repositories with a BlockSize name
+// the objects of large files by their block digest; see
+// Repository.BlockSize.
+func BlockDigest(r io.ReaderAt, size, blockSize int64, parallelism int) (digest.Digest, error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	nblock := (size + blockSize - 1) / blockSize
+	blocks := make([]digest.Digest, nblock)
+	sema := make(chan struct{}, parallelism)
+	var g errgroup.Group
+	for i := range blocks {
+		i := i
+		sema <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sema }()
+			off := int64(i) * blockSize
+			n := blockSize
+			if off+n > size {
+				n = size - off
+			}
+			w := reflow.Digester.NewWriter()
+			if _, err := io.Copy(w, io.NewSectionReader(r, off, n)); err != nil {
+				return err
+			}
+			blocks[i] = w.Digest()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return digest.Digest{}, err
+	}
+	return composeBlocks(size, blockSize, blocks), nil
+}
+
+// ReadBlockDigest computes the block digest, as defined by
+// BlockDigest, of the data read sequentially from r until EOF. It
+// is used where the data cannot be read at random, for example from
+// a compressed or remote object.
+func ReadBlockDigest(r io.Reader, blockSize int64) (digest.Digest, error) {
+	var (
+		size   int64
+		blocks []digest.Digest
+	)
+	for {
+		w := reflow.Digester.NewWriter()
+		n, err := io.CopyN(w, r, blockSize)
+		if n > 0 {
+			size += n
+			blocks = append(blocks, w.Digest())
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return digest.Digest{}, err
+		}
+	}
+	return composeBlocks(size, blockSize, blocks), nil
+}
+
+// composeBlocks returns the block digest of size bytes with the
+// provided block digests.
+func composeBlocks(size, blockSize int64, blocks []digest.Digest) digest.Digest {
+	w := reflow.Digester.NewWriter()
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(blockSize))
+	w.Write(b[:])
+	binary.LittleEndian.PutUint64(b[:], uint64(size))
+	w.Write(b[:])
+	for _, d := range blocks {
+		digest.WriteDigest(w, d)
+	}
+	return w.Digest()
+}
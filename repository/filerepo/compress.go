@@ -0,0 +1,267 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filerepo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow/errors"
+)
+
+// A Codec compresses the objects stored in a repository; see
+// Repository.Codec.
+type Codec interface {
+	// Name names the codec. It is used as the filename extension of
+	// the objects compressed by the codec, and must be unique among
+	// registered codecs.
+	Name() string
+	// NewWriter returns a writer that compresses to w. The compressed
+	// stream is complete once the writer is closed.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader that decompresses from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip is a Codec that compresses objects with gzip.
+var Gzip Codec = gzipCodec{}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gz" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	codecsMu sync.Mutex
+	codecs   = map[string]Codec{Gzip.Name(): Gzip}
+)
+
+// RegisterCodec registers the codec c, so that repositories can read
+// the objects it compressed. Codecs must be registered before they
+// are used; Gzip is always registered.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[c.Name()]; ok {
+		panic("filerepo: codec " + c.Name() + " already registered")
+	}
+	codecs[c.Name()] = c
+}
+
+// registeredCodecs returns the registered codecs, ordered by name.
+func registeredCodecs() []Codec {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	list := make([]Codec, 0, len(codecs))
+	for _, c := range codecs {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// Compressed objects are stored with a header containing the size of
+// the uncompressed object, as a big-endian uint64, followed by the
+// compressed stream.
+const headerSize = 8
+
+// compressedPath returns the path and codec of the compressed object
+// with digest id. It returns false if there is no such object.
+func (r *Repository) compressedPath(id digest.Digest) (string, Codec, bool) {
+	_, path := r.Path(id)
+	for _, c := range registeredCodecs() {
+		if _, err := os.Stat(path + "." + c.Name()); err == nil {
+			return path + "." + c.Name(), c, true
+		}
+	}
+	return "", nil, false
+}
+
+// compressedSize returns the uncompressed size of the compressed
+// object stored at path.
+func compressedSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var header [headerSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, errors.E("read", path, errors.Integrity, err)
+	}
+	return int64(binary.BigEndian.Uint64(header[:])), nil
+}
+
+// openCompressed opens the compressed object stored at path.
+func openCompressed(path string, c Codec) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var header [headerSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		f.Close()
+		return nil, 0, errors.E("read", path, errors.Integrity, err)
+	}
+	rc, err := c.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, 0, errors.E("read", path, errors.Integrity, err)
+	}
+	return decompressor{rc, f}, int64(binary.BigEndian.Uint64(header[:])), nil
+}
+
+// decompressor is the io.ReadCloser of a compressed object; closing
+// it closes both the decompressing reader and the underlying file.
+type decompressor struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (d decompressor) Close() error {
+	err := d.ReadCloser.Close()
+	if ferr := d.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// installCompressed installs the file, whose contents have digest d,
+// by compressing it with the repository's codec. The compressed
+// object is written to a temporary file that is renamed into place,
+// so that objects are never partially visible.
+func (r *Repository) installCompressed(d digest.Digest, file string) error {
+	if ok, _ := r.Contains(d); ok {
+		return nil
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	temp, err := r.TempFile("compress-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	err = writeCompressed(temp, src, r.Codec)
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.E("compress", d, err)
+	}
+	dir, path := r.Path(d)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path+"."+r.Codec.Name())
+}
+
+// writeCompressed writes the header and compressed contents of src to
+// f.
+func writeCompressed(f *os.File, src io.Reader, c Codec) error {
+	var header [headerSize]byte
+	if _, err := f.Write(header[:]); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	w, err := c.NewWriter(bw)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, src)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(header[:], uint64(n))
+	_, err = f.WriteAt(header[:], 0)
+	return err
+}
+
+// materializeCompressed writes the decompressed contents of the
+// compressed object stored at rpath to path.
+func materializeCompressed(rpath string, c Codec, path string) error {
+	rc, _, err := openCompressed(rpath, c)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0444)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// vacuumCompressed moves the compressed object stored at src, whose
+// digest is d, into the repository, keeping its compression.
+func (r *Repository) vacuumCompressed(d digest.Digest, src string) error {
+	if ok, _ := r.Contains(d); ok {
+		return nil
+	}
+	dir, path := r.Path(d)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	path += filepath.Ext(src)
+	err := os.Link(src, path)
+	if os.IsExist(err) {
+		err = nil
+	}
+	if linkErr, ok := err.(*os.LinkError); ok && linkErr.Err == syscall.EXDEV {
+		err = r.copyFile(src, path)
+	}
+	return err
+}
+
+// copyFile copies the file src to path through a temporary file in
+// the repository.
+func (r *Repository) copyFile(src, path string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	temp, err := r.TempFile("copy-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, f)
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
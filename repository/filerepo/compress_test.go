@@ -0,0 +1,115 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filerepo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/base/digest"
+	"github.com/grailbio/reflow"
+	grailtest "github.com/grailbio/testutil"
+)
+
+func TestCompress(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+	// An object stored before compression was enabled.
+	raw := mustInstall(t, r, "raw")
+	r.Codec = Gzip
+	contents := strings.Repeat("compressible ", 1000)
+	id := mustInstall(t, r, contents)
+	if got, want := id, reflow.Digester.FromString(contents); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	_, path := r.Path(id)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no uncompressed object, got %v", err)
+	}
+	info, err := os.Stat(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= int64(len(contents)) {
+		t.Errorf("object of size %d was not compressed (%d bytes)", len(contents), info.Size())
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		id       digest.Digest
+		contents string
+	}{{id, contents}, {raw, "raw"}} {
+		if ok, err := r.Contains(c.id); err != nil || !ok {
+			t.Errorf("%v: expected object, got %v, %v", c.id, ok, err)
+		}
+		file, err := r.Stat(ctx, c.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := file.Size, int64(len(c.contents)); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		rc, err := r.Get(ctx, c.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), c.contents; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	root, cleanupRoot := grailtest.TempDir(t, "", "materialize-")
+	defer cleanupRoot()
+	if err := r.Materialize(root, map[string]digest.Digest{"a/b": id, "c": raw}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(root, "a/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), contents; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var scanned []digest.Digest
+	if err := r.Scan(ctx, func(d digest.Digest) error {
+		scanned = append(scanned, d)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(scanned), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	dst, cleanupDst := newTestRepository(t)
+	defer cleanupDst()
+	if err := dst.Vacuum(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	file, err := dst.Stat(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := file.Size, int64(len(contents)); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := dst.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := dst.Contains(id); ok {
+		t.Error("object was not removed")
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package filerepo
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request, _IOW(0x94, 9, int).
+const ficlone = 0x40049409
+
+// reflink clones the contents of the file src into the (new or
+// truncated) file dst, sharing their blocks on filesystems that support
+// copy-on-write clones, such as Btrfs and XFS.
+func reflink(src, dst *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// reflinkUnsupported tells whether err indicates that the filesystem
+// does not support clones at all, rather than that the particular
+// clone failed (e.g., because the files are on different devices).
+func reflinkUnsupported(err error) bool {
+	switch err {
+	case syscall.EOPNOTSUPP, syscall.ENOTTY, syscall.EINVAL, syscall.ENOSYS:
+		return true
+	}
+	return false
+}
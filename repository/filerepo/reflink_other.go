@@ -0,0 +1,20 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package filerepo
+
+import (
+	"os"
+	"syscall"
+)
+
+func reflink(src, dst *os.File) error {
+	return syscall.EOPNOTSUPP
+}
+
+func reflinkUnsupported(err error) bool {
+	return err == syscall.EOPNOTSUPP
+}
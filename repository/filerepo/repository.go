@@ -15,6 +15,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -39,7 +41,28 @@ type Repository struct {
 	// RepoURL may be set to a URL that represents this repository.
 	RepoURL *url.URL
 
+	// BlockSize, if positive, causes Install to digest files larger
+	// than BlockSize by their block digest (see BlockDigest), with
+	// blocks of this size, digesting blocks in parallel. Such files
+	// are named by their block digest, which is recorded in the
+	// returned file's BlockDigest; files no larger than BlockSize are
+	// named by their flat digest. Objects named by block digests are
+	// verified as such by Verify, ReadFrom, and PutFile.
+	BlockSize int64
+
+	// Codec, if non-nil, compresses the objects installed in the
+	// repository. Objects are still named by the digest of their
+	// uncompressed contents, and are transparently decompressed when
+	// read; objects stored before the codec was set, or compressed by
+	// other registered codecs, remain readable. Compressed objects
+	// cannot be hard linked: Install copies (and compresses) files
+	// instead of linking them, and Materialize writes decompressed
+	// copies of objects.
+	Codec Codec
+
 	read, write singleflight.Group
+	// noClone is set once clones have failed for lack of support.
+	noClone int32
 }
 
 // Path returns the filesystem directory and full path of the object with a given digest.
@@ -55,6 +78,19 @@ func (r *Repository) Install(file string) (reflow.File, error) {
 		return reflow.File{}, err
 	}
 	defer f.Close()
+	if r.BlockSize > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return reflow.File{}, err
+		}
+		if n := info.Size(); n > r.BlockSize {
+			d, err := BlockDigest(f, n, r.BlockSize, runtime.NumCPU())
+			if err != nil {
+				return reflow.File{}, err
+			}
+			return r.File(d, n), r.InstallDigest(d, file)
+		}
+	}
 	w := reflow.Digester.NewWriter()
 	n, err := io.Copy(w, f)
 	if err != nil {
@@ -64,17 +100,38 @@ func (r *Repository) Install(file string) (reflow.File, error) {
 	return reflow.File{ID: d, Size: n}, r.InstallDigest(d, file)
 }
 
+// File returns the file with digest id and the given size, as it
+// would be returned by Install: files larger than the repository's
+// BlockSize carry their block digest.
+func (r *Repository) File(id digest.Digest, size int64) reflow.File {
+	file := reflow.File{ID: id, Size: size}
+	if r.BlockSize > 0 && size > r.BlockSize {
+		file.BlockDigest, file.BlockSize = id, r.BlockSize
+	}
+	return file
+}
+
 // InstallDigest installs a file at the given digest. The caller guarantees
-// that the file's bytes have the digest d.
+// that the file's bytes have the digest d. Where the filesystem
+// supports it, the file is cloned (copy-on-write) into the
+// repository, so that the object does not share the file's later
+// modifications; otherwise it is hard linked, or, if it resides on a
+// different device, copied.
 func (r *Repository) InstallDigest(d digest.Digest, file string) error {
 	file, err := filepath.EvalSymlinks(file)
 	if err != nil {
 		return err
 	}
+	if r.Codec != nil {
+		return r.installCompressed(d, file)
+	}
 	dir, path := r.Path(d)
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return err
 	}
+	if r.clone(file, path) {
+		return nil
+	}
 	err = os.Link(file, path)
 	if os.IsExist(err) {
 		err = nil
@@ -93,10 +150,55 @@ func (r *Repository) InstallDigest(d digest.Digest, file string) error {
 	return err
 }
 
+// clone attempts to clone file to path, reporting whether it
+// succeeded. The clone is made through a temporary file, so that
+// partial objects are never visible. Once a clone fails because the
+// repository's filesystem does not support clones, clone is no longer
+// attempted.
+func (r *Repository) clone(file, path string) bool {
+	if atomic.LoadInt32(&r.noClone) != 0 {
+		return false
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer src.Close()
+	temp, err := r.TempFile("clone-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(temp.Name())
+	err = reflink(src, temp)
+	if info, serr := src.Stat(); err == nil && serr == nil {
+		// Preserve the file's mode, as would a hard link.
+		err = temp.Chmod(info.Mode())
+	}
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if reflinkUnsupported(err) {
+			atomic.StoreInt32(&r.noClone, 1)
+		}
+		return false
+	}
+	return os.Rename(temp.Name(), path) == nil
+}
+
 // Stat retrieves metadata for files stored in the repository.
 func (r *Repository) Stat(ctx context.Context, id digest.Digest) (reflow.File, error) {
 	_, path := r.Path(id)
 	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if cpath, _, ok := r.compressedPath(id); ok {
+			size, err := compressedSize(cpath)
+			if err != nil {
+				return reflow.File{}, errors.E("stat", r.Root, id, err)
+			}
+			return reflow.File{ID: id, Size: size}, nil
+		}
+	}
 	if err != nil {
 		return reflow.File{}, errors.E("stat", r.Root, id, err)
 	}
@@ -105,18 +207,106 @@ func (r *Repository) Stat(ctx context.Context, id digest.Digest) (reflow.File, e
 
 // Get retrieves the object named by a digest.
 func (r *Repository) Get(ctx context.Context, id digest.Digest) (io.ReadCloser, error) {
-	_, path := r.Path(id)
-	rc, err := os.Open(path)
+	rc, _, err := r.open(id)
 	if err != nil {
 		return nil, errors.E("get", r.Root, id, err)
 	}
 	return rc, nil
 }
 
+// open opens the object named by a digest, returning a reader of its
+// (uncompressed) contents and its size. Uncompressed objects are
+// returned as *os.File.
+func (r *Repository) open(id digest.Digest) (io.ReadCloser, int64, error) {
+	_, path := r.Path(id)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		if cpath, c, ok := r.compressedPath(id); ok {
+			return openCompressed(cpath, c)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// Verify checks that the repository's object for file has the file's
+// contents, returning an errors.Integrity error if it does not. Files
+// with block digests are verified by their block digest: in parallel
+// blocks, unless their objects are stored compressed. Other files are
+// verified by their flat digest.
+func (r *Repository) Verify(ctx context.Context, file reflow.File) error {
+	if file.BlockDigest.IsZero() || file.BlockSize <= 0 {
+		rc, _, err := r.open(file.ID)
+		if err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+		defer rc.Close()
+		w := reflow.Digester.NewWriter()
+		if _, err := io.Copy(w, rc); err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+		if d := w.Digest(); d != file.ID {
+			return errors.E("verify", r.Root, file.ID, errors.Integrity, errors.Errorf("%v != %v", d, file.ID))
+		}
+		return nil
+	}
+	var (
+		d    digest.Digest
+		size int64
+	)
+	_, path := r.Path(file.ID)
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+		size = info.Size()
+		if d, err = BlockDigest(f, size, file.BlockSize, runtime.NumCPU()); err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+	} else {
+		rc, n, err := r.open(file.ID)
+		if err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+		defer rc.Close()
+		size = n
+		if d, err = ReadBlockDigest(rc, file.BlockSize); err != nil {
+			return errors.E("verify", r.Root, file.ID, err)
+		}
+	}
+	if d != file.BlockDigest || size != file.Size {
+		return errors.E("verify", r.Root, file.ID, errors.Integrity,
+			errors.Errorf("block digest %v (size %d) != %v (size %d)", d, size, file.BlockDigest, file.Size))
+	}
+	return nil
+}
+
 // Remove removes an object from the repository.
 func (r *Repository) Remove(id digest.Digest) error {
 	_, path := r.Path(id)
-	return os.Remove(path)
+	err := os.Remove(path)
+	for {
+		cpath, _, ok := r.compressedPath(id)
+		if !ok {
+			break
+		}
+		if cerr := os.Remove(cpath); cerr != nil {
+			return cerr
+		}
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	return err
 }
 
 // ReadFrom installs an object directly from a foreign repository. If
@@ -162,12 +352,8 @@ func (r *Repository) ReadFrom(ctx context.Context, id digest.Digest, u *url.URL)
 			return nil, err
 		}
 		defer rc.Close()
-		id2, err := r.Put(ctx, rc)
-		if err != nil {
-			return nil, err
-		}
-		if id != id2 {
-			return nil, errors.E("readfrom", u.String(), errors.Integrity, errors.Errorf("%v != %v", id, id2))
+		if err := r.PutFile(ctx, reflow.File{ID: id}, rc); err != nil {
+			return nil, errors.E("readfrom", u.String(), err)
 		}
 		return nil, nil
 	})
@@ -194,24 +380,21 @@ func (r *Repository) WriteTo(ctx context.Context, id digest.Digest, u *url.URL)
 		if err != nil {
 			return nil, err
 		}
-		dir, path := r.Path(id)
-		if err := os.MkdirAll(dir, 0777); err != nil {
-			return nil, err
-		}
-		file, err := os.Open(path)
+		file, size, err := r.open(id)
 		if err != nil {
 			return nil, errors.E("get", r.Root, id, err)
 		}
 		defer file.Close()
-		info, err := file.Stat()
-		if err != nil {
-			return nil, err
-		}
 		type putFiler interface {
 			PutFile(context.Context, reflow.File, io.Reader) error
 		}
 		if pf, ok := repo.(putFiler); ok {
-			return nil, pf.PutFile(ctx, reflow.File{ID: id, Size: info.Size()}, file)
+			f := reflow.File{ID: id, Size: size}
+			if r.BlockSize > 0 && size > r.BlockSize {
+				// The object may be named by its block digest.
+				f.BlockSize = r.BlockSize
+			}
+			return nil, pf.PutFile(ctx, f, file)
 		}
 		id2, err := repo.Put(ctx, file)
 		if err != nil {
@@ -235,7 +418,8 @@ func (r *Repository) Contains(id digest.Digest) (bool, error) {
 	_, path := r.Path(id)
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		return false, nil
+		_, _, ok := r.compressedPath(id)
+		return ok, nil
 	} else if err != nil {
 		return false, err
 	}
@@ -272,8 +456,49 @@ func (r *Repository) Put(ctx context.Context, body io.Reader) (digest.Digest, er
 	}
 }
 
+// PutFile installs the contents of body as the object named by
+// file.ID, returning an errors.Integrity error if the contents do not
+// have this digest. A file that is not named by its flat digest is
+// verified as a block digest with file.BlockSize, if set, or else
+// with the repository's BlockSize.
+func (r *Repository) PutFile(ctx context.Context, file reflow.File, body io.Reader) error {
+	temp, err := r.TempFile("create-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	dw := reflow.Digester.NewWriter()
+	n, err := io.Copy(temp, io.TeeReader(body, dw))
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	if d := dw.Digest(); d != file.ID {
+		blockSize := file.BlockSize
+		if blockSize <= 0 {
+			blockSize = r.BlockSize
+		}
+		var block digest.Digest
+		if blockSize > 0 && n > blockSize {
+			if block, err = BlockDigest(temp, n, blockSize, runtime.NumCPU()); err != nil {
+				temp.Close()
+				return err
+			}
+		}
+		if block != file.ID {
+			temp.Close()
+			return errors.E(errors.Integrity, errors.Errorf("%v != %v", file.ID, d))
+		}
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return r.InstallDigest(file.ID, temp.Name())
+}
+
 // Materialize takes a mapping of path-to-object, and hardlinks the
 // corresponding objects from the repository into the given root.
+// Compressed objects are instead decompressed into root.
 func (r *Repository) Materialize(root string, binds map[string]digest.Digest) error {
 	dirsMade := map[string]bool{}
 	for path, id := range binds {
@@ -288,7 +513,13 @@ func (r *Repository) Materialize(root string, binds map[string]digest.Digest) er
 		}
 		os.Remove(path) // best effort
 		_, rpath := r.Path(id)
-		if err := os.Link(rpath, path); err != nil {
+		err := os.Link(rpath, path)
+		if os.IsNotExist(err) {
+			if cpath, c, ok := r.compressedPath(id); ok {
+				err = materializeCompressed(cpath, c, path)
+			}
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -300,7 +531,13 @@ func (r *Repository) Vacuum(ctx context.Context, repo *Repository) error {
 	var w walker
 	w.Init(repo)
 	for w.Scan() {
-		if err := r.InstallDigest(w.Digest(), w.Path()); err != nil {
+		var err error
+		if filepath.Ext(w.Path()) != "" {
+			err = r.vacuumCompressed(w.Digest(), w.Path())
+		} else {
+			err = r.InstallDigest(w.Digest(), w.Path())
+		}
+		if err != nil {
 			return err
 		}
 	}
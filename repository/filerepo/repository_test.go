@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"io/ioutil"
+	"math/rand"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/grailbio/base/digest"
 	"github.com/grailbio/reflow"
+	"github.com/grailbio/reflow/errors"
 	"github.com/grailbio/reflow/liveset/bloomlive"
 	"github.com/grailbio/reflow/repository"
 	"github.com/grailbio/reflow/test/testutil"
@@ -261,3 +263,145 @@ func TestScan(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockDigest(t *testing.T) {
+	p := make([]byte, 1000)
+	rand.New(rand.NewSource(0)).Read(p)
+	want, err := BlockDigest(bytes.NewReader(p), int64(len(p)), 64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, parallelism := range []int{2, 7, 100} {
+		got, err := BlockDigest(bytes.NewReader(p), int64(len(p)), 64, parallelism)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("parallelism %d: got %v, want %v", parallelism, got, want)
+		}
+	}
+	if d, _ := BlockDigest(bytes.NewReader(p), int64(len(p)), 128, 1); d == want {
+		t.Error("expected block size to affect digest")
+	}
+	if d := reflow.Digester.FromBytes(p); d == want {
+		t.Error("expected block digest to differ from flat digest")
+	}
+	if got, err := ReadBlockDigest(bytes.NewReader(p), 64); err != nil {
+		t.Fatal(err)
+	} else if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+	r.BlockSize = 64
+	f, err := ioutil.TempFile("", "blockdigest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := r.Install(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := file.ID; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := file.BlockDigest; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := file.BlockSize, int64(64); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := r.File(want, int64(len(p))); got != file {
+		t.Errorf("got %v, want %v", got, file)
+	}
+	if ok, err := r.Contains(want); err != nil || !ok {
+		t.Errorf("expected repository to contain %v", want)
+	}
+	ctx := context.Background()
+	if err := r.Verify(ctx, file); err != nil {
+		t.Error(err)
+	}
+
+	// Objects named by their block digests can be exchanged between
+	// repositories.
+	r2, cleanup2 := newTestRepository(t)
+	defer cleanup2()
+	if err := r2.PutFile(ctx, reflow.File{ID: want, BlockSize: 64}, bytes.NewReader(p)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := r2.Contains(want); err != nil || !ok {
+		t.Errorf("expected repository to contain %v", want)
+	}
+	if err := r2.PutFile(ctx, reflow.File{ID: want}, bytes.NewReader(p)); !errors.Is(errors.Integrity, err) {
+		t.Errorf("expected Integrity error, got %v", err)
+	}
+
+	// Corrupt the object in place.
+	_, path := r.Path(want)
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p[500]++
+	if err := ioutil.WriteFile(path, p, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(ctx, file); !errors.Is(errors.Integrity, err) {
+		t.Errorf("expected Integrity error, got %v", err)
+	}
+	file.BlockDigest, file.BlockSize = digest.Digest{}, 0
+	if err := r.Verify(ctx, file); !errors.Is(errors.Integrity, err) {
+		t.Errorf("expected Integrity error, got %v", err)
+	}
+}
+
+// TestInstallClone tests that installed files are cloned where the
+// filesystem supports it, and are otherwise linked.
+func TestInstallClone(t *testing.T) {
+	r, cleanup := newTestRepository(t)
+	defer cleanup()
+	file := filepath.Join(r.Root, "tmp", "file")
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := r.Install(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, path := r.Path(f.ID)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode(), orig.Mode(); got != want {
+		t.Errorf("got mode %v, want %v", got, want)
+	}
+	if os.SameFile(info, orig) {
+		// The filesystem does not support clones.
+		return
+	}
+	if err := ioutil.WriteFile(file, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "original"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
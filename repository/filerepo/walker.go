@@ -7,6 +7,7 @@ package filerepo
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/grailbio/base/digest"
 	"github.com/grailbio/reflow"
@@ -56,6 +57,8 @@ func (w *walker) Scan() bool {
 		if first == "tmp" {
 			continue
 		}
+		// Compressed objects are named with their codec's extension.
+		last = strings.TrimSuffix(last, filepath.Ext(last))
 		w.dgst, w.err = reflow.Digester.Parse(first + last)
 		if w.err != nil {
 			return false
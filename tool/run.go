@@ -30,6 +30,7 @@ import (
 	"github.com/grailbio/reflow"
 	"github.com/grailbio/reflow/assoc"
 	"github.com/grailbio/reflow/blob"
+	"github.com/grailbio/reflow/blob/httpblob"
 	"github.com/grailbio/reflow/blob/s3blob"
 	"github.com/grailbio/reflow/ec2authenticator"
 	"github.com/grailbio/reflow/errors"
@@ -55,6 +56,7 @@ type commonRunConfig struct {
 	gc             bool
 	nocacheextern  bool
 	recomputeempty bool
+	verifycache    bool
 	eval           string
 	invalidate     string
 	assert         string
@@ -64,6 +66,7 @@ func (r *commonRunConfig) Flags(flags *flag.FlagSet) {
 	flags.BoolVar(&r.gc, "gc", false, "enable garbage collection during evaluation")
 	flags.BoolVar(&r.nocacheextern, "nocacheextern", false, "don't cache extern ops")
 	flags.BoolVar(&r.recomputeempty, "recomputeempty", false, "recompute empty cache values")
+	flags.BoolVar(&r.verifycache, "verifycache", false, "verify the contents of cache hits against their digests")
 	flags.StringVar(&r.eval, "eval", "topdown", "evaluation strategy")
 	flags.StringVar(&r.invalidate, "invalidate", "", "regular expression for node identifiers that should be invalidated")
 	flags.StringVar(&r.assert, "assert", "never", "policy used to assert cached flow result compatibility (eg: never, exact)")
@@ -91,6 +94,7 @@ func (r *commonRunConfig) Configure(c *flow.EvalConfig, cmd *Cmd) {
 	c.NoCacheExtern = r.nocacheextern
 	c.GC = r.gc
 	c.RecomputeEmpty = r.recomputeempty
+	c.VerifyCache = r.verifycache
 	c.BottomUp = r.eval == "bottomup"
 	if r.invalidate != "" {
 		re := regexp.MustCompile(r.invalidate)
@@ -486,7 +490,7 @@ func (c *Cmd) runLocal(ctx context.Context, config runConfig, execLogger *log.Lo
 	if !config.resources.Equal(nil) {
 		resources = config.resources
 	}
-	x.SetResources(resources)
+	c.must(x.SetResources(resources))
 
 	c.must(x.Start())
 
@@ -641,8 +645,16 @@ func (c Cmd) blob() blob.Mux {
 	if err != nil {
 		c.Fatal(err)
 	}
+	// HTTP object stores are authenticated only if a token is
+	// configured; configurations need not provide one.
+	var httptoken *infra.HTTPTokenConfig
+	if err := c.Config.Instance(&httptoken); err != nil {
+		httptoken = nil
+	}
 	return blob.Mux{
-		"s3": s3blob.New(sess),
+		"s3":    s3blob.New(sess),
+		"http":  httpblob.New("http", nil, httptoken.TokenProvider()),
+		"https": httpblob.New("https", nil, httptoken.TokenProvider()),
 	}
 }
 
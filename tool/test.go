@@ -123,6 +123,6 @@ func (c *Cmd) makeTestExecutor(executor **local.Executor) {
 		AWSCreds:      creds,
 		Log:           c.Log.Tee(nil, "executor: "),
 	}
-	(*executor).SetResources(resources)
+	c.must((*executor).SetResources(resources))
 	c.must((*executor).Start())
 }